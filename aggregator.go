@@ -0,0 +1,500 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/midstar/plm/monitor"
+)
+
+// AgentTimeout is the maximum time to wait for a response from an agent
+const AgentTimeout = 10 * time.Second
+
+// Agent is a remote PLM instance whose data is included in the aggregated
+// views of this PLM instance
+type Agent struct {
+	Name string // Host name used in the aggregated views
+	URL  string // Base URL of the agent, for example http://build1:12124
+}
+
+// ParseAgents parses agent definitions on the format [<name>=]<url>. If no
+// name is given the host name of the URL is used.
+func ParseAgents(definitions []string) ([]Agent, error) {
+	agents := make([]Agent, 0, len(definitions))
+	names := make(map[string]bool)
+	for _, definition := range definitions {
+		agent := Agent{URL: definition}
+		if i := strings.Index(definition, "="); i >= 0 {
+			agent.Name = strings.TrimSpace(definition[:i])
+			agent.URL = strings.TrimSpace(definition[i+1:])
+		}
+		if !isHTTPURL(agent.URL) {
+			return nil, fmt.Errorf("agent %s is not a valid http or https URL", definition)
+		}
+		agent.URL = strings.TrimRight(agent.URL, "/")
+		if agent.Name == "" {
+			u, _ := url.Parse(agent.URL)
+			agent.Name = u.Hostname()
+		}
+		if names[agent.Name] {
+			return nil, fmt.Errorf("agent name %s is used more than once", agent.Name)
+		}
+		names[agent.Name] = true
+		agents = append(agents, agent)
+	}
+	return agents, nil
+}
+
+// isHTTPURL returns true if s is an absolute http or https URL
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// HostStatus describes a host in the aggregated views
+type HostStatus struct {
+	Name      string
+	URL       string // Empty for the local host
+	Local     bool   // True for the PLM instance serving the request
+	Pushed    bool   // True for hosts pushing to this instance (see Collector)
+	Reachable bool
+	Version   string
+	Error     string // Why the host is not reachable
+}
+
+// HostError is an error from one host in an aggregated view
+type HostError struct {
+	Host    string
+	Message string
+}
+
+// HostProcess is a process on a specific host
+type HostProcess struct {
+	Host string
+	monitor.Process
+}
+
+// HostMinMaxMem is a ProcessMinMaxMem on a specific host
+type HostMinMaxMem struct {
+	Host string
+	monitor.ProcessMinMaxMem
+}
+
+// HostMeasurements are the measurements on a specific host
+type HostMeasurements struct {
+	Host string
+	Measurements
+}
+
+// HostPage is a Page of an aggregated list. Hosts that could not provide
+// their part of the list are listed in Errors.
+type HostPage struct {
+	Page
+	Errors []HostError
+}
+
+// AggregatedMeasurements are the measurements of all hosts. Each host has
+// its own measurement times.
+type AggregatedMeasurements struct {
+	Hosts  []HostMeasurements
+	Errors []HostError
+}
+
+// Host is a source of process data in the aggregated views. The values
+// are the query parameters of the request (see getUIDs and getFromTo).
+type Host interface {
+	Name() string
+	Status() HostStatus
+	Processes(values url.Values) ([]monitor.Process, error)
+	Measurements(values url.Values) (*Measurements, error)
+	MinMaxMem(values url.Values) ([]monitor.ProcessMinMaxMem, error)
+	SetTag(name string) error
+}
+
+// Aggregator merges the data of several hosts
+type Aggregator struct {
+	hosts []Host // Use mutex for read/write
+	mutex sync.Mutex
+}
+
+// CreateAggregator creates an aggregator of the local PLM instance (served
+// by s) and the agents. The agents are accessed using token (if not empty).
+func CreateAggregator(s *HTTPServer, hostName string, agents []Agent, token string) *Aggregator {
+	if hostName == "" {
+		hostName, _ = os.Hostname()
+	}
+	client := &http.Client{Timeout: AgentTimeout}
+	a := &Aggregator{hosts: []Host{&localHost{name: hostName, server: s}}}
+	for _, agent := range agents {
+		a.hosts = append(a.hosts, &remoteHost{agent: agent, token: token, client: client})
+	}
+	return a
+}
+
+// AddHost adds a host. Returns an error if there already is a host with
+// the same name.
+func (a *Aggregator) AddHost(h Host) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, existing := range a.hosts {
+		if existing.Name() == h.Name() {
+			return fmt.Errorf("There is already a host named %s", h.Name())
+		}
+	}
+	a.hosts = append(a.hosts, h)
+	return nil
+}
+
+// Hosts returns all hosts. The local host is first.
+func (a *Aggregator) Hosts() []Host {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return append([]Host{}, a.hosts...)
+}
+
+// LocalName returns the name of the local host
+func (a *Aggregator) LocalName() string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.hosts[0].Name()
+}
+
+// HasAgents returns true if there are any other hosts than the local host
+func (a *Aggregator) HasAgents() bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return len(a.hosts) > 1
+}
+
+// forEach calls fn for each of the hosts selected by the host query
+// parameter (all hosts if not given) in parallel. Returns the errors,
+// sorted in host order.
+func forEach(hosts []Host, values url.Values, fn func(i int, h Host) error) []HostError {
+	selected := make(map[string]bool)
+	for _, name := range values["host"] {
+		selected[name] = true
+	}
+	errs := make([]error, len(hosts))
+	var wg sync.WaitGroup
+	for i, h := range hosts {
+		if len(selected) > 0 && !selected[h.Name()] {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, h Host) {
+			defer wg.Done()
+			errs[i] = fn(i, h)
+		}(i, h)
+	}
+	wg.Wait()
+	hostErrors := make([]HostError, 0)
+	for i, err := range errs {
+		if err != nil {
+			hostErrors = append(hostErrors, HostError{Host: hosts[i].Name(), Message: err.Error()})
+		}
+	}
+	return hostErrors
+}
+
+// hostQuery returns the query parameters to forward to each host
+func hostQuery(values url.Values) url.Values {
+	forward := url.Values{}
+	for key, value := range values {
+		if key != "host" && key != "offset" && key != "limit" {
+			forward[key] = value
+		}
+	}
+	return forward
+}
+
+// Statuses returns the status of all hosts
+func (a *Aggregator) Statuses() []HostStatus {
+	hosts := a.Hosts()
+	statuses := make([]HostStatus, len(hosts))
+	forEach(hosts, url.Values{}, func(i int, h Host) error {
+		statuses[i] = h.Status()
+		return nil
+	})
+	return statuses
+}
+
+// Processes returns the processes of all selected hosts, sorted on host
+// (local host first, then in the order the hosts were added) and UID.
+func (a *Aggregator) Processes(values url.Values) ([]HostProcess, []HostError) {
+	hosts := a.Hosts()
+	perHost := make([][]monitor.Process, len(hosts))
+	query := hostQuery(values)
+	errors := forEach(hosts, values, func(i int, h Host) (err error) {
+		perHost[i], err = h.Processes(query)
+		return err
+	})
+	result := make([]HostProcess, 0)
+	for i, processes := range perHost {
+		for _, p := range processes {
+			result = append(result, HostProcess{Host: hosts[i].Name(), Process: p})
+		}
+	}
+	return result, errors
+}
+
+// MinMaxMem returns the highest and lowest memory of the matching
+// processes on all selected hosts, sorted on host and UID.
+func (a *Aggregator) MinMaxMem(values url.Values) ([]HostMinMaxMem, []HostError) {
+	hosts := a.Hosts()
+	perHost := make([][]monitor.ProcessMinMaxMem, len(hosts))
+	query := hostQuery(values)
+	errors := forEach(hosts, values, func(i int, h Host) (err error) {
+		perHost[i], err = h.MinMaxMem(query)
+		return err
+	})
+	result := make([]HostMinMaxMem, 0)
+	for i, processes := range perHost {
+		for _, p := range processes {
+			result = append(result, HostMinMaxMem{Host: hosts[i].Name(), ProcessMinMaxMem: p})
+		}
+	}
+	return result, errors
+}
+
+// Measurements returns the measurements of the matching processes on all
+// selected hosts.
+func (a *Aggregator) Measurements(values url.Values) AggregatedMeasurements {
+	hosts := a.Hosts()
+	perHost := make([]*Measurements, len(hosts))
+	query := hostQuery(values)
+	errors := forEach(hosts, values, func(i int, h Host) (err error) {
+		perHost[i], err = h.Measurements(query)
+		return err
+	})
+	result := AggregatedMeasurements{Hosts: make([]HostMeasurements, 0), Errors: errors}
+	for i, measurements := range perHost {
+		if measurements != nil {
+			result.Hosts = append(result.Hosts, HostMeasurements{Host: hosts[i].Name(), Measurements: *measurements})
+		}
+	}
+	return result
+}
+
+// SetTag forwards a tag to all hosts except the local host. The tag time on
+// each host is the time when the host receives the tag. Failures are
+// logged.
+func (a *Aggregator) SetTag(name string) {
+	errors := forEach(a.Hosts(), url.Values{}, func(i int, h Host) error {
+		if _, isLocal := h.(*localHost); isLocal {
+			return nil
+		}
+		return h.SetTag(name)
+	})
+	for _, e := range errors {
+		log.Printf("Unable to set tag %s on %s. Reason: %s", name, e.Host, e.Message)
+	}
+}
+
+// localHost is the PLM instance serving the request
+type localHost struct {
+	name   string
+	server *HTTPServer
+}
+
+func (h *localHost) Name() string {
+	return h.name
+}
+
+func (h *localHost) Status() HostStatus {
+	return HostStatus{Name: h.name, Local: true, Reachable: true, Version: h.server.ver.Version}
+}
+
+func (h *localHost) Processes(values url.Values) ([]monitor.Process, error) {
+	uids, err := h.server.getUIDs(values)
+	if err != nil {
+		return nil, err
+	}
+	return h.server.getProcesses(uids), nil
+}
+
+func (h *localHost) Measurements(values url.Values) (*Measurements, error) {
+	uids, from, to, err := h.server.getQueryUIDsAndTime(values)
+	if err != nil {
+		return nil, err
+	}
+	metric, err := getMetric(values)
+	if err != nil {
+		return nil, err
+	}
+	measurements := h.server.getMeasurements(uids, metric, from, to)
+	return &measurements, nil
+}
+
+func (h *localHost) MinMaxMem(values url.Values) ([]monitor.ProcessMinMaxMem, error) {
+	uids, from, to, err := h.server.getQueryUIDsAndTime(values)
+	if err != nil {
+		return nil, err
+	}
+	return h.server.measurement.GetMinMaxMem(uids, from, to), nil
+}
+
+func (h *localHost) SetTag(name string) error {
+	h.server.tagsMutex.Lock()
+	h.server.tags[name] = time.Now()
+	h.server.tagsMutex.Unlock()
+	return nil
+}
+
+// remoteHost is an agent accessed using the REST API
+type remoteHost struct {
+	agent  Agent
+	token  string
+	client *http.Client
+}
+
+func (h *remoteHost) Name() string {
+	return h.agent.Name
+}
+
+// do sends a request to the REST API of the agent and decodes the JSON
+// response into v (if not nil).
+func (h *remoteHost) do(method string, resource string, values url.Values, v interface{}) error {
+	u := h.agent.URL + APIv1Prefix + resource
+	if len(values) > 0 {
+		u += "?" + values.Encode()
+	}
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return err
+	}
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiError APIError
+		if json.NewDecoder(resp.Body).Decode(&apiError) == nil && apiError.Error.Message != "" {
+			return fmt.Errorf("%s", apiError.Error.Message)
+		}
+		return fmt.Errorf("Unexpected status code: %d", resp.StatusCode)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// getAll gets all pages of a paginated resource. appendItems is called with
+// the items of each page and returns the number of items.
+func (h *remoteHost) getAll(resource string, values url.Values, appendItems func(items json.RawMessage) (int, error)) error {
+	query := url.Values{}
+	for key, value := range values {
+		query[key] = value
+	}
+	query.Set("limit", strconv.Itoa(MaxPageLimit))
+	offset := 0
+	for {
+		query.Set("offset", strconv.Itoa(offset))
+		var page struct {
+			Items json.RawMessage
+			Total int
+		}
+		err := h.do(http.MethodGet, resource, query, &page)
+		if err != nil {
+			return err
+		}
+		n, err := appendItems(page.Items)
+		if err != nil {
+			return err
+		}
+		offset += n
+		if n == 0 || offset >= page.Total {
+			return nil
+		}
+	}
+}
+
+func (h *remoteHost) Status() HostStatus {
+	status := HostStatus{Name: h.agent.Name, URL: h.agent.URL}
+	var ver version
+	err := h.do(http.MethodGet, "version", nil, &ver)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Reachable = true
+	status.Version = ver.Version
+	return status
+}
+
+func (h *remoteHost) Processes(values url.Values) ([]monitor.Process, error) {
+	result := make([]monitor.Process, 0)
+	err := h.getAll("processes", values, func(items json.RawMessage) (int, error) {
+		var processes []monitor.Process
+		err := json.Unmarshal(items, &processes)
+		result = append(result, processes...)
+		return len(processes), err
+	})
+	return result, err
+}
+
+func (h *remoteHost) Measurements(values url.Values) (*Measurements, error) {
+	var measurements Measurements
+	err := h.do(http.MethodGet, "measurements", values, &measurements)
+	if err != nil {
+		return nil, err
+	}
+	return &measurements, nil
+}
+
+func (h *remoteHost) MinMaxMem(values url.Values) ([]monitor.ProcessMinMaxMem, error) {
+	result := make([]monitor.ProcessMinMaxMem, 0)
+	err := h.getAll("minmaxmem", values, func(items json.RawMessage) (int, error) {
+		var processes []monitor.ProcessMinMaxMem
+		err := json.Unmarshal(items, &processes)
+		result = append(result, processes...)
+		return len(processes), err
+	})
+	return result, err
+}
+
+func (h *remoteHost) SetTag(name string) error {
+	return h.do(http.MethodPut, "tags/"+url.PathEscape(name), nil, nil)
+}
+
+// serveAPIAggregate handles the aggregated resources, i.e. resources that
+// include the data of all hosts. The host query parameter (might be given
+// several times) restricts the hosts.
+func (s *HTTPServer) serveAPIAggregate(w http.ResponseWriter, r *http.Request, resource string, values url.Values) {
+	offset, limit, err := parsePage(values)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+		return
+	}
+	values, err = s.resolveRun(values) // Runs are only known by this host
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+		return
+	}
+	switch resource {
+	case "processes":
+		processes, errors := s.aggregator.Processes(values)
+		writeJSON(w, r, http.StatusOK, HostPage{Errors: errors, Page: newPage(len(processes), offset, limit,
+			func(start, end int) interface{} { return processes[start:end] })})
+	case "minmaxmem":
+		processes, errors := s.aggregator.MinMaxMem(values)
+		writeJSON(w, r, http.StatusOK, HostPage{Errors: errors, Page: newPage(len(processes), offset, limit,
+			func(start, end int) interface{} { return processes[start:end] })})
+	case "measurements":
+		writeJSON(w, r, http.StatusOK, s.aggregator.Measurements(values))
+	default:
+		writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, fmt.Sprintf("No such resource %s", r.URL.Path))
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/midstar/plm/monitor"
+	"github.com/midstar/proci"
+)
+
+func TestParseAgents(t *testing.T) {
+	agents, err := ParseAgents([]string{"http://build1:12124/", "second=https://10.0.0.2:12124"})
+	assertTrue(t, "Valid agents", err == nil)
+	assertEqualsInt(t, "Number of agents", 2, len(agents))
+	assertEqualsStr(t, "Name from URL", "build1", agents[0].Name)
+	assertEqualsStr(t, "URL without trailing slash", "http://build1:12124", agents[0].URL)
+	assertEqualsStr(t, "Name", "second", agents[1].Name)
+	assertEqualsStr(t, "URL", "https://10.0.0.2:12124", agents[1].URL)
+
+	_, err = ParseAgents([]string{"build1:12124"})
+	assertTrue(t, "URL without scheme", err != nil)
+	_, err = ParseAgents([]string{"a=http://build1:12124", "a=http://build2:12124"})
+	assertTrue(t, "Duplicate names", err != nil)
+}
+
+// startAgent starts a PLM HTTP server with n mocked processes
+func startAgent(t *testing.T, port int, n int, config *Configuration) *HTTPServer {
+	config.Port = port
+	m := monitor.CreateMeasurement(3, 6, 3, 6, proci.GenerateMock(n))
+	m.MeasureAndLog(false)
+	httpServer := CreateHTTPServer("", config, m)
+	httpServer.Start()
+	return httpServer
+}
+
+func TestAggregator(t *testing.T) {
+	agent1 := startAgent(t, 9094, 5, DefaultConfiguration())
+	defer agent1.Stop()
+	agent2Config := DefaultConfiguration()
+	agent2Config.ReadToken = "agentread"
+	agent2Config.WriteToken = "agentwrite"
+	agent2 := startAgent(t, 9095, 3, agent2Config)
+	defer agent2.Stop()
+
+	config := DefaultConfiguration()
+	config.HostName = "main"
+	config.AgentToken = "agentwrite"
+	config.Agents = []string{"agent1=http://localhost:9094", "agent2=http://localhost:9095",
+		"down=http://localhost:9099"}
+	aggregator := startAgent(t, 9096, 10, config)
+	defer aggregator.Stop()
+	time.Sleep(100 * time.Millisecond) // Allow servers to start
+	baseURL := "http://localhost:9096/api/v1"
+
+	// Host statuses
+	var statuses []HostStatus
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/hosts", "", &statuses))
+	assertEqualsInt(t, "Number of hosts", 4, len(statuses))
+	assertEqualsStr(t, "Local host", "main", statuses[0].Name)
+	assertTrue(t, "Local host is local", statuses[0].Local)
+	assertTrue(t, "agent1 reachable", statuses[1].Reachable)
+	assertTrue(t, "agent2 reachable", statuses[2].Reachable)
+	assertTrue(t, "down not reachable", !statuses[3].Reachable)
+
+	// Processes of all hosts
+	var processPage struct {
+		Items  []HostProcess
+		Total  int
+		Errors []HostError
+	}
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/aggregate/processes", "", &processPage))
+	assertEqualsInt(t, "Total", 18, processPage.Total)
+	assertEqualsInt(t, "Number of errors", 1, len(processPage.Errors))
+	assertEqualsStr(t, "Error host", "down", processPage.Errors[0].Host)
+	assertEqualsStr(t, "First host", "main", processPage.Items[0].Host)
+	assertEqualsStr(t, "Last host", "agent2", processPage.Items[17].Host)
+
+	// Restricted to hosts
+	url := baseURL + "/aggregate/processes?host=agent1&host=agent2&offset=4&limit=2"
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", url, "", &processPage))
+	assertEqualsInt(t, "Total", 8, processPage.Total)
+	assertEqualsInt(t, "Number of errors", 0, len(processPage.Errors))
+	assertEqualsInt(t, "Number of items", 2, len(processPage.Items))
+	assertEqualsStr(t, "Host in page", "agent1", processPage.Items[0].Host)
+	assertEqualsStr(t, "Host in page", "agent2", processPage.Items[1].Host)
+
+	// Min max memory on any host
+	var minMaxPage struct {
+		Items  []HostMinMaxMem
+		Total  int
+		Errors []HostError
+	}
+	url = baseURL + "/aggregate/minmaxmem?match=path_3&host=main&host=agent1&host=agent2"
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", url, "", &minMaxPage))
+	assertEqualsInt(t, "Total", 3, minMaxPage.Total)
+	for _, p := range minMaxPage.Items {
+		assertEqualsStr(t, "Path", "path_3", p.Path)
+		assertEqualsInt(t, "Max memory", 4, int(p.MaxMemoryInPeriod))
+	}
+
+	// Errors from hosts are reported per host
+	url = baseURL + "/aggregate/minmaxmem?fromTag=invalid&host=agent1"
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", url, "", &minMaxPage))
+	assertEqualsInt(t, "Number of errors", 1, len(minMaxPage.Errors))
+	assertEqualsStr(t, "Error host", "agent1", minMaxPage.Errors[0].Host)
+
+	// Measurements
+	var measurements AggregatedMeasurements
+	url = baseURL + "/aggregate/measurements?match=path_2&host=main&host=agent2"
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", url, "", &measurements))
+	assertEqualsInt(t, "Number of hosts", 2, len(measurements.Hosts))
+	assertEqualsStr(t, "Second host", "agent2", measurements.Hosts[1].Host)
+	assertEqualsInt(t, "Number of series", 1, len(measurements.Hosts[1].Series))
+	assertEqualsInt(t, "Number of times", 1, len(measurements.Hosts[1].Times))
+
+	// Tags are set on all hosts
+	var tag Tag
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "PUT", baseURL+"/tags/start", "", &tag))
+	for _, agent := range []*HTTPServer{agent1, agent2} {
+		hasTag := false
+		for i := 0; i < 100 && !hasTag; i++ {
+			time.Sleep(10 * time.Millisecond) // Set in the background
+			agent.tagsMutex.Lock()
+			_, hasTag = agent.tags["start"]
+			agent.tagsMutex.Unlock()
+		}
+		assertTrue(t, "Tag set on agent", hasTag)
+	}
+	url = baseURL + "/aggregate/minmaxmem?fromTag=start&host=agent1&host=agent2"
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", url, "", &minMaxPage))
+	assertEqualsInt(t, "Number of errors", 0, len(minMaxPage.Errors))
+
+	// Hosts are listed on the index page
+	resp, err := http.Get("http://localhost:9096/")
+	if err != nil {
+		t.Fatal("Unable to get index page. Reason: ", err)
+	}
+	index := respToString(resp.Body)
+	for _, host := range []string{"agent1", "agent2", "down"} {
+		assertTrue(t, fmt.Sprintf("Host %s on index page", host), strings.Contains(index, host))
+	}
+}
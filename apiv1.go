@@ -0,0 +1,702 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/midstar/plm/monitor"
+)
+
+// APIv1Prefix is the path prefix of version 1 of the REST API. The
+// resources are described by the OpenAPI document at
+// /api/v1/openapi.json.
+const APIv1Prefix = "/api/v1/"
+
+// Error codes returned in APIError
+const (
+	ErrorCodeInvalidParameter = "invalid_parameter"
+	ErrorCodeInvalidBody      = "invalid_body"
+	ErrorCodeNotFound         = "not_found"
+	ErrorCodeMethodNotAllowed = "method_not_allowed"
+	ErrorCodeUnauthorized     = "unauthorized"
+	ErrorCodeForbidden        = "forbidden"
+	ErrorCodeConflict         = "conflict"
+	ErrorCodeInternal         = "internal_error"
+)
+
+// DefaultPageLimit is the number of items returned in a Page if no limit
+// is given
+const DefaultPageLimit = 100
+
+// MaxPageLimit is the highest number of items returned in a Page
+const MaxPageLimit = 1000
+
+// APIError is the body of all error responses in the REST API
+type APIError struct {
+	Error APIErrorDetails
+}
+
+// APIErrorDetails describes an error
+type APIErrorDetails struct {
+	Code    string // One of the ErrorCode constants
+	Message string // Human readable message
+}
+
+// Page is a part of a list of resources
+type Page struct {
+	Items  interface{} // The resources in this page
+	Total  int         // Total number of resources in the list
+	Offset int         // Index of the first resource in this page
+	Limit  int         // Maximum number of resources in a page
+}
+
+// Series is the measured memory of one process
+type Series struct {
+	UID    int
+	Values []uint32 // One value per time in Measurements.Times, of Measurements.Metric (KB for memory)
+	Min    []uint32 `json:",omitempty"` // Lowest value of each interval. Only set if downsampled
+	Max    []uint32 `json:",omitempty"` // Highest value of each interval. Only set if downsampled
+}
+
+// Measurements are the measured values of a set of processes
+type Measurements struct {
+	Metric    string // The measured metric, such as monitor.MetricMemory
+	Times     []time.Time
+	Series    []Series // Sorted on UID
+	Untracked []uint32 // Memory used by the processes not tracked (see includeProcesses)
+	// True if the measurements were downsampled to the points parameter. The
+	// values are then the mean of each interval, and Times the middle of it.
+	Downsampled bool
+}
+
+// Tag is a named time stamp
+type Tag struct {
+	Name string
+	Time time.Time
+}
+
+// Event types
+const (
+	EventStarted = "started"
+	EventDied    = "died"
+)
+
+// Event is a process life cycle event
+type Event struct {
+	Time time.Time
+	Type string // EventStarted or EventDied
+	UID  int
+	Pid  uint32
+	Name string
+	User string       // User running the process
+	Exit monitor.Exit // Why the process died, if known. Only for EventDied
+}
+
+// httpError is an error with a HTTP status code and an API error code
+type httpError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *httpError) Error() string {
+	return e.message
+}
+
+func newHTTPError(status int, code string, format string, a ...interface{}) *httpError {
+	return &httpError{status: status, code: code, message: fmt.Sprintf(format, a...)}
+}
+
+// writeError writes an error response. Requests to the REST API get an
+// APIError body, other requests a plain text body.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code string, message string) {
+	if !strings.HasPrefix(r.URL.Path, APIv1Prefix) {
+		http.Error(w, message, status)
+		return
+	}
+	js, _ := json.Marshal(APIError{Error: APIErrorDetails{Code: code, Message: message}})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, ErrorCodeInternal, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+}
+
+// parsePage parses the offset and limit query parameters
+func parsePage(values url.Values) (int, int, error) {
+	offset := 0
+	limit := DefaultPageLimit
+	var err error
+	if v := values.Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("Invalid parameter offset %s", v)
+		}
+	}
+	if v := values.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > MaxPageLimit {
+			return 0, 0, fmt.Errorf("Invalid parameter limit %s. Shall be between 1 and %d", v, MaxPageLimit)
+		}
+	}
+	return offset, limit, nil
+}
+
+// newPage creates a Page of a list with total items. sliceItems returns
+// the items between start (inclusive) and end (exclusive).
+func newPage(total int, offset int, limit int, sliceItems func(start, end int) interface{}) Page {
+	start := offset
+	if start > total {
+		start = total
+	}
+	end := start + limit
+	if end > total {
+		end = total
+	}
+	return Page{Items: sliceItems(start, end), Total: total, Offset: offset, Limit: limit}
+}
+
+// serveAPIv1 handles all requests to the REST API
+func (s *HTTPServer) serveAPIv1(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, APIv1Prefix), "/"), "/")
+	resource := segments[0]
+	id := ""
+	if len(segments) > 1 {
+		id = segments[1]
+	}
+	values := r.URL.Query()
+	if resource == "runs" && len(segments) <= 3 {
+		action := ""
+		if len(segments) == 3 {
+			action = segments[2]
+		}
+		s.serveAPIRuns(w, r, id, action, values)
+		return
+	}
+	if resource == "snapshot" && len(segments) <= 2 {
+		s.serveAPISnapshot(w, r, id, values)
+		return
+	}
+	if resource == "watch" && len(segments) <= 2 {
+		s.serveAPIWatch(w, r, id, values)
+		return
+	}
+	if resource == "processes" && len(segments) == 3 && segments[2] == "exit" {
+		s.serveAPIProcessExit(w, r, id)
+		return
+	}
+	if resource == "cgroups" && len(segments) <= 2 {
+		s.serveAPICgroups(w, r, id, values)
+		return
+	}
+	if len(segments) > 2 {
+		writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, fmt.Sprintf("No such resource %s", r.URL.Path))
+		return
+	}
+
+	allowed := "GET"
+	switch {
+	case r.Method == http.MethodGet && resource == "processes" && id == "":
+		s.serveAPIProcesses(w, r, values)
+	case r.Method == http.MethodGet && resource == "processes":
+		s.serveAPIProcess(w, r, id)
+	case r.Method == http.MethodGet && resource == "measurements" && id == "":
+		s.serveAPIMeasurements(w, r, values)
+	case r.Method == http.MethodGet && resource == "minmaxmem" && id == "":
+		s.serveAPIMinMaxMem(w, r, values)
+	case r.Method == http.MethodGet && resource == "stats" && id == "":
+		s.serveAPIStats(w, r, values)
+	case r.Method == http.MethodGet && resource == "io" && id == "":
+		s.serveAPIIO(w, r, values)
+	case r.Method == http.MethodGet && resource == "events" && id == "":
+		s.serveAPIEvents(w, r, values)
+	case r.Method == http.MethodGet && resource == "ram" && id == "":
+		s.measurement.Mutex.Lock()
+		phys := *s.measurement.PM.Phys
+		s.measurement.Mutex.Unlock()
+		writeJSON(w, r, http.StatusOK, phys)
+	case r.Method == http.MethodGet && resource == "ram" && id == "measurements":
+		from, to, err := s.getFromTo(values)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+			return
+		}
+		points, err := getPoints(values)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+			return
+		}
+		sm := s.measurement.GetSystemMeasurementsBetween(from, to) // Thread safe
+		sm.Downsample(points)
+		writeJSON(w, r, http.StatusOK, sm)
+	case r.Method == http.MethodGet && resource == "tags" && id == "":
+		s.serveAPITags(w, r, values)
+	case r.Method == http.MethodGet && resource == "tags":
+		s.tagsMutex.Lock()
+		t, hasTag := s.tags[id]
+		s.tagsMutex.Unlock()
+		if !hasTag {
+			writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, fmt.Sprintf("Tag %s not found", id))
+			return
+		}
+		writeJSON(w, r, http.StatusOK, Tag{Name: id, Time: t})
+	case (r.Method == http.MethodPut || r.Method == http.MethodPost) && resource == "tags" && id != "":
+		writeJSON(w, r, http.StatusOK, Tag{Name: id, Time: s.setTag(id)})
+	case r.Method == http.MethodGet && resource == "config" && id == "":
+		s.configMutex.Lock()
+		config := s.config.Clone()
+		s.configMutex.Unlock()
+		writeJSON(w, r, http.StatusOK, config)
+	case r.Method == http.MethodPut && resource == "config" && id == "":
+		config, err := s.putConfig(r.Body)
+		if err != nil {
+			e := err.(*httpError)
+			writeError(w, r, e.status, e.code, e.message)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, config)
+	case r.Method == http.MethodGet && resource == "version" && id == "":
+		writeJSON(w, r, http.StatusOK, s.ver)
+	case r.Method == http.MethodGet && resource == "compare" && id == "":
+		s.serveAPICompare(w, r, values)
+	case r.Method == http.MethodGet && resource == "hosts" && id == "":
+		writeJSON(w, r, http.StatusOK, s.aggregator.Statuses())
+	case r.Method == http.MethodGet && resource == "aggregate" && id != "":
+		s.serveAPIAggregate(w, r, id, values)
+	case r.Method == http.MethodPost && resource == "push" && id == "":
+		s.serveAPIPush(w, r)
+	case r.Method == http.MethodGet && resource == "openapi.json" && id == "":
+		s.serveAPIOpenAPI(w, r)
+	default:
+		switch {
+		case resource == "tags" && id != "":
+			allowed = "GET, PUT, POST"
+		case resource == "config" && id == "":
+			allowed = "GET, PUT"
+		case resource == "push":
+			allowed = "POST"
+		}
+		if !isAPIResource(resource) {
+			writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, fmt.Sprintf("No such resource %s", r.URL.Path))
+			return
+		}
+		w.Header().Set("Allow", allowed)
+		writeError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed,
+			fmt.Sprintf("Method %s not allowed on %s", r.Method, r.URL.Path))
+	}
+}
+
+// isAPIResource returns true if resource is a valid REST API resource
+func isAPIResource(resource string) bool {
+	switch resource {
+	case "processes", "measurements", "minmaxmem", "stats", "io", "events", "ram", "tags", "config", "version",
+		"hosts", "aggregate", "push", "runs", "compare", "snapshot", "watch", "cgroups", "openapi.json":
+		return true
+	}
+	return false
+}
+
+// getQueryUIDsAndTime parses the process selection and time query
+// parameters (see getUIDs and getFromTo).
+func (s *HTTPServer) getQueryUIDsAndTime(values url.Values) ([]int, time.Time, time.Time, error) {
+	uids, err := s.getUIDs(values)
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, err
+	}
+	from, to, err := s.getFromTo(values)
+	return uids, from, to, err
+}
+
+// getProcesses returns copies of the provided processes, sorted on UID.
+// UIDs that don't exist are ignored.
+func (s *HTTPServer) getProcesses(uids []int) []monitor.Process {
+	s.measurement.Mutex.Lock()
+	processes := make([]monitor.Process, 0, len(uids))
+	for _, uid := range uids {
+		if process, hasElement := s.measurement.PM.All[uid]; hasElement {
+			processes = append(processes, *process)
+		}
+	}
+	s.measurement.Mutex.Unlock()
+	sort.Slice(processes, func(i, j int) bool { return processes[i].UID < processes[j].UID })
+	return processes
+}
+
+func (s *HTTPServer) serveAPIProcesses(w http.ResponseWriter, r *http.Request, values url.Values) {
+	uids, err := s.getUIDs(values)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+		return
+	}
+	offset, limit, err := parsePage(values)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+		return
+	}
+	processes, err := s.filterProcesses(s.getProcesses(uids), values)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+		return
+	}
+	if err = sortProcesses(processes, values.Get("sort")); err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+		return
+	}
+	writeJSON(w, r, http.StatusOK, newPage(len(processes), offset, limit,
+		func(start, end int) interface{} { return processes[start:end] }))
+}
+
+// filterProcesses keeps the processes matching the alive parameter (true
+// or false) and, if a period is given, the processes that were alive some
+// time during the period.
+func (s *HTTPServer) filterProcesses(processes []monitor.Process, values url.Values) ([]monitor.Process, error) {
+	alive := values.Get("alive")
+	if alive != "" && alive != "true" && alive != "false" {
+		return nil, fmt.Errorf("Invalid parameter alive %s. Shall be true or false", alive)
+	}
+	from, to, err := s.getFromTo(values)
+	if err != nil {
+		return nil, err
+	}
+	filtered := processes[:0]
+	for _, process := range processes {
+		if alive != "" && process.IsAlive != (alive == "true") {
+			continue
+		}
+		if (!from.IsZero() || !to.IsZero()) && !isObserved(&process, from, to) {
+			continue
+		}
+		filtered = append(filtered, process)
+	}
+	return filtered, nil
+}
+
+// processLess compares two processes on a field. Processes that are equal
+// on the field are sorted on UID.
+var processLess = map[string]func(a, b *monitor.Process) bool{
+	"uid":        func(a, b *monitor.Process) bool { return a.UID < b.UID },
+	"pid":        func(a, b *monitor.Process) bool { return a.Pid < b.Pid },
+	"name":       func(a, b *monitor.Process) bool { return a.Name < b.Name },
+	"user":       func(a, b *monitor.Process) bool { return a.User < b.User },
+	"lastMemory": func(a, b *monitor.Process) bool { return a.LastMemory < b.LastMemory },
+	"maxMemory":  func(a, b *monitor.Process) bool { return a.MaxMemoryEver < b.MaxMemoryEver },
+	"minMemory":  func(a, b *monitor.Process) bool { return a.MinMemoryEver < b.MinMemoryEver },
+	"created":    func(a, b *monitor.Process) bool { return a.Created.Before(b.Created) },
+	"died":       func(a, b *monitor.Process) bool { return a.Died.Before(b.Died) },
+}
+
+// sortProcesses sorts processes on the field given by the sort parameter,
+// for example maxMemory. A leading - sorts in descending order. Empty sorts
+// on UID.
+func sortProcesses(processes []monitor.Process, field string) error {
+	descending := strings.HasPrefix(field, "-")
+	field = strings.TrimPrefix(field, "-")
+	if field == "" {
+		field = "uid"
+	}
+	less, hasField := processLess[field]
+	if !hasField {
+		return fmt.Errorf("Invalid parameter sort %s", field)
+	}
+	sort.SliceStable(processes, func(i, j int) bool {
+		a, b := &processes[i], &processes[j]
+		if descending {
+			a, b = b, a
+		}
+		return less(a, b)
+	})
+	return nil
+}
+
+func (s *HTTPServer) serveAPIProcess(w http.ResponseWriter, r *http.Request, id string) {
+	uid, err := strconv.Atoi(id)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, fmt.Sprintf("UID %s is not a valid integer", id))
+		return
+	}
+	s.measurement.Mutex.Lock()
+	process, hasElement := s.measurement.PM.All[uid]
+	var p monitor.Process
+	if hasElement {
+		p = *process
+	}
+	s.measurement.Mutex.Unlock()
+	if !hasElement {
+		writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, fmt.Sprintf("Process with UID %d not found", uid))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, p)
+}
+
+// serveAPIProcessExit handles PUT processes/<uid>/exit, which sets why the
+// process died, for example by plmc exec that knows the exit code of the
+// command. The body is a monitor.Exit.
+func (s *HTTPServer) serveAPIProcessExit(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPut {
+		w.Header().Set("Allow", "PUT")
+		writeError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed,
+			fmt.Sprintf("Method %s not allowed on %s", r.Method, r.URL.Path))
+		return
+	}
+	uid, err := strconv.Atoi(id)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, fmt.Sprintf("UID %s is not a valid integer", id))
+		return
+	}
+	var exit monitor.Exit
+	if err = json.NewDecoder(r.Body).Decode(&exit); err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, fmt.Sprintf("Invalid exit: %s", err))
+		return
+	}
+	switch exit.Reason {
+	case monitor.ExitNormal, monitor.ExitFailed, monitor.ExitSignaled, monitor.ExitOOMKilled:
+	default:
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, fmt.Sprintf("Invalid exit reason %q", exit.Reason))
+		return
+	}
+	s.measurement.Mutex.Lock()
+	hasElement := s.measurement.PM.SetExit(uid, exit)
+	var p monitor.Process
+	if hasElement {
+		p = *s.measurement.PM.All[uid]
+	}
+	s.measurement.Mutex.Unlock()
+	if !hasElement {
+		writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, fmt.Sprintf("Process with UID %d not found", uid))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, p)
+}
+
+func (s *HTTPServer) serveAPIMeasurements(w http.ResponseWriter, r *http.Request, values url.Values) {
+	uids, from, to, err := s.getQueryUIDsAndTime(values)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+		return
+	}
+	metric, err := getMetric(values)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+		return
+	}
+	points, err := getPoints(values)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+		return
+	}
+	measurements := s.getMeasurements(uids, metric, from, to)
+	measurements.downsample(points)
+	writeJSON(w, r, http.StatusOK, measurements)
+}
+
+// getPoints returns the points query parameter, which is the highest number
+// of values to return of each series. Default is 0, which means all values.
+func getPoints(values url.Values) (int, error) {
+	v := values.Get("points")
+	if v == "" {
+		return 0, nil
+	}
+	points, err := strconv.Atoi(v)
+	if err != nil || points < 1 {
+		return 0, fmt.Errorf("Invalid parameter points %s. Shall be a positive integer", v)
+	}
+	return points, nil
+}
+
+// downsample reduces the measurements to at most points values, using the
+// mean of each interval. The lowest and the highest value of each interval
+// are set in Min and Max. Values of processes that are not alive (0) are
+// not included.
+func (m *Measurements) downsample(points int) {
+	if points == 0 || len(m.Times) <= points {
+		return
+	}
+	for i := range m.Series {
+		series := &m.Series[i]
+		series.Values, series.Min, series.Max = monitor.Downsample(series.Values, points, true)
+	}
+	m.Untracked, _, _ = monitor.Downsample(m.Untracked, points, false)
+	m.Times = monitor.DownsampleTimes(m.Times, points)
+	m.Downsampled = true
+}
+
+// getMetric returns the metric query parameter. Default is memory.
+func getMetric(values url.Values) (string, error) {
+	metric := values.Get("metric")
+	if metric == "" {
+		return monitor.MetricMemory, nil
+	}
+	return metric, monitor.CheckMetric(metric)
+}
+
+// getMeasurements returns the measurements of a metric of the provided
+// processes between from and to.
+func (s *HTTPServer) getMeasurements(uids []int, metric string, from time.Time, to time.Time) Measurements {
+	pm := s.measurement.GetProcessMetricBetween(uids, metric, from, to) // Thread safe
+	result := Measurements{Metric: metric, Times: pm.Times, Series: make([]Series, 0, len(pm.Memory)), Untracked: pm.Untracked}
+	for uid, memory := range pm.Memory {
+		result.Series = append(result.Series, Series{UID: uid, Values: memory})
+	}
+	sort.Slice(result.Series, func(i, j int) bool { return result.Series[i].UID < result.Series[j].UID })
+	return result
+}
+
+func (s *HTTPServer) serveAPIMinMaxMem(w http.ResponseWriter, r *http.Request, values url.Values) {
+	uids, from, to, err := s.getQueryUIDsAndTime(values)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+		return
+	}
+	offset, limit, err := parsePage(values)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+		return
+	}
+	result := s.measurement.GetMinMaxMem(uids, from, to)
+	writeJSON(w, r, http.StatusOK, newPage(len(result), offset, limit,
+		func(start, end int) interface{} { return result[start:end] }))
+}
+
+func (s *HTTPServer) serveAPIStats(w http.ResponseWriter, r *http.Request, values url.Values) {
+	uids, from, to, err := s.getQueryUIDsAndTime(values)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+		return
+	}
+	offset, limit, err := parsePage(values)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+		return
+	}
+	result := s.measurement.GetStats(uids, from, to) // Thread safe
+	writeJSON(w, r, http.StatusOK, newPage(len(result), offset, limit,
+		func(start, end int) interface{} { return result[start:end] }))
+}
+
+func (s *HTTPServer) serveAPIIO(w http.ResponseWriter, r *http.Request, values url.Values) {
+	uids, from, to, err := s.getQueryUIDsAndTime(values)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+		return
+	}
+	offset, limit, err := parsePage(values)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+		return
+	}
+	result := s.measurement.GetProcessIOBetween(uids, from, to) // Thread safe
+	writeJSON(w, r, http.StatusOK, newPage(len(result), offset, limit,
+		func(start, end int) interface{} { return result[start:end] }))
+}
+
+// getEvents returns the life cycle events of the provided processes
+// between from and to (zero values means no restriction), sorted on time.
+func (s *HTTPServer) getEvents(uids []int, from time.Time, to time.Time) []Event {
+	inPeriod := func(t time.Time) bool {
+		return (from.IsZero() || !t.Before(from)) && (to.IsZero() || !t.After(to))
+	}
+	s.measurement.Mutex.Lock()
+	events := make([]Event, 0, len(uids))
+	for _, uid := range uids {
+		process, hasElement := s.measurement.PM.All[uid]
+		if !hasElement {
+			continue
+		}
+		if inPeriod(process.Created) {
+			events = append(events, Event{Time: process.Created, Type: EventStarted,
+				UID: uid, Pid: process.Pid, Name: process.Name, User: process.User})
+		}
+		if !process.IsAlive && inPeriod(process.Died) {
+			events = append(events, Event{Time: process.Died, Type: EventDied,
+				UID: uid, Pid: process.Pid, Name: process.Name, User: process.User, Exit: process.Exit})
+		}
+	}
+	s.measurement.Mutex.Unlock()
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Time.Equal(events[j].Time) {
+			return events[i].UID < events[j].UID
+		}
+		return events[i].Time.Before(events[j].Time)
+	})
+	return events
+}
+
+func (s *HTTPServer) serveAPIEvents(w http.ResponseWriter, r *http.Request, values url.Values) {
+	uids, from, to, err := s.getQueryUIDsAndTime(values)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+		return
+	}
+	offset, limit, err := parsePage(values)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+		return
+	}
+	events := s.getEvents(uids, from, to)
+	writeJSON(w, r, http.StatusOK, newPage(len(events), offset, limit,
+		func(start, end int) interface{} { return events[start:end] }))
+}
+
+func (s *HTTPServer) serveAPITags(w http.ResponseWriter, r *http.Request, values url.Values) {
+	offset, limit, err := parsePage(values)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+		return
+	}
+	s.tagsMutex.Lock()
+	tags := make([]Tag, 0, len(s.tags))
+	for name, t := range s.tags {
+		tags = append(tags, Tag{Name: name, Time: t})
+	}
+	s.tagsMutex.Unlock()
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Time.Before(tags[j].Time) })
+	writeJSON(w, r, http.StatusOK, newPage(len(tags), offset, limit,
+		func(start, end int) interface{} { return tags[start:end] }))
+}
+
+func (s *HTTPServer) serveAPIPush(w http.ResponseWriter, r *http.Request) {
+	if s.collector == nil {
+		writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, "This PLM instance does not accept pushed measurements")
+		return
+	}
+	var batches []*PushBatch
+	err := json.NewDecoder(r.Body).Decode(&batches)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidBody, fmt.Sprintf("Invalid measurements. Reason: %s", err))
+		return
+	}
+	err = s.collector.Push(batches)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidBody, err.Error())
+		return
+	}
+	writeJSON(w, r, http.StatusOK, struct{ Received int }{len(batches)})
+}
+
+func (s *HTTPServer) serveAPIOpenAPI(w http.ResponseWriter, r *http.Request) {
+	b, err := ioutil.ReadFile(filepath.Join(s.basePath, "templates", "openapi.json"))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, ErrorCodeInternal, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/midstar/plm/monitor"
+	"github.com/midstar/proci"
+)
+
+// apiRequest sends a request to the REST API and decodes the JSON response
+// into v (if not nil). Returns the status code.
+func apiRequest(t *testing.T, method string, url string, body string, v interface{}) int {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal("Unable to create request. Reason: ", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("Unable to send request. Reason: ", err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		err = json.NewDecoder(resp.Body).Decode(v)
+		if err != nil {
+			t.Fatal("Unable to decode response from ", url, ". Reason: ", err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestAPIv1(t *testing.T) {
+	port := 9093
+	baseURL := fmt.Sprintf("http://localhost:%d/api/v1", port)
+	config := DefaultConfiguration()
+	config.Port = port
+	pMock := proci.GenerateMock(10)
+	m := monitor.CreateMeasurement(3, 6, 3, 6, pMock)
+	m.MeasureAndLog(false)
+	delete(pMock.Processes, 4)
+	time.Sleep(10 * time.Millisecond) // To make time differ
+	m.MeasureAndLog(true)
+	httpServer := CreateHTTPServer("", config, m)
+	httpServer.Start()
+	defer httpServer.Stop()
+	time.Sleep(100 * time.Millisecond) // Allow server to start
+
+	// Processes with pagination
+	var page struct {
+		Items  []monitor.Process
+		Total  int
+		Offset int
+		Limit  int
+	}
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/processes?offset=2&limit=3", "", &page))
+	assertEqualsInt(t, "Total", 10, page.Total)
+	assertEqualsInt(t, "Number of items", 3, len(page.Items))
+	assertEqualsInt(t, "First UID in page", 3, page.Items[0].UID)
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/processes?offset=20", "", &page))
+	assertEqualsInt(t, "Number of items after end", 0, len(page.Items))
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/processes?match=path_8", "", &page))
+	assertEqualsInt(t, "Number of matched items", 1, len(page.Items))
+
+	// Processes filtered on state and period, and sorted
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/processes?alive=false", "", &page))
+	assertEqualsInt(t, "Dead processes", 1, page.Total)
+	assertEqualsInt(t, "Dead PID", 4, int(page.Items[0].Pid))
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/processes?alive=true", "", &page))
+	assertEqualsInt(t, "Alive processes", 9, page.Total)
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/processes?from=%2B1h", "", &page))
+	assertEqualsInt(t, "Processes observed in the future", 9, page.Total)
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/processes?sort=-maxMemory&limit=2", "", &page))
+	assertEqualsInt(t, "PID with highest max memory", 10, int(page.Items[0].Pid))
+	assertEqualsInt(t, "PID with second highest max memory", 9, int(page.Items[1].Pid))
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/processes?sort=name", "", &page))
+	for i := 1; i < len(page.Items); i++ {
+		assertTrue(t, "Sorted on name", page.Items[i-1].Name <= page.Items[i].Name)
+	}
+
+	// Processes with PID
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/processes?pid=3&descendants=true", "", &page))
+	assertEqualsInt(t, "Total", 1, page.Total)
+	assertEqualsInt(t, "PID", 3, int(page.Items[0].Pid))
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/processes?pid=1234", "", &page))
+	assertEqualsInt(t, "Total", 0, page.Total)
+
+	// Errors
+	var apiError APIError
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "GET", baseURL+"/processes?pid=x", "", &apiError))
+	assertEqualsStr(t, "Error code", ErrorCodeInvalidParameter, apiError.Error.Code)
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "GET", baseURL+"/processes?limit=0", "", &apiError))
+	assertEqualsStr(t, "Error code", ErrorCodeInvalidParameter, apiError.Error.Code)
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "GET", baseURL+"/processes?uids=invalid", "", &apiError))
+	assertEqualsStr(t, "Error code", ErrorCodeInvalidParameter, apiError.Error.Code)
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "GET", baseURL+"/processes?alive=maybe", "", &apiError))
+	assertEqualsStr(t, "Error code", ErrorCodeInvalidParameter, apiError.Error.Code)
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "GET", baseURL+"/processes?sort=size", "", &apiError))
+	assertEqualsStr(t, "Error code", ErrorCodeInvalidParameter, apiError.Error.Code)
+	assertEqualsInt(t, "Status", http.StatusNotFound, apiRequest(t, "GET", baseURL+"/processes/1234", "", &apiError))
+	assertEqualsStr(t, "Error code", ErrorCodeNotFound, apiError.Error.Code)
+	assertEqualsInt(t, "Status", http.StatusNotFound, apiRequest(t, "GET", baseURL+"/invalid", "", &apiError))
+	assertEqualsStr(t, "Error code", ErrorCodeNotFound, apiError.Error.Code)
+	apiError = APIError{}
+	assertEqualsInt(t, "Status", http.StatusNotFound, apiRequest(t, "GET", baseURL, "", &apiError))
+	assertEqualsStr(t, "Error code without trailing slash", ErrorCodeNotFound, apiError.Error.Code)
+	assertEqualsInt(t, "Status", http.StatusMethodNotAllowed, apiRequest(t, "DELETE", baseURL+"/processes", "", &apiError))
+	assertEqualsStr(t, "Error code", ErrorCodeMethodNotAllowed, apiError.Error.Code)
+	assertEqualsInt(t, "Status", http.StatusNotFound, apiRequest(t, "POST", baseURL+"/push", "[]", &apiError))
+	assertEqualsStr(t, "Error code", ErrorCodeNotFound, apiError.Error.Code)
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "PUT", baseURL+"/config", "{", &apiError))
+	assertEqualsStr(t, "Error code", ErrorCodeInvalidBody, apiError.Error.Code)
+
+	// Single process
+	var process monitor.Process
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/processes/5", "", &process))
+	assertEqualsInt(t, "Process UID", 5, process.UID)
+	assertTrue(t, "Process path", strings.HasPrefix(process.Path, "path_"))
+
+	// Measurements
+	var measurements Measurements
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/measurements?uids=2,1", "", &measurements))
+	assertEqualsInt(t, "Number of times", 2, len(measurements.Times))
+	assertEqualsInt(t, "Number of series", 2, len(measurements.Series))
+	assertEqualsInt(t, "First series UID", 1, measurements.Series[0].UID)
+	assertEqualsInt(t, "First series length", 2, len(measurements.Series[0].Values))
+	assertEqualsStr(t, "Default metric", "memory", measurements.Metric)
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/measurements?uids=1&metric=fds", "", &measurements))
+	assertEqualsStr(t, "Metric", "fds", measurements.Metric)
+	assertEqualsInt(t, "FDs not measured by mock", 0, int(measurements.Series[0].Values[0]))
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "GET", baseURL+"/measurements?metric=cpu", "", &apiError))
+	assertEqualsStr(t, "Error code", ErrorCodeInvalidParameter, apiError.Error.Code)
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/measurements?uids=1&metric=writeBytes", "", &measurements))
+	assertEqualsStr(t, "I/O metric", "writeBytes", measurements.Metric)
+
+	// Downsampled measurements
+	var downsampled Measurements
+	uid := m.PM.Alive[5].UID
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", fmt.Sprintf("%s/measurements?uids=%d&points=1", baseURL, uid), "", &downsampled))
+	assertTrue(t, "Downsampled", downsampled.Downsampled)
+	assertEqualsInt(t, "Downsampled times", 1, len(downsampled.Times))
+	assertEqualsInt(t, "Mean", 6, int(downsampled.Series[0].Values[0]))
+	assertEqualsInt(t, "Min", 6, int(downsampled.Series[0].Min[0]))
+	assertEqualsInt(t, "Max", 6, int(downsampled.Series[0].Max[0]))
+	downsampled = Measurements{}
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", fmt.Sprintf("%s/measurements?uids=%d&points=2", baseURL, uid), "", &downsampled))
+	assertTrue(t, "Not downsampled", !downsampled.Downsampled && downsampled.Series[0].Min == nil)
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "GET", baseURL+"/measurements?points=0", "", &apiError))
+	assertEqualsStr(t, "Error code", ErrorCodeInvalidParameter, apiError.Error.Code)
+
+	// Statistics
+	var statsPage struct {
+		Items []monitor.ProcessStats
+		Total int
+	}
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/stats?uids=2,1", "", &statsPage))
+	assertEqualsInt(t, "Stats processes", 2, statsPage.Total)
+	assertEqualsInt(t, "First stats UID", 1, statsPage.Items[0].UID)
+	for _, item := range statsPage.Items {
+		expected := 2
+		if !item.IsAlive {
+			expected = 1 // Died before the second measurement
+		}
+		assertEqualsInt(t, "Stats count", expected, item.Stats.Count)
+	}
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "GET", baseURL+"/stats?from=invalid", "", &apiError))
+
+	// I/O in period
+	var ioPage struct {
+		Items []monitor.ProcessIOInPeriod
+		Total int
+	}
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/io?uids=2,1", "", &ioPage))
+	assertEqualsInt(t, "I/O processes", 2, ioPage.Total)
+	assertEqualsInt(t, "First I/O UID", 1, ioPage.Items[0].UID)
+	assertEqualsInt(t, "I/O not measured by mock", 0, int(ioPage.Items[0].IOInPeriod.WriteBytes))
+
+	// Min max memory
+	var minMaxPage struct {
+		Items []monitor.ProcessMinMaxMem
+		Total int
+	}
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/minmaxmem?match=path_3", "", &minMaxPage))
+	assertEqualsInt(t, "Total", 1, minMaxPage.Total)
+	assertEqualsInt(t, "Max memory", 4, int(minMaxPage.Items[0].MaxMemoryInPeriod))
+
+	// Events
+	var eventPage struct {
+		Items []Event
+		Total int
+	}
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/events", "", &eventPage))
+	assertEqualsInt(t, "Total", 11, eventPage.Total)
+	last := eventPage.Items[len(eventPage.Items)-1]
+	assertEqualsStr(t, "Last event type", EventDied, last.Type)
+	assertEqualsInt(t, "Last event PID", 4, int(last.Pid))
+
+	// Exit
+	exitURL := fmt.Sprintf("%s/processes/%d/exit", baseURL, last.UID)
+	var exited monitor.Process
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "PUT", exitURL, `{"Reason":"failed","Detail":"exit code 3"}`, &exited))
+	assertEqualsStr(t, "Exit reason", monitor.ExitFailed, exited.Exit.Reason)
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/events", "", &eventPage))
+	assertEqualsStr(t, "Event exit", "exit code 3", eventPage.Items[len(eventPage.Items)-1].Exit.Detail)
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "PUT", exitURL, `{"Reason":"unknown"}`, &apiError))
+	assertEqualsInt(t, "Status", http.StatusNotFound, apiRequest(t, "PUT", baseURL+"/processes/1234/exit", `{"Reason":"failed"}`, &apiError))
+	assertEqualsInt(t, "Status", http.StatusMethodNotAllowed, apiRequest(t, "GET", exitURL, "", &apiError))
+
+	// Tags
+	var tag Tag
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "PUT", baseURL+"/tags/start", "", &tag))
+	assertEqualsStr(t, "Tag name", "start", tag.Name)
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/tags/start", "", &tag))
+	var tagPage struct {
+		Items []Tag
+		Total int
+	}
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/tags", "", &tagPage))
+	assertEqualsInt(t, "Number of tags", 1, tagPage.Total)
+	assertEqualsInt(t, "Status", http.StatusNotFound, apiRequest(t, "GET", baseURL+"/tags/invalid", "", &apiError))
+
+	// Other resources
+	var phys monitor.PhysicalMemory
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/ram", "", &phys))
+	assertEqualsInt(t, "Total phys", 4*1024*1024, int(phys.TotalPhys))
+	var system monitor.SystemMeasurements
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/ram/measurements", "", &system))
+	assertEqualsInt(t, "System times", 2, len(system.Times))
+	assertEqualsInt(t, "System used", 2*1024*1024, int(system.Used[0]))
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/ram/measurements?points=1", "", &system))
+	assertEqualsInt(t, "Downsampled system times", 1, len(system.Times))
+	assertEqualsInt(t, "Downsampled system used", 2*1024*1024, int(system.Used[0]))
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "GET", baseURL+"/ram/measurements?points=x", "", &apiError))
+	var ver version
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/version", "", &ver))
+	var openAPI map[string]interface{}
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/openapi.json", "", &openAPI))
+	assertEqualsStr(t, "OpenAPI version", "3.0.3", openAPI["openapi"].(string))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// CgroupSeries is the memory of one cgroup over time
+type CgroupSeries struct {
+	Path   string
+	Memory []uint32 // KB, one value per time. 0 if not measured
+}
+
+// CgroupMeasurements is the memory of cgroups over time
+type CgroupMeasurements struct {
+	Times  []time.Time
+	Series []CgroupSeries // Sorted on path
+}
+
+// serveAPICgroups handles:
+//   - GET cgroups (cgroups with the memory during the period)
+//   - GET cgroups/measurements
+//
+// The cgroups are selected with the cgroup query parameter (part of the
+// path, all cgroups if omitted) and the period with the query parameters
+// of getFromTo.
+func (s *HTTPServer) serveAPICgroups(w http.ResponseWriter, r *http.Request, id string, values url.Values) {
+	if id != "" && id != "measurements" {
+		writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, fmt.Sprintf("No such resource %s", r.URL.Path))
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed,
+			fmt.Sprintf("Method %s not allowed on %s", r.Method, r.URL.Path))
+		return
+	}
+	from, to, err := s.getFromTo(values)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+		return
+	}
+	cgroups := s.measurement.GetCgroupMinMaxMem(values.Get("cgroup"), from, to) // Thread safe
+	if id == "measurements" {
+		paths := make([]string, 0, len(cgroups))
+		for _, cgroup := range cgroups {
+			paths = append(paths, cgroup.Path)
+		}
+		cm := s.measurement.GetCgroupMeasurementsBetween(paths, from, to) // Thread safe
+		result := CgroupMeasurements{Times: cm.Times, Series: make([]CgroupSeries, 0, len(cm.Memory))}
+		for path, memory := range cm.Memory {
+			result.Series = append(result.Series, CgroupSeries{Path: path, Memory: memory})
+		}
+		sort.Slice(result.Series, func(i, j int) bool { return result.Series[i].Path < result.Series[j].Path })
+		writeJSON(w, r, http.StatusOK, result)
+		return
+	}
+	offset, limit, err := parsePage(values)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+		return
+	}
+	writeJSON(w, r, http.StatusOK, newPage(len(cgroups), offset, limit,
+		func(start, end int) interface{} { return cgroups[start:end] }))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/midstar/plm/monitor"
+	"github.com/midstar/proci"
+)
+
+// cgroupMock is a mock where all processes belong to the cgroup /job
+type cgroupMock struct {
+	*proci.Mock
+}
+
+func (m cgroupMock) GetProcessOwner(pid uint32) (monitor.Owner, error) {
+	return monitor.Owner{Cgroup: "/job"}, nil
+}
+
+func TestCgroups(t *testing.T) {
+	root, err := ioutil.TempDir("", "plm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	os.Mkdir(filepath.Join(root, "job"), 0755)
+	setMemory := func(bytes string) {
+		if err := ioutil.WriteFile(filepath.Join(root, "job", "memory.current"), []byte(bytes), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	port := 9103
+	baseURL := fmt.Sprintf("http://localhost:%d/api/v1", port)
+	config := DefaultConfiguration()
+	config.Port = port
+	m := monitor.CreateMeasurement(10, 20, 3, 6, cgroupMock{proci.GenerateMock(3)})
+	m.PM.CgroupRoot = root
+	setMemory("2097152")
+	m.MeasureAndLog(false)
+	time.Sleep(time.Millisecond)
+	setMemory("1048576")
+	m.MeasureAndLog(false)
+	httpServer := CreateHTTPServer("", config, m)
+	httpServer.Start()
+	defer httpServer.Stop()
+	time.Sleep(100 * time.Millisecond) // Allow server to start
+
+	var page struct {
+		Items []monitor.CgroupMinMaxMem
+		Total int
+	}
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/cgroups?cgroup=job", "", &page))
+	assertEqualsInt(t, "Cgroups", 1, page.Total)
+	assertEqualsStr(t, "Path", "/job", page.Items[0].Path)
+	assertEqualsInt(t, "Processes", 3, len(page.Items[0].UIDs))
+	assertEqualsInt(t, "Max", 2048, int(page.Items[0].MaxMemoryInPeriod))
+	assertEqualsInt(t, "Last", 1024, int(page.Items[0].LastMemory))
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/cgroups?cgroup=other", "", &page))
+	assertEqualsInt(t, "No match", 0, page.Total)
+
+	var measurements CgroupMeasurements
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/cgroups/measurements", "", &measurements))
+	assertEqualsInt(t, "Times", 2, len(measurements.Times))
+	assertEqualsInt(t, "Second", 1024, int(measurements.Series[0].Memory[1]))
+
+	assertEqualsInt(t, "Status", http.StatusNotFound, apiRequest(t, "GET", baseURL+"/cgroups/other", "", nil))
+	assertEqualsInt(t, "Status", http.StatusMethodNotAllowed, apiRequest(t, "POST", baseURL+"/cgroups", "", nil))
+}
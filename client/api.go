@@ -0,0 +1,586 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/midstar/plm/monitor"
+)
+
+// Filter selects processes and a period. Zero values are not used. See
+// the REST API documentation for details of each query parameter.
+type Filter struct {
+	Match       []string  // Processes whose path, name or command line contain any of these
+	UIDs        []int     // Processes with these UIDs
+	Pid         uint32    // Process with this PID during the period
+	Descendants bool      // Include the descendants of the Pid process
+	From        time.Time // Start of the period
+	To          time.Time // End of the period
+	FromTag     string    // Start of the period given by a tag, or a time expression such as START+30s or -15m
+	ToTag       string    // End of the period given by a tag, or a time expression such as now
+	Run         string    // Period of a run, cannot be combined with From, To, FromTag or ToTag
+	Aggregate   bool      // Include the hosts of a PLM aggregator
+	Hosts       []string  // Hosts to include if Aggregate is set. All hosts if empty
+	Metric      string    // Metric of Measurements, such as monitor.MetricFDs. Memory if empty
+	Points      int       // Downsample Measurements and Plot to at most this number of values. All values if 0
+}
+
+// Values returns the filter as query parameters
+func (f Filter) Values() url.Values {
+	values := url.Values{}
+	for _, match := range f.Match {
+		values.Add("match", match)
+	}
+	if len(f.UIDs) > 0 {
+		uids := make([]string, 0, len(f.UIDs))
+		for _, uid := range f.UIDs {
+			uids = append(uids, strconv.Itoa(uid))
+		}
+		values.Set("uids", strings.Join(uids, ","))
+	}
+	if f.Pid != 0 {
+		values.Set("pid", strconv.FormatUint(uint64(f.Pid), 10))
+		if f.Descendants {
+			values.Set("descendants", "true")
+		}
+	}
+	if !f.From.IsZero() {
+		values.Set("from", f.From.Format(time.RFC3339Nano))
+	}
+	if !f.To.IsZero() {
+		values.Set("to", f.To.Format(time.RFC3339Nano))
+	}
+	if f.FromTag != "" {
+		values.Set("fromTag", f.FromTag)
+	}
+	if f.ToTag != "" {
+		values.Set("toTag", f.ToTag)
+	}
+	if f.Run != "" {
+		values.Set("run", f.Run)
+	}
+	if f.Metric != "" {
+		values.Set("metric", f.Metric)
+	}
+	if f.Points > 0 {
+		values.Set("points", strconv.Itoa(f.Points))
+	}
+	if f.Aggregate {
+		for _, host := range f.Hosts {
+			values.Add("host", host)
+		}
+	}
+	return values
+}
+
+// resource returns the resource, or the aggregated resource if Aggregate
+// is set
+func (f Filter) resource(resource string) string {
+	if f.Aggregate {
+		return "aggregate/" + resource
+	}
+	return resource
+}
+
+// Process is a process on the PLM server
+type Process struct {
+	Host string `json:",omitempty"` // Host of the process. Only set if Filter.Aggregate is used
+	monitor.Process
+}
+
+// ProcessMinMaxMem is a process with the highest and lowest memory
+// consumption during a period
+type ProcessMinMaxMem struct {
+	Host string `json:",omitempty"` // Host of the process. Only set if Filter.Aggregate is used
+	monitor.ProcessMinMaxMem
+}
+
+// Series is the measured memory (or other metric) of one process
+type Series struct {
+	UID    int
+	Values []uint32 // One value per time in Measurements.Times, of Measurements.Metric (KB for memory)
+	Min    []uint32 // Lowest value of each interval. Only set if downsampled
+	Max    []uint32 // Highest value of each interval. Only set if downsampled
+}
+
+// Measurements are the measured values of a set of processes
+type Measurements struct {
+	Metric    string // The measured metric, such as monitor.MetricMemory
+	Times     []time.Time
+	Series    []Series // Sorted on UID
+	Untracked []uint32 // Memory used by the processes not tracked by the server
+	// True if the measurements were downsampled to Filter.Points. The values
+	// are then the mean of each interval, and Times the middle of it.
+	Downsampled bool
+}
+
+// Tag is a named time stamp
+type Tag struct {
+	Name string
+	Time time.Time
+}
+
+// Configuration is the runtime configuration of the PLM server
+type Configuration struct {
+	Port          int
+	FastLogTimeMs int
+	SlowLogFactor int
+	FastLogSize   int
+	SlowLogSize   int
+}
+
+// Version is the version of the PLM server
+type Version struct {
+	Version   string
+	BuildTime string
+	GitHash   string
+}
+
+// Run is a named period, such as a test run, with labels
+type Run struct {
+	Name         string
+	Labels       map[string]string
+	Start        time.Time
+	End          time.Time // Zero while the run is in progress
+	Running      bool
+	NbrProcesses int          // Number of processes observed during the run
+	MaxPhys      uint32       // Highest total memory used during the run (KB)
+	Processes    []RunProcess `json:",omitempty"` // Sorted on max memory, highest first. Not included by ListRuns
+}
+
+// RunProcess is a process observed during a run
+type RunProcess struct {
+	UID         int
+	Pid         uint32
+	Path        string
+	Name        string
+	CommandLine string
+	User        string // User running the process
+	MaxMemory   uint32 // Maximum memory during the run (KB)
+	MinMemory   uint32 // Minimum memory during the run (KB)
+	AvgMemory   uint32 // Average memory during the run (KB)
+}
+
+// RunSeries is the total memory of the compared processes during a run,
+// or a period
+type RunSeries struct {
+	Run     string    `json:",omitempty"`
+	Offsets []float64 // Seconds since the start of the run
+	Memory  []uint32  // Total memory of the processes at each offset (KB)
+	Peak    uint32    // Highest memory (KB)
+	Avg     uint32    // Average memory (KB)
+	Growth  int64     // Last minus first memory (KB)
+}
+
+// Delta is the difference between the head and the base value of a
+// comparison
+type Delta struct {
+	Base     int64
+	Head     int64
+	Diff     int64   // Head minus base
+	Percent  float64 // Diff in percent of base
+	Exceeded bool    // Percent is above the tolerance
+}
+
+// Tolerance is the highest allowed increase, in percent, from base to head
+// of each delta. Negative values are not checked.
+type Tolerance struct {
+	Peak   float64
+	Avg    float64
+	Growth float64
+}
+
+// NoTolerance is a tolerance where nothing is checked
+var NoTolerance = Tolerance{Peak: -1, Avg: -1, Growth: -1}
+
+// addTo adds the tolerances to the query parameters
+func (t Tolerance) addTo(values url.Values) {
+	for name, value := range map[string]float64{"peakTolerance": t.Peak, "avgTolerance": t.Avg, "growthTolerance": t.Growth} {
+		if value >= 0 {
+			values.Set(name, strconv.FormatFloat(value, 'f', -1, 64))
+		}
+	}
+}
+
+// Comparison is the result of comparing the memory of processes in two
+// runs, or a snapshot with live data
+type Comparison struct {
+	Match      []string // Processes compared. All processes of the runs if empty
+	Base       RunSeries
+	Head       RunSeries
+	Peak       Delta
+	Avg        Delta
+	Growth     Delta // Percent is in relation to the base peak
+	Tolerance  Tolerance
+	Regression bool // Any of the deltas exceeds its tolerance
+}
+
+// Snapshot is the memory of a set of processes during a period. The
+// format is described in README.md.
+type Snapshot struct {
+	FormatVersion int
+	PLMVersion    string
+	Host          string
+	Created       time.Time
+	Match         []string
+	From          time.Time
+	To            time.Time
+	Series        RunSeries
+	Processes     []RunProcess
+}
+
+// ListProcesses returns the processes selected by the filter, sorted on
+// UID
+func (c *Client) ListProcesses(ctx context.Context, f Filter) ([]Process, error) {
+	processes := make([]Process, 0)
+	err := c.getAll(ctx, f.resource("processes"), f.Values(), func(items json.RawMessage) (int, error) {
+		var page []Process
+		err := json.Unmarshal(items, &page)
+		processes = append(processes, page...)
+		return len(page), err
+	})
+	return processes, err
+}
+
+// GetProcess returns the process with the provided UID
+func (c *Client) GetProcess(ctx context.Context, uid int) (*Process, error) {
+	var process Process
+	err := c.doJSON(ctx, http.MethodGet, "processes/"+strconv.Itoa(uid), nil, nil, &process)
+	if err != nil {
+		return nil, err
+	}
+	return &process, nil
+}
+
+// MinMax returns the highest and lowest memory of the processes selected
+// by the filter during the period of the filter
+func (c *Client) MinMax(ctx context.Context, f Filter) ([]ProcessMinMaxMem, error) {
+	processes := make([]ProcessMinMaxMem, 0)
+	err := c.getAll(ctx, f.resource("minmaxmem"), f.Values(), func(items json.RawMessage) (int, error) {
+		var page []ProcessMinMaxMem
+		err := json.Unmarshal(items, &page)
+		processes = append(processes, page...)
+		return len(page), err
+	})
+	return processes, err
+}
+
+// Stats returns statistical summaries of the memory of the processes
+// selected by the filter during the period. Filter.Aggregate is not
+// supported.
+func (c *Client) Stats(ctx context.Context, f Filter) ([]monitor.ProcessStats, error) {
+	processes := make([]monitor.ProcessStats, 0)
+	err := c.getAll(ctx, "stats", f.Values(), func(items json.RawMessage) (int, error) {
+		var page []monitor.ProcessStats
+		err := json.Unmarshal(items, &page)
+		processes = append(processes, page...)
+		return len(page), err
+	})
+	return processes, err
+}
+
+// IO returns the I/O done during the period by the processes selected by
+// the filter. Filter.Aggregate is not supported.
+func (c *Client) IO(ctx context.Context, f Filter) ([]monitor.ProcessIOInPeriod, error) {
+	processes := make([]monitor.ProcessIOInPeriod, 0)
+	err := c.getAll(ctx, "io", f.Values(), func(items json.RawMessage) (int, error) {
+		var page []monitor.ProcessIOInPeriod
+		err := json.Unmarshal(items, &page)
+		processes = append(processes, page...)
+		return len(page), err
+	})
+	return processes, err
+}
+
+// Measurements returns the memory, or the metric of Filter.Metric, of each
+// measurement of the processes selected by the filter. Filter.Aggregate is
+// not supported.
+func (c *Client) Measurements(ctx context.Context, f Filter) (*Measurements, error) {
+	var measurements Measurements
+	err := c.doJSON(ctx, http.MethodGet, "measurements", f.Values(), nil, &measurements)
+	if err != nil {
+		return nil, err
+	}
+	return &measurements, nil
+}
+
+// SetExit sets why the process with the provided UID died, for example
+// after running a command and waiting for its exit code
+func (c *Client) SetExit(ctx context.Context, uid int, exit monitor.Exit) (*Process, error) {
+	var process Process
+	err := c.doJSON(ctx, http.MethodPut, "processes/"+strconv.Itoa(uid)+"/exit", nil, exit, &process)
+	if err != nil {
+		return nil, err
+	}
+	return &process, nil
+}
+
+// RAMMeasurements returns the used physical memory and the breakdown of
+// the system memory, such as cached and swap, during the period of the
+// filter. The processes of the filter are not used.
+func (c *Client) RAMMeasurements(ctx context.Context, f Filter) (*monitor.SystemMeasurements, error) {
+	var measurements monitor.SystemMeasurements
+	values := Filter{From: f.From, To: f.To, FromTag: f.FromTag, ToTag: f.ToTag, Run: f.Run}.Values()
+	err := c.doJSON(ctx, http.MethodGet, "ram/measurements", values, nil, &measurements)
+	if err != nil {
+		return nil, err
+	}
+	return &measurements, nil
+}
+
+// Tags returns all tags, oldest first
+func (c *Client) Tags(ctx context.Context) ([]Tag, error) {
+	tags := make([]Tag, 0)
+	err := c.getAll(ctx, "tags", nil, func(items json.RawMessage) (int, error) {
+		var page []Tag
+		err := json.Unmarshal(items, &page)
+		tags = append(tags, page...)
+		return len(page), err
+	})
+	return tags, err
+}
+
+// GetTag returns the time of a tag. Use IsNotFound to check if the tag
+// has never been created.
+func (c *Client) GetTag(ctx context.Context, name string) (time.Time, error) {
+	var tag Tag
+	err := c.doJSON(ctx, http.MethodGet, "tags/"+url.PathEscape(name), nil, nil, &tag)
+	return tag.Time, err
+}
+
+// SetTag creates a tag, or moves it if it exists, and returns its time.
+// A PLM aggregator also sets the tag on its agents.
+func (c *Client) SetTag(ctx context.Context, name string) (time.Time, error) {
+	var tag Tag
+	err := c.doJSON(ctx, http.MethodPut, "tags/"+url.PathEscape(name), nil, nil, &tag)
+	return tag.Time, err
+}
+
+// Config returns the configuration of the PLM server
+func (c *Client) Config(ctx context.Context) (*Configuration, error) {
+	var config Configuration
+	err := c.doJSON(ctx, http.MethodGet, "config", nil, nil, &config)
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// SetConfig changes the configuration of the PLM server. settings are
+// keyed on the configuration property, for example fastLogTimeMs. Returns
+// the new configuration.
+func (c *Client) SetConfig(ctx context.Context, settings map[string]int) (*Configuration, error) {
+	var config Configuration
+	err := c.doJSON(ctx, http.MethodPut, "config", nil, settings, &config)
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Version returns the version of the PLM server
+func (c *Client) Version(ctx context.Context) (*Version, error) {
+	var version Version
+	err := c.doJSON(ctx, http.MethodGet, "version", nil, nil, &version)
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// StartRun starts a run
+func (c *Client) StartRun(ctx context.Context, name string, labels map[string]string) (*Run, error) {
+	return c.doRun(ctx, http.MethodPost, url.PathEscape(name)+"/start", struct{ Labels map[string]string }{labels})
+}
+
+// StopRun stops a run and returns its summary
+func (c *Client) StopRun(ctx context.Context, name string) (*Run, error) {
+	return c.doRun(ctx, http.MethodPost, url.PathEscape(name)+"/stop", nil)
+}
+
+// GetRun returns a run with its summary
+func (c *Client) GetRun(ctx context.Context, name string) (*Run, error) {
+	return c.doRun(ctx, http.MethodGet, url.PathEscape(name), nil)
+}
+
+func (c *Client) doRun(ctx context.Context, method string, path string, v interface{}) (*Run, error) {
+	var run Run
+	err := c.doJSON(ctx, method, "runs/"+path, nil, v, &run)
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// ListRuns returns all runs, oldest first. The processes of the runs are
+// not included (see GetRun).
+func (c *Client) ListRuns(ctx context.Context) ([]Run, error) {
+	runs := make([]Run, 0)
+	err := c.getAll(ctx, "runs", nil, func(items json.RawMessage) (int, error) {
+		var page []Run
+		err := json.Unmarshal(items, &page)
+		runs = append(runs, page...)
+		return len(page), err
+	})
+	return runs, err
+}
+
+// compareValues returns the query parameters of a comparison
+func compareValues(base string, head string, match []string, tolerance Tolerance) url.Values {
+	values := url.Values{"base": []string{base}, "head": []string{head}}
+	for _, m := range match {
+		values.Add("match", m)
+	}
+	tolerance.addTo(values)
+	return values
+}
+
+// Compare compares the memory of the processes matching match (all if
+// empty) in the base and head runs
+func (c *Client) Compare(ctx context.Context, base string, head string, match []string, tolerance Tolerance) (*Comparison, error) {
+	var comparison Comparison
+	err := c.doJSON(ctx, http.MethodGet, "compare", compareValues(base, head, match, tolerance), nil, &comparison)
+	if err != nil {
+		return nil, err
+	}
+	return &comparison, nil
+}
+
+// CompareReport returns the same comparison as Compare as a HTML report
+func (c *Client) CompareReport(ctx context.Context, base string, head string, match []string, tolerance Tolerance) ([]byte, error) {
+	return c.Do(ctx, http.MethodGet, "/compare?"+compareValues(base, head, match, tolerance).Encode(), nil)
+}
+
+// GetSnapshot returns a snapshot of the processes and the period selected
+// by the filter. Filter.Aggregate is not supported.
+func (c *Client) GetSnapshot(ctx context.Context, f Filter) (*Snapshot, error) {
+	var snapshot Snapshot
+	err := c.doJSON(ctx, http.MethodGet, "snapshot", f.Values(), nil, &snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// DiffSnapshot compares the snapshot (base) with the live data (head) of
+// the period selected by the filter. The processes are selected by
+// Filter.Match, or the matches of the snapshot if empty.
+func (c *Client) DiffSnapshot(ctx context.Context, snapshot *Snapshot, f Filter, tolerance Tolerance) (*Comparison, error) {
+	values := f.Values()
+	tolerance.addTo(values)
+	var comparison Comparison
+	err := c.doJSON(ctx, http.MethodPost, "snapshot/diff", values, snapshot, &comparison)
+	if err != nil {
+		return nil, err
+	}
+	return &comparison, nil
+}
+
+// Plot returns a HTML page with a plot of the processes and the period
+// selected by the filter. The memory is plotted unless Filter.Metric is set
+func (c *Client) Plot(ctx context.Context, f Filter) ([]byte, error) {
+	path := "/plot"
+	if values := f.Values(); len(values) > 0 {
+		path += "?" + values.Encode()
+	}
+	return c.Do(ctx, http.MethodGet, path, nil)
+}
+
+// StartWatch starts sampling the processes selected by the filter every
+// interval during duration (zero for the defaults of the server). The
+// samples are included in the other resources, for example MinMax.
+// Processes selected by Filter.Match are watched even if started later.
+func (c *Client) StartWatch(ctx context.Context, f Filter, interval time.Duration, duration time.Duration) (*monitor.Watch, error) {
+	values := f.Values()
+	if interval > 0 {
+		values.Set("interval", interval.String())
+	}
+	if duration > 0 {
+		values.Set("duration", duration.String())
+	}
+	return c.doWatch(ctx, http.MethodPost, "watch", values)
+}
+
+// GetWatch returns a watch
+func (c *Client) GetWatch(ctx context.Context, id int) (*monitor.Watch, error) {
+	return c.doWatch(ctx, http.MethodGet, "watch/"+strconv.Itoa(id), nil)
+}
+
+// StopWatch stops a watch. The samples are kept.
+func (c *Client) StopWatch(ctx context.Context, id int) (*monitor.Watch, error) {
+	return c.doWatch(ctx, http.MethodDelete, "watch/"+strconv.Itoa(id), nil)
+}
+
+func (c *Client) doWatch(ctx context.Context, method string, resource string, values url.Values) (*monitor.Watch, error) {
+	var watch monitor.Watch
+	err := c.doJSON(ctx, method, resource, values, nil, &watch)
+	if err != nil {
+		return nil, err
+	}
+	return &watch, nil
+}
+
+// ListWatches returns all watches, including watches that have expired
+// but whose samples are still kept
+func (c *Client) ListWatches(ctx context.Context) ([]monitor.Watch, error) {
+	watches := make([]monitor.Watch, 0)
+	err := c.getAll(ctx, "watch", nil, func(items json.RawMessage) (int, error) {
+		var page []monitor.Watch
+		err := json.Unmarshal(items, &page)
+		watches = append(watches, page...)
+		return len(page), err
+	})
+	return watches, err
+}
+
+// CgroupSeries is the measured memory of one cgroup
+type CgroupSeries struct {
+	Path   string
+	Memory []uint32 // KB, one value per time. 0 if not measured
+}
+
+// CgroupMeasurements are the measured memory of cgroups
+type CgroupMeasurements struct {
+	Times  []time.Time
+	Series []CgroupSeries // Sorted on path
+}
+
+// cgroupValues returns the query parameters selecting the cgroups whose
+// path contain cgroup during the period of the filter
+func cgroupValues(f Filter, cgroup string) url.Values {
+	values := Filter{From: f.From, To: f.To, FromTag: f.FromTag, ToTag: f.ToTag, Run: f.Run}.Values()
+	if cgroup != "" {
+		values.Set("cgroup", cgroup)
+	}
+	return values
+}
+
+// Cgroups returns the cgroups (Linux) whose path contain cgroup, all
+// cgroups if empty, with the highest and lowest memory during the period of
+// the filter. The processes of the filter are not used.
+func (c *Client) Cgroups(ctx context.Context, f Filter, cgroup string) ([]monitor.CgroupMinMaxMem, error) {
+	cgroups := make([]monitor.CgroupMinMaxMem, 0)
+	err := c.getAll(ctx, "cgroups", cgroupValues(f, cgroup), func(items json.RawMessage) (int, error) {
+		var page []monitor.CgroupMinMaxMem
+		err := json.Unmarshal(items, &page)
+		cgroups = append(cgroups, page...)
+		return len(page), err
+	})
+	return cgroups, err
+}
+
+// CgroupMeasurements returns the memory of each measurement of the cgroups
+// whose path contain cgroup during the period of the filter
+func (c *Client) CgroupMeasurements(ctx context.Context, f Filter, cgroup string) (*CgroupMeasurements, error) {
+	var measurements CgroupMeasurements
+	err := c.doJSON(ctx, http.MethodGet, "cgroups/measurements", cgroupValues(f, cgroup), nil, &measurements)
+	if err != nil {
+		return nil, err
+	}
+	return &measurements, nil
+}
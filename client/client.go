@@ -0,0 +1,230 @@
+// Package client is a Go client of the PLM REST API (/api/v1). It is used
+// by the PLM Client (plmc) and can be used by other tools:
+//
+//	c := client.New("http://localhost:12124")
+//	processes, err := c.MinMax(ctx, client.Filter{Match: []string{"myapp"}, FromTag: "START"})
+//
+// All methods take a context, which can be used to cancel the request.
+// Failed GET requests are retried (see Client.Retries).
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultURL is the URL of a PLM server running on this host with the
+// default port
+const DefaultURL = "http://localhost:12124"
+
+// Client sends requests to a PLM server. Change the fields before the
+// first request.
+type Client struct {
+	URL        string        // URL of the PLM server, for example DefaultURL
+	Token      string        // Token for authentication. Not sent if empty
+	HTTPClient *http.Client  // Client used for all requests. Its timeout applies per attempt
+	Retries    int           // Number of retries of GET requests that failed with a connection error or 5xx status code
+	RetryDelay time.Duration // Time between retries
+}
+
+// New creates a client of the PLM server at url
+func New(url string) *Client {
+	return &Client{
+		URL:        strings.TrimSuffix(url, "/"),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		Retries:    2,
+		RetryDelay: 500 * time.Millisecond}
+}
+
+// SetTLS configures how the PLM server certificate is verified when HTTPS
+// is used. caCertFile is a PEM file with the certificate(s) to trust (the
+// system certificates are used if empty). If insecure is true the server
+// certificate is not verified at all.
+func (c *Client) SetTLS(caCertFile string, insecure bool) error {
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecure}
+	if caCertFile != "" {
+		pem, err := ioutil.ReadFile(caCertFile)
+		if err != nil {
+			return fmt.Errorf("Unable to read CA certificate. Reason: %s", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("No valid certificates found in %s", caCertFile)
+		}
+	}
+	// Keep the proxy settings and timeouts of the default transport
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	c.HTTPClient.Transport = transport
+	return nil
+}
+
+// Error is returned when the PLM server responds with an error status code
+type Error struct {
+	StatusCode int    // HTTP status code
+	Code       string // Error code of the REST API, for example not_found. Empty if not provided
+	Message    string // Message of the PLM server, or the response body
+}
+
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return e.Message
+	}
+	return fmt.Sprintf("Unexpected status code from plm server: %d\n%s", e.StatusCode, e.Message)
+}
+
+// IsNotFound returns true if err is an Error with status code 404
+func IsNotFound(err error) bool {
+	e, isError := err.(*Error)
+	return isError && e.StatusCode == http.StatusNotFound
+}
+
+// HostError is an error from one host of a PLM aggregator
+type HostError struct {
+	Host    string
+	Message string
+}
+
+// HostErrors is returned when one or more hosts of a PLM aggregator could
+// not provide their data
+type HostErrors []HostError
+
+func (e HostErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, hostError := range e {
+		messages = append(messages, fmt.Sprintf("%s: %s", hostError.Host, hostError.Message))
+	}
+	return fmt.Sprintf("Failed to get data from host(s):\n%s", strings.Join(messages, "\n"))
+}
+
+// Do sends a request to the PLM server and returns the response body.
+// path is the path including query parameters, for example
+// /api/v1/processes?match=myapp. An Error is returned if the status code
+// is not 2xx. Use Do for resources without a method in this package.
+func (c *Client) Do(ctx context.Context, method string, path string, body []byte) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		respBody, err := c.doOnce(ctx, method, path, body)
+		if err == nil || attempt >= c.Retries || !isRetryable(method, err) {
+			return respBody, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(c.RetryDelay):
+		}
+	}
+}
+
+// isRetryable returns true if a request that failed with err might succeed
+// if sent again. Only GET requests are retried, since a PUT sent twice
+// might for example set a tag at the time of the retry.
+func isRetryable(method string, err error) bool {
+	if method != http.MethodGet {
+		return false
+	}
+	if e, isError := err.(*Error); isError {
+		return e.StatusCode >= 500
+	}
+	return true
+}
+
+func (c *Client) doOnce(ctx context.Context, method string, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, c.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		e := &Error{StatusCode: resp.StatusCode, Message: string(respBody)}
+		var apiError struct {
+			Error struct {
+				Code    string
+				Message string
+			}
+		}
+		if json.Unmarshal(respBody, &apiError) == nil && apiError.Error.Message != "" {
+			e.Code, e.Message = apiError.Error.Code, apiError.Error.Message
+		}
+		return nil, e
+	}
+	return respBody, nil
+}
+
+// doJSON sends a request to a resource of the REST API with v as JSON body
+// (if not nil) and decodes the response into result (if not nil)
+func (c *Client) doJSON(ctx context.Context, method string, resource string, values url.Values, v interface{}, result interface{}) error {
+	var body []byte
+	if v != nil {
+		var err error
+		if body, err = json.Marshal(v); err != nil {
+			return err
+		}
+	}
+	path := "/api/v1/" + resource
+	if len(values) > 0 {
+		path += "?" + values.Encode()
+	}
+	respBody, err := c.Do(ctx, method, path, body)
+	if err != nil || result == nil {
+		return err
+	}
+	return json.Unmarshal(respBody, result)
+}
+
+// getAll gets all pages of a paginated resource. appendItems is called with
+// the items of each page and returns the number of items.
+func (c *Client) getAll(ctx context.Context, resource string, values url.Values, appendItems func(items json.RawMessage) (int, error)) error {
+	query := url.Values{}
+	for key, value := range values {
+		query[key] = value
+	}
+	query.Set("limit", "1000")
+	offset := 0
+	for {
+		query.Set("offset", strconv.Itoa(offset))
+		var page struct {
+			Items  json.RawMessage
+			Total  int
+			Errors HostErrors // Only aggregated resources
+		}
+		if err := c.doJSON(ctx, http.MethodGet, resource, query, nil, &page); err != nil {
+			return err
+		}
+		if len(page.Errors) > 0 {
+			return page.Errors
+		}
+		n, err := appendItems(page.Items)
+		if err != nil {
+			return err
+		}
+		offset += n
+		if n == 0 || offset >= page.Total {
+			return nil
+		}
+	}
+}
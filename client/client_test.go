@@ -0,0 +1,183 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime/debug"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/midstar/plm/monitor"
+)
+
+func assertTrue(t *testing.T, message string, check bool) {
+	if !check {
+		debug.PrintStack()
+		t.Fatal(message)
+	}
+}
+
+func assertEqualsInt(t *testing.T, message string, expected int, actual int) {
+	assertTrue(t, fmt.Sprintf("%s\nExpected: %d, Actual: %d", message, expected, actual), expected == actual)
+}
+
+func assertEqualsStr(t *testing.T, message string, expected string, actual string) {
+	assertTrue(t, fmt.Sprintf("%s\nExpected: %s, Actual: %s", message, expected, actual), expected == actual)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	js, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+}
+
+func TestFilterValues(t *testing.T) {
+	from := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	f := Filter{Match: []string{"a", "b"}, UIDs: []int{1, 2}, Pid: 12, Descendants: true, From: from,
+		FromTag: "A", Run: "R", Hosts: []string{"h1"}}
+	values := f.Values()
+	assertEqualsInt(t, "Matches", 2, len(values["match"]))
+	assertEqualsStr(t, "UIDs", "1,2", values.Get("uids"))
+	assertEqualsStr(t, "PID", "12", values.Get("pid"))
+	assertEqualsStr(t, "Descendants", "true", values.Get("descendants"))
+	assertEqualsStr(t, "From", "2020-01-02T03:04:05Z", values.Get("from"))
+	assertEqualsStr(t, "To", "", values.Get("to"))
+	assertEqualsStr(t, "From tag", "A", values.Get("fromTag"))
+	assertEqualsStr(t, "Run", "R", values.Get("run"))
+	assertEqualsStr(t, "No hosts without aggregate", "", values.Get("host"))
+	assertEqualsStr(t, "Resource", "processes", f.resource("processes"))
+
+	f.Aggregate = true
+	assertEqualsStr(t, "Hosts", "h1", f.Values().Get("host"))
+	assertEqualsStr(t, "Aggregated resource", "aggregate/processes", f.resource("processes"))
+	assertEqualsInt(t, "Empty", 0, len(Filter{}.Values()))
+}
+
+func TestClient(t *testing.T) {
+	unavailable := 0 // Number of requests to respond 503 to
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if unavailable > 0 {
+			unavailable--
+			http.Error(w, "Busy", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+				"Error": map[string]string{"Code": "unauthorized", "Message": "Token required"}})
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/processes":
+			// Two processes per page
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			items := make([]monitor.Process, 0)
+			for uid := offset + 1; uid <= 5 && uid <= offset+2; uid++ {
+				items = append(items, monitor.Process{UID: uid, Name: r.URL.Query().Get("match")})
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"Items": items, "Total": 5})
+		case "GET /api/v1/aggregate/minmaxmem":
+			writeJSON(w, http.StatusOK, map[string]interface{}{"Items": []interface{}{}, "Total": 0,
+				"Errors": []HostError{{Host: "h1", Message: "Unreachable"}}})
+		case "PUT /api/v1/tags/A":
+			writeJSON(w, http.StatusOK, Tag{Name: "A", Time: time.Now()})
+		case "POST /api/v1/runs/R/start":
+			var body struct{ Labels map[string]string }
+			json.NewDecoder(r.Body).Decode(&body)
+			writeJSON(w, http.StatusOK, Run{Name: "R", Labels: body.Labels, Running: true})
+		case "GET /plot":
+			w.Write([]byte("<html></html>"))
+		default:
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{
+				"Error": map[string]string{"Code": "not_found", "Message": "Not found " + r.URL.Path}})
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	c := New(server.URL + "/")
+	c.RetryDelay = time.Millisecond
+
+	// Errors of the REST API
+	_, err := c.ListProcesses(ctx, Filter{})
+	e, isError := err.(*Error)
+	assertTrue(t, "API error", isError)
+	assertEqualsInt(t, "Status", http.StatusUnauthorized, e.StatusCode)
+	assertEqualsStr(t, "Code", "unauthorized", e.Code)
+	assertEqualsStr(t, "Message", "Token required", err.Error())
+
+	// Paginated
+	c.Token = "secret"
+	processes, err := c.ListProcesses(ctx, Filter{Match: []string{"x"}})
+	assertTrue(t, "No error", err == nil)
+	assertEqualsInt(t, "Processes", 5, len(processes))
+	assertEqualsInt(t, "Last UID", 5, processes[4].UID)
+	assertEqualsStr(t, "Filter", "x", processes[4].Name)
+
+	_, err = c.GetTag(ctx, "B")
+	assertTrue(t, "Not found", IsNotFound(err))
+	_, err = c.MinMax(ctx, Filter{Aggregate: true})
+	_, isHostErrors := err.(HostErrors)
+	assertTrue(t, "Host errors", isHostErrors)
+
+	run, err := c.StartRun(ctx, "R", map[string]string{"k": "v"})
+	assertTrue(t, "No error", err == nil)
+	assertEqualsStr(t, "Label", "v", run.Labels["k"])
+	plot, err := c.Plot(ctx, Filter{})
+	assertTrue(t, "No error", err == nil)
+	assertEqualsStr(t, "Plot", "<html></html>", string(plot))
+
+	// Retries
+	unavailable, requests = 2, 0
+	_, err = c.Plot(ctx, Filter{})
+	assertTrue(t, "Retried", err == nil)
+	assertEqualsInt(t, "Requests", 3, requests)
+	unavailable, requests = 3, 0
+	_, err = c.Plot(ctx, Filter{})
+	assertEqualsInt(t, "Too many failures", http.StatusServiceUnavailable, err.(*Error).StatusCode)
+	assertEqualsInt(t, "Requests", 3, requests)
+	unavailable, requests = 1, 0
+	_, err = c.StartRun(ctx, "R", nil)
+	assertTrue(t, "POST not retried", err != nil)
+	assertEqualsInt(t, "Requests", 1, requests)
+	unavailable, requests = 1, 0
+	_, err = c.SetTag(ctx, "A")
+	assertTrue(t, "PUT not retried", err != nil)
+	assertEqualsInt(t, "Requests", 1, requests)
+
+	// Cancelled
+	unavailable = 0
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = c.Version(cancelled)
+	assertTrue(t, "Cancelled", err != nil)
+}
+
+func TestClientUnreachable(t *testing.T) {
+	c := New("http://localhost:9099")
+	c.RetryDelay = time.Millisecond
+	_, err := c.Version(context.Background())
+	assertTrue(t, "Unreachable", err != nil)
+	_, isError := err.(*Error)
+	assertTrue(t, "Not an API error", !isError)
+}
+
+func TestSetTLS(t *testing.T) {
+	c := New("https://localhost:9099")
+	err := c.SetTLS("", true)
+	assertTrue(t, "SetTLS", err == nil)
+	transport, isTransport := c.HTTPClient.Transport.(*http.Transport)
+	assertTrue(t, "HTTP transport", isTransport)
+	assertTrue(t, "Insecure", transport.TLSClientConfig.InsecureSkipVerify)
+	assertTrue(t, "Proxy from environment kept", transport.Proxy != nil)
+	assertTrue(t, "Timeouts kept", transport.TLSHandshakeTimeout > 0 && transport.IdleConnTimeout > 0)
+	defaultTLS := http.DefaultTransport.(*http.Transport).TLSClientConfig
+	assertTrue(t, "Default transport not changed", http.DefaultTransport != transport &&
+		(defaultTLS == nil || !defaultTLS.InsecureSkipVerify))
+	assertTrue(t, "Missing CA certificate", c.SetTLS("missing.pem", false) != nil)
+}
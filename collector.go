@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/midstar/plm/monitor"
+)
+
+// PushedHostTimeout is the time after which a host that has stopped
+// pushing is reported as not reachable
+const PushedHostTimeout = 5 * time.Minute
+
+// Collector receives measurements pushed from agents (see Pusher) and
+// stores them per host. The hosts are added to the aggregator of the
+// collector, i.e. they are included in the aggregated views. The other
+// resources answer for a pushed host if the host query parameter is set
+// (see HTTPServer.ServeHTTP).
+type Collector struct {
+	server *HTTPServer
+	hosts  map[string]*pushedHost // Keyed on host name. Use mutex for read/write
+	mutex  sync.Mutex
+}
+
+// pushedHost holds the data pushed from one agent. The data is stored in a
+// Measurement of its own and queries are answered by a HTTPServer that is
+// never started.
+type pushedHost struct {
+	localHost
+	session  time.Time   // Session of the last received batch
+	sequence uint64      // Sequence of the last received batch
+	uids     map[int]int // Collector UIDs keyed on agent UIDs (in this session)
+	lastPush time.Time
+	version  string
+	mutex    sync.Mutex // Held while a batch is stored
+}
+
+// CreateCollector creates a collector for the PLM instance served by s
+func CreateCollector(s *HTTPServer) *Collector {
+	return &Collector{
+		server: s,
+		hosts:  make(map[string]*pushedHost)}
+}
+
+// Push stores the pushed batches. Batches that already have been received
+// are ignored.
+func (c *Collector) Push(batches []*PushBatch) error {
+	for _, batch := range batches {
+		h, err := c.host(batch.Host)
+		if err != nil {
+			return err
+		}
+		h.store(batch)
+	}
+	return nil
+}
+
+// host returns the host with the provided name. The host is created if it
+// doesn't exist.
+func (c *Collector) host(name string) (*pushedHost, error) {
+	if name == "" {
+		return nil, fmt.Errorf("Host name missing")
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	h, hasHost := c.hosts[name]
+	if hasHost {
+		return h, nil
+	}
+	c.server.configMutex.Lock()
+	config := c.server.config.Clone()
+	c.server.configMutex.Unlock()
+	config.HostName = name
+	config.Agents = nil
+	config.AcceptPush = false
+	m := monitor.CreateMeasurement(config.FastLogSize, config.SlowLogSize,
+		config.FastLogTimeMs, config.SlowLogFactor, nil)
+	server := CreateHTTPServer(c.server.basePath, config, m)
+	c.server.tagsMutex.Lock()
+	for tag, t := range c.server.tags {
+		server.tags[tag] = t
+	}
+	c.server.tagsMutex.Unlock()
+	h = &pushedHost{
+		localHost: localHost{name: name, server: server},
+		uids:      make(map[int]int)}
+	if err := c.server.aggregator.AddHost(h); err != nil {
+		return nil, err
+	}
+	log.Printf("Receiving measurements from new host %s", name)
+	c.hosts[name] = h
+	return h, nil
+}
+
+// hostServer returns the server answering queries for the pushed host
+// with the provided name, or nil if there is no such host
+func (c *Collector) hostServer(name string) *HTTPServer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if h, hasHost := c.hosts[name]; hasHost {
+		return h.server
+	}
+	return nil
+}
+
+// store stores a batch
+func (h *pushedHost) store(batch *PushBatch) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	m := h.server.measurement
+	m.Mutex.Lock()
+	pm := m.PM
+	if !batch.Session.Equal(h.session) {
+		// The agent has been restarted, and its UIDs are reused
+		for pid, process := range pm.Alive {
+			process.IsAlive = false
+			process.Died = pm.LastUpdate
+			delete(pm.Alive, pid)
+		}
+		h.session = batch.Session
+		h.sequence = 0
+		h.uids = make(map[int]int)
+	}
+	if batch.Sequence <= h.sequence {
+		m.Mutex.Unlock()
+		return // Already received
+	}
+	h.sequence = batch.Sequence
+	h.lastPush = time.Now()
+	h.version = batch.Version
+
+	for _, p := range batch.Processes {
+		uid, hasUID := h.uids[p.UID]
+		if !hasUID {
+			uid = pm.AddProcess(p).UID
+			h.uids[p.UID] = uid
+		}
+		process, hasElement := pm.All[uid]
+		if !hasElement {
+			continue // Already removed
+		}
+		process.IsAlive = p.IsAlive
+		process.Died = p.Died
+		process.Exit = p.Exit
+		if process.IsAlive {
+			pm.Alive[process.Pid] = process
+		} else if pm.Alive[process.Pid] == process {
+			delete(pm.Alive, process.Pid)
+		}
+	}
+
+	row := &monitor.LogRow{
+		Time:         batch.Row.Time,
+		MemUsed:      batch.Row.MemUsed,
+		Untracked:    batch.Row.Untracked,
+		Cgroups:      batch.Row.Cgroups,
+		System:       batch.Row.System,
+		LogProcesses: make([]*monitor.LogProcess, 0, len(batch.Row.LogProcesses))}
+	for _, logProcess := range batch.Row.LogProcesses {
+		uid, hasUID := h.uids[logProcess.UID]
+		if !hasUID {
+			continue // Information about the process has been lost
+		}
+		row.LogProcesses = append(row.LogProcesses, &monitor.LogProcess{UID: uid, MemUsed: logProcess.MemUsed,
+			FDs: logProcess.FDs, Threads: logProcess.Threads, IO: logProcess.IO})
+		if process, hasElement := pm.All[uid]; hasElement {
+			process.LastMemory = logProcess.MemUsed
+			if process.MinMemoryEver == 0 || logProcess.MemUsed < process.MinMemoryEver {
+				process.MinMemoryEver = logProcess.MemUsed
+			}
+			if logProcess.MemUsed > process.MaxMemoryEver {
+				process.MaxMemoryEver = logProcess.MemUsed
+			}
+			process.LastFDs, process.LastThreads = logProcess.FDs, logProcess.Threads
+			process.IO = logProcess.IO
+			if logProcess.FDs > process.MaxFDsEver {
+				process.MaxFDsEver = logProcess.FDs
+			}
+			if logProcess.Threads > process.MaxThreadsEver {
+				process.MaxThreadsEver = logProcess.Threads
+			}
+		}
+	}
+	pm.Phys.TotalPhys = batch.TotalPhys
+	pm.Phys.LastPhys = row.MemUsed
+	if row.MemUsed > pm.Phys.MaxPhysEver {
+		pm.Phys.MaxPhysEver = row.MemUsed
+	}
+	if pm.Phys.MinPhysEver == 0 || row.MemUsed < pm.Phys.MinPhysEver {
+		pm.Phys.MinPhysEver = row.MemUsed
+	}
+	pm.LastUpdate = row.Time
+	m.FastLogger.AddRow(row)
+	if batch.Slow {
+		m.SlowLogger.AddRow(row)
+	}
+	m.Mutex.Unlock()
+	m.RemoveOldProcesses()
+}
+
+func (h *pushedHost) Status() HostStatus {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	status := HostStatus{Name: h.name, Version: h.version, Reachable: true, Pushed: true}
+	if time.Since(h.lastPush) > PushedHostTimeout {
+		status.Reachable = false
+		status.Error = fmt.Sprintf("No measurements received since %s", h.lastPush.Format(time.RFC3339))
+	}
+	return status
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/midstar/plm/monitor"
+	"github.com/midstar/proci"
+)
+
+func TestCollector(t *testing.T) {
+	config := DefaultConfiguration()
+	config.AcceptPush = true
+	config.HostName = "collector"
+	s := CreateHTTPServer("", config, monitor.CreateMeasurement(3, 6, 3, 6, proci.GenerateMock(1)))
+	c := s.collector
+
+	session := time.Now()
+	t1 := session.Add(time.Second)
+	batch1 := &PushBatch{Host: "agent", Session: session, Sequence: 1, TotalPhys: 1000,
+		Processes: []monitor.Process{
+			{UID: 1, Pid: 10, IsAlive: true, Path: "path_a", Name: "path_a"},
+			{UID: 2, Pid: 11, IsAlive: true, Path: "path_b", Name: "path_b"}},
+		Row: monitor.LogRow{Time: t1, MemUsed: 500, LogProcesses: []*monitor.LogProcess{
+			{UID: 1, MemUsed: 100}, {UID: 2, MemUsed: 200}}}}
+	batch2 := &PushBatch{Host: "agent", Session: session, Sequence: 2, TotalPhys: 1000,
+		Processes: []monitor.Process{{UID: 2, Pid: 11, IsAlive: false, Path: "path_b", Name: "path_b", Died: t1}},
+		Row: monitor.LogRow{Time: t1.Add(time.Second), MemUsed: 400, LogProcesses: []*monitor.LogProcess{
+			{UID: 1, MemUsed: 150}}},
+		Slow: true}
+	err := c.Push([]*PushBatch{batch1, batch1, batch2})
+	assertTrue(t, "Push", err == nil)
+	assertTrue(t, "Push without host", c.Push([]*PushBatch{{}}) != nil)
+
+	h := c.hosts["agent"]
+	m := h.server.measurement
+	assertEqualsInt(t, "Fast log rows (duplicates ignored)", 2, m.FastLogger.NbrRows)
+	assertEqualsInt(t, "Slow log rows", 1, m.SlowLogger.NbrRows)
+	assertEqualsInt(t, "Last phys", 400, int(m.PM.Phys.LastPhys))
+	assertEqualsInt(t, "Max phys", 500, int(m.PM.Phys.MaxPhysEver))
+	a := m.PM.All[h.uids[1]]
+	assertEqualsStr(t, "Path", "path_a", a.Path)
+	assertTrue(t, "Process a alive", a.IsAlive)
+	assertEqualsInt(t, "Last memory", 150, int(a.LastMemory))
+	assertEqualsInt(t, "Max memory", 150, int(a.MaxMemoryEver))
+	assertEqualsInt(t, "Min memory", 100, int(a.MinMemoryEver))
+	b := m.PM.All[h.uids[2]]
+	assertTrue(t, "Process b dead", !b.IsAlive)
+	assertEqualsInt(t, "Alive processes", 1, len(m.PM.Alive))
+
+	// The agent is restarted, which means that UIDs are reused
+	batch3 := &PushBatch{Host: "agent", Session: session.Add(time.Hour), Sequence: 1, TotalPhys: 1000,
+		Processes: []monitor.Process{{UID: 1, Pid: 20, IsAlive: true, Path: "path_c", Name: "path_c"}},
+		Row:       monitor.LogRow{Time: t1.Add(time.Hour), MemUsed: 400, LogProcesses: []*monitor.LogProcess{{UID: 1, MemUsed: 50}}}}
+	err = c.Push([]*PushBatch{batch3})
+	assertTrue(t, "Push after restart", err == nil)
+	assertEqualsInt(t, "Number of processes", 3, len(m.PM.All))
+	assertTrue(t, "Process a dead after restart", !a.IsAlive)
+	assertEqualsStr(t, "New process", "path_c", m.PM.All[h.uids[1]].Path)
+
+	// The pushed host is part of the aggregated views
+	statuses := s.aggregator.Statuses()
+	assertEqualsInt(t, "Number of hosts", 2, len(statuses))
+	assertEqualsStr(t, "Pushed host", "agent", statuses[1].Name)
+	assertTrue(t, "Pushed host reachable", statuses[1].Reachable)
+	minMax, errors := s.aggregator.MinMaxMem(url.Values{"match": {"path_a"}})
+	assertEqualsInt(t, "Number of errors", 0, len(errors))
+	assertEqualsInt(t, "Number of processes", 1, len(minMax))
+	assertEqualsStr(t, "Host", "agent", minMax[0].Host)
+	assertEqualsInt(t, "Max memory in period", 150, int(minMax[0].MaxMemoryInPeriod))
+
+	// The other resources answer for the pushed host with the host query
+	// parameter
+	for path, status := range map[string]int{
+		"/api/v1/processes?host=agent&match=path_c": http.StatusOK,
+		"/api/v1/processes?host=collector":          http.StatusOK,
+		"/api/v1/processes?host=unknown":            http.StatusBadRequest,
+		"/processes?host=unknown":                   http.StatusBadRequest,
+		"/?host=agent":                              http.StatusOK} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assertEqualsInt(t, "Status of "+path, status, w.Code)
+		if path == "/api/v1/processes?host=agent&match=path_c" {
+			var page struct{ Items []monitor.Process }
+			json.Unmarshal(w.Body.Bytes(), &page)
+			assertEqualsInt(t, "Pushed processes", 1, len(page.Items))
+			assertEqualsStr(t, "Pushed process", "path_c", page.Items[0].Path)
+		}
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/v1/config?host=agent", strings.NewReader("{}")))
+	assertEqualsInt(t, "Only GET for pushed hosts", http.StatusBadRequest, w.Code)
+	assertTrue(t, "Pushed host flagged", statuses[1].Pushed && !statuses[0].Pushed)
+
+	// Name of pushed host cannot be the same as the collector
+	err = c.Push([]*PushBatch{{Host: "collector", Session: session, Sequence: 1}})
+	assertTrue(t, "Push with collector host name", err != nil)
+}
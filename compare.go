@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+)
+
+// RunSeries is the total memory of the compared processes during a run,
+// or a period. The times are relative to the start of the run, which
+// aligns the series of different runs.
+type RunSeries struct {
+	Run     string    `json:",omitempty"`
+	Offsets []float64 // Seconds since the start of the run
+	Memory  []uint32  // Total memory of the processes at each offset (KB)
+	Peak    uint32    // Highest memory (KB)
+	Avg     uint32    // Average memory (KB)
+	Growth  int64     // Last minus first memory (KB)
+}
+
+// Delta is the difference between the head and the base value of a
+// comparison
+type Delta struct {
+	Base     int64
+	Head     int64
+	Diff     int64   // Head minus base
+	Percent  float64 // Diff in percent of base
+	Exceeded bool    // Percent is above the tolerance
+}
+
+// Tolerance is the highest allowed increase, in percent, from base to head
+// of each delta. Negative values are not checked.
+type Tolerance struct {
+	Peak   float64
+	Avg    float64
+	Growth float64
+}
+
+// NoTolerance is a tolerance where nothing is checked
+var NoTolerance = Tolerance{Peak: -1, Avg: -1, Growth: -1}
+
+// IsUsed returns true if any of the tolerances are checked
+func (t Tolerance) IsUsed() bool {
+	return t.Peak >= 0 || t.Avg >= 0 || t.Growth >= 0
+}
+
+// Comparison is the result of comparing the memory of processes in two
+// runs. The growth percent is in relation to the base peak, since the base
+// growth often is close to zero.
+type Comparison struct {
+	Match      []string // Processes compared. All processes of the runs if empty
+	Base       RunSeries
+	Head       RunSeries
+	Peak       Delta
+	Avg        Delta
+	Growth     Delta
+	Tolerance  Tolerance
+	Regression bool // Any of the deltas exceeds its tolerance
+}
+
+// getSeries returns the series of the processes and the period given by
+// the query parameters (see getUIDs and getFromTo). The offsets are
+// relative to the start of the period, or the first measurement if no
+// start is given.
+func (s *HTTPServer) getSeries(values url.Values) (RunSeries, error) {
+	series := RunSeries{}
+	uids, err := s.getUIDs(values)
+	if err != nil {
+		return series, err
+	}
+	from, to, err := s.getFromTo(values)
+	if err != nil {
+		return series, err
+	}
+	// Rows where a watch didn't sample all processes would count the
+	// copied values once more
+	measurements := s.measurement.GetProcessMeasurementsBetween(uids, from, to).WithoutFilled() // Thread safe
+	if from.IsZero() && len(measurements.Times) > 0 {
+		from = measurements.Times[0]
+	}
+	series.Offsets = make([]float64, len(measurements.Times))
+	series.Memory = make([]uint32, len(measurements.Times))
+	for i, t := range measurements.Times {
+		series.Offsets[i] = t.Sub(from).Seconds()
+		for _, memory := range measurements.Memory {
+			series.Memory[i] += memory[i]
+		}
+	}
+	var sum uint64
+	for _, memory := range series.Memory {
+		if memory > series.Peak {
+			series.Peak = memory
+		}
+		sum += uint64(memory)
+	}
+	if len(series.Memory) > 0 {
+		series.Avg = uint32(sum / uint64(len(series.Memory)))
+		series.Growth = int64(series.Memory[len(series.Memory)-1]) - int64(series.Memory[0])
+	}
+	return series, nil
+}
+
+// getRunSeries returns the series of the processes matching match (all if
+// empty) during the run
+func (s *HTTPServer) getRunSeries(run string, match []string) (RunSeries, error) {
+	values := url.Values{"run": []string{run}}
+	if len(match) > 0 {
+		values["match"] = match
+	}
+	series, err := s.getSeries(values)
+	series.Run = run
+	return series, err
+}
+
+// newDelta creates a delta. The percent is calculated in relation to
+// reference.
+func newDelta(base int64, head int64, reference int64, tolerance float64) Delta {
+	d := Delta{Base: base, Head: head, Diff: head - base}
+	if reference != 0 {
+		d.Percent = float64(d.Diff) * 100 / float64(reference)
+	} else if d.Diff > 0 {
+		d.Percent = 100
+	}
+	d.Exceeded = tolerance >= 0 && d.Percent > tolerance
+	return d
+}
+
+// compareSeries compares the base and head series
+func compareSeries(base RunSeries, head RunSeries, match []string, tolerance Tolerance) *Comparison {
+	c := &Comparison{
+		Match:     match,
+		Base:      base,
+		Head:      head,
+		Peak:      newDelta(int64(base.Peak), int64(head.Peak), int64(base.Peak), tolerance.Peak),
+		Avg:       newDelta(int64(base.Avg), int64(head.Avg), int64(base.Avg), tolerance.Avg),
+		Growth:    newDelta(base.Growth, head.Growth, int64(base.Peak), tolerance.Growth),
+		Tolerance: tolerance}
+	if c.Match == nil {
+		c.Match = []string{}
+	}
+	c.Regression = c.Peak.Exceeded || c.Avg.Exceeded || c.Growth.Exceeded
+	return c
+}
+
+// compareRuns compares the memory of the processes matching match (all if
+// empty) in the base and head runs
+func (s *HTTPServer) compareRuns(base string, head string, match []string, tolerance Tolerance) (*Comparison, error) {
+	baseSeries, err := s.getRunSeries(base, match)
+	if err != nil {
+		return nil, err
+	}
+	headSeries, err := s.getRunSeries(head, match)
+	if err != nil {
+		return nil, err
+	}
+	return compareSeries(baseSeries, headSeries, match, tolerance), nil
+}
+
+// parseTolerance parses the query parameters threshold (all tolerances),
+// peakTolerance, avgTolerance and growthTolerance. Tolerances not given
+// are not checked.
+func parseTolerance(values url.Values) (Tolerance, error) {
+	tolerance := NoTolerance
+	params := []struct {
+		name  string
+		value []*float64
+	}{
+		{"threshold", []*float64{&tolerance.Peak, &tolerance.Avg, &tolerance.Growth}},
+		{"peakTolerance", []*float64{&tolerance.Peak}},
+		{"avgTolerance", []*float64{&tolerance.Avg}},
+		{"growthTolerance", []*float64{&tolerance.Growth}}}
+	for _, param := range params {
+		str := values.Get(param.name)
+		if str == "" {
+			continue
+		}
+		percent, err := strconv.ParseFloat(str, 64)
+		if err != nil || percent < 0 {
+			return tolerance, fmt.Errorf("Invalid parameter %s %s. Shall be a positive percentage", param.name, str)
+		}
+		for _, value := range param.value {
+			*value = percent
+		}
+	}
+	return tolerance, nil
+}
+
+// getComparison parses the query parameters base, head, match and the
+// tolerances (see parseTolerance) and compares the runs
+func (s *HTTPServer) getComparison(values url.Values) (*Comparison, error) {
+	base, head := values.Get("base"), values.Get("head")
+	if base == "" || head == "" {
+		return nil, fmt.Errorf("Parameters base and head are required")
+	}
+	tolerance, err := parseTolerance(values)
+	if err != nil {
+		return nil, err
+	}
+	return s.compareRuns(base, head, values["match"], tolerance)
+}
+
+// serveAPICompare handles GET compare
+func (s *HTTPServer) serveAPICompare(w http.ResponseWriter, r *http.Request, values url.Values) {
+	c, err := s.getComparison(values)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+		return
+	}
+	writeJSON(w, r, http.StatusOK, c)
+}
+
+// serveHTTPCompare returns the comparison as a HTML report
+func (s *HTTPServer) serveHTTPCompare(w http.ResponseWriter, values url.Values) {
+	c, err := s.getComparison(values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	templateFile := filepath.Join(s.basePath, "templates", "compare.gohtml")
+	t, err := template.New("").Funcs(*s.fm).ParseFiles(templateFile)
+	if err != nil {
+		http.Error(w, "Create template: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = t.ExecuteTemplate(w, "compare.gohtml", c)
+	if err != nil {
+		http.Error(w, "Execute template: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/midstar/plm/monitor"
+	"github.com/midstar/proci"
+)
+
+func TestCompare(t *testing.T) {
+	port := 9100
+	baseURL := fmt.Sprintf("http://localhost:%d/api/v1", port)
+	config := DefaultConfiguration()
+	config.Port = port
+	pMock := proci.GenerateMock(10)
+	m := monitor.CreateMeasurement(10, 20, 3, 6, pMock)
+	m.MeasureAndLog(false)
+	httpServer := CreateHTTPServer("", config, m)
+	httpServer.Start()
+	defer httpServer.Stop()
+	time.Sleep(100 * time.Millisecond) // Allow server to start
+
+	measureRun := func(name string, memory []uint64) {
+		_, err := httpServer.startRun(name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, value := range memory {
+			time.Sleep(2 * time.Millisecond) // To make time differ
+			pMock.Processes[10].MemoryUsage = value
+			m.MeasureAndLog(false)
+		}
+		time.Sleep(2 * time.Millisecond)
+		_, err = httpServer.stopRun(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	measureRun("BASE", []uint64{10 * 1024, 20 * 1024, 20 * 1024, 30 * 1024})
+	measureRun("HEAD", []uint64{10 * 1024, 30 * 1024, 40 * 1024, 50 * 1024})
+
+	var c Comparison
+	assertEqualsInt(t, "Status", http.StatusOK,
+		apiRequest(t, "GET", baseURL+"/compare?base=BASE&head=HEAD&match=command_line_10&threshold=10", "", &c))
+	assertEqualsInt(t, "Base measurements", 4, len(c.Base.Memory))
+	assertEqualsInt(t, "Head measurements", 4, len(c.Head.Memory))
+	assertTrue(t, "Relative time", c.Head.Offsets[0] >= 0 && c.Head.Offsets[0] < 1)
+	assertEqualsInt(t, "Base peak", 30, int(c.Peak.Base))
+	assertEqualsInt(t, "Head peak", 50, int(c.Peak.Head))
+	assertEqualsInt(t, "Peak diff", 20, int(c.Peak.Diff))
+	assertEqualsInt(t, "Peak percent", 66, int(c.Peak.Percent))
+	assertEqualsInt(t, "Base avg", 20, int(c.Avg.Base))
+	assertEqualsInt(t, "Head avg", 32, int(c.Avg.Head))
+	assertEqualsInt(t, "Avg percent", 60, int(c.Avg.Percent))
+	assertEqualsInt(t, "Base growth", 20, int(c.Growth.Base))
+	assertEqualsInt(t, "Head growth", 40, int(c.Growth.Head))
+	assertEqualsInt(t, "Growth percent of base peak", 66, int(c.Growth.Percent))
+	assertTrue(t, "Peak exceeded", c.Peak.Exceeded)
+	assertTrue(t, "Regression", c.Regression)
+
+	c = Comparison{}
+	assertEqualsInt(t, "Status", http.StatusOK,
+		apiRequest(t, "GET", baseURL+"/compare?base=BASE&head=HEAD&match=command_line_10&threshold=70", "", &c))
+	assertTrue(t, "No regression", !c.Regression)
+
+	// Only growth checked
+	c = Comparison{}
+	assertEqualsInt(t, "Status", http.StatusOK,
+		apiRequest(t, "GET", baseURL+"/compare?base=BASE&head=HEAD&match=command_line_10&growthTolerance=60", "", &c))
+	assertTrue(t, "Peak not checked", !c.Peak.Exceeded)
+	assertTrue(t, "Growth exceeded", c.Growth.Exceeded)
+	assertTrue(t, "Regression", c.Regression)
+
+	// Head better than base
+	c = Comparison{}
+	assertEqualsInt(t, "Status", http.StatusOK,
+		apiRequest(t, "GET", baseURL+"/compare?base=HEAD&head=BASE&match=command_line_10&threshold=0", "", &c))
+	assertTrue(t, "Negative delta", c.Peak.Percent < 0)
+	assertTrue(t, "No regression", !c.Regression)
+
+	// All processes
+	c = Comparison{}
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/compare?base=BASE&head=HEAD", "", &c))
+	assertTrue(t, "Total memory", c.Peak.Base > 30)
+	assertTrue(t, "No threshold", !c.Tolerance.IsUsed() && !c.Regression)
+
+	// Errors
+	var apiError APIError
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "GET", baseURL+"/compare?base=BASE", "", &apiError))
+	assertEqualsStr(t, "Error code", ErrorCodeInvalidParameter, apiError.Error.Code)
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "GET", baseURL+"/compare?base=BASE&head=NOT_EXISTING", "", nil))
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "GET", baseURL+"/compare?base=BASE&head=HEAD&threshold=x", "", nil))
+
+	// HTML report
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/compare?base=BASE&head=HEAD&match=command_line_10&threshold=10", port))
+	if err != nil {
+		t.Fatal("Unable to get compare report. Reason: ", err)
+	}
+	assertEqualsInt(t, "Status", http.StatusOK, resp.StatusCode)
+	body := respToString(resp.Body)
+	assertTrue(t, "Runs in report", strings.Contains(body, "BASE") && strings.Contains(body, "HEAD"))
+	assertTrue(t, "Regression in report", strings.Contains(body, "REGRESSION"))
+}
@@ -1,55 +1,465 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
+
+	"github.com/midstar/plm/monitor"
 )
 
 // DefaultConfigFile default configuration file
 const DefaultConfigFile = "plm.config"
 
+// EnvironmentPrefix is the prefix of environment variables that override
+// the configuration file. The parameter fastLogTimeMs is for example
+// overridden with PLM_FAST_LOG_TIME_MS.
+const EnvironmentPrefix = "PLM_"
+
+// Sources of configuration values. The configuration file source is the
+// file name.
+const (
+	SourceDefault     = "default"
+	SourceEnvironment = "environment"
+	SourceCommandLine = "command line"
+	SourceRuntime     = "runtime"
+)
+
 // Configuration holds parameters that are configurable.
 type Configuration struct {
-	Port          int
-	FastLogTimeMs int
-	SlowLogFactor int
-	FastLogSize   int
-	SlowLogSize   int
-}
-
-// LoadConfiguration loads configuration from file and returns a
-// Configuration. Default values will be used if configuration
-// cannot be found.
-func LoadConfiguration(fileName string) *Configuration {
-	p, errprop := LoadPropertyFile(fileName)
+	Port             int
+	FastLogTimeMs    int
+	SlowLogFactor    int
+	FastLogSize      int
+	SlowLogSize      int
+	BindAddress      string            // Interface to listen on. Empty means all interfaces
+	TLSCertFile      string            // Certificate file. HTTPS is used if set
+	TLSKeyFile       string            // Private key file for TLS
+	ReadToken        string            `json:"-"` // Token required for reading (if set)
+	WriteToken       string            `json:"-"` // Token required for tags and configuration (if set)
+	RedactPatterns   []string          // Regular expressions of secrets to remove from command lines
+	RedactDefaults   bool              // Use DefaultRedactPatterns
+	HideCommandLine  []string          // Don't capture command line for processes whose path contain any of these
+	IncludeProcesses []string          // Only track processes matching any of these, see monitor.ProcessFilter
+	ExcludeProcesses []string          // Don't track processes matching any of these
+	MinProcessMemory int               // Don't track processes until they use at least this much memory (KB)
+	CgroupRoot       string            // Where the cgroup file system is mounted. Empty disables cgroup accounting
+	OOMLog           string            // Kernel log with OOM kills, such as /dev/kmsg. Empty means not used
+	HostName         string            // Name of this host in aggregated views. Empty means the computer name
+	Agents           []string          // Remote PLM agents to aggregate, see ParseAgents
+	AgentToken       string            `json:"-"` // Token used to access the agents
+	AcceptPush       bool              // Accept measurements pushed from agents
+	Collector        string            // URL of collector to push measurements to
+	CollectorToken   string            `json:"-"` // Token used to access the collector
+	PushBufferSize   int               // Maximum number of measurements buffered while the collector is unreachable
+	fileName         string            // File the configuration was loaded from
+	sources          map[string]string // Where each value came from, keyed on property key
+}
+
+// parameter is one configurable parameter. The key is used in the
+// configuration file, as command line flag and (converted) as environment
+// variable.
+type parameter struct {
+	key         string
+	description string
+	value       flag.Value
+	runtime     bool // Can be changed without restarting PLM
+	secret      bool // Value is never displayed
+}
+
+// intValue is a flag.Value for integer parameters
+type intValue int
+
+func (i *intValue) Set(s string) error {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a valid integer", s)
+	}
+	*i = intValue(v)
+	return nil
+}
+
+func (i *intValue) String() string {
+	return strconv.Itoa(int(*i))
+}
+
+// stringValue is a flag.Value for string parameters
+type stringValue string
+
+func (s *stringValue) Set(v string) error {
+	*s = stringValue(v)
+	return nil
+}
+
+func (s *stringValue) String() string {
+	return string(*s)
+}
+
+// boolValue is a flag.Value for boolean parameters
+type boolValue bool
+
+func (b *boolValue) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a valid boolean", s)
+	}
+	*b = boolValue(v)
+	return nil
+}
+
+func (b *boolValue) String() string {
+	return strconv.FormatBool(bool(*b))
+}
+
+// IsBoolFlag makes it possible to use boolean flags without value
+func (b *boolValue) IsBoolFlag() bool {
+	return true
+}
+
+// listValue is a flag.Value for parameters with several values separated
+// by ListSeparator
+type listValue []string
+
+// ListSeparator separates the values of list parameters
+const ListSeparator = ";"
+
+func (l *listValue) Set(s string) error {
+	*l = nil
+	for _, v := range strings.Split(s, ListSeparator) {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+func (l *listValue) String() string {
+	return strings.Join(*l, ListSeparator)
+}
+
+// parameters returns all configurable parameters, pointing to the values
+// of c.
+func (c *Configuration) parameters() []parameter {
+	return []parameter{
+		{key: "port", description: "Network port",
+			value: (*intValue)(&c.Port)},
+		{key: "fastLogTimeMs", description: "Time between each measurement in milli seconds",
+			value: (*intValue)(&c.FastLogTimeMs), runtime: true},
+		{key: "slowLogFactor", description: "How often measurements are added to the slow log in relation to the fast log",
+			value: (*intValue)(&c.SlowLogFactor), runtime: true},
+		{key: "fastLogSize", description: "Number of measurements in fast log before wrap",
+			value: (*intValue)(&c.FastLogSize), runtime: true},
+		{key: "slowLogSize", description: "Number of measurements in slow log before wrap",
+			value: (*intValue)(&c.SlowLogSize), runtime: true},
+		{key: "bindAddress", description: "Network interface (IP address or host name) to listen on. Empty means all interfaces",
+			value: (*stringValue)(&c.BindAddress)},
+		{key: "tlsCertFile", description: "Certificate file (PEM). HTTPS is used if set",
+			value: (*stringValue)(&c.TLSCertFile)},
+		{key: "tlsKeyFile", description: "Private key file (PEM) for the certificate",
+			value: (*stringValue)(&c.TLSKeyFile)},
+		{key: "readToken", description: "Token required to read. Empty means no authentication for reading",
+			value: (*stringValue)(&c.ReadToken), secret: true},
+		{key: "writeToken", description: "Token required to create tags and change configuration. Empty means no authentication for writing",
+			value: (*stringValue)(&c.WriteToken), secret: true},
+		{key: "redactPatterns", description: "Regular expressions, separated by ;, of secrets to remove from command lines",
+			value: (*listValue)(&c.RedactPatterns)},
+		{key: "redactDefaults", description: "Remove common secrets, such as passwords and tokens, from command lines",
+			value: (*boolValue)(&c.RedactDefaults)},
+		{key: "hideCommandLine", description: "Don't capture the command line of processes whose path contain any of these strings (separated by ;). Use * for all processes",
+			value: (*listValue)(&c.HideCommandLine)},
+		{key: "includeProcesses", description: "Only track processes whose path contain any of these strings (separated by ;), or owned by user:<name>. Empty means all processes",
+			value: (*listValue)(&c.IncludeProcesses)},
+		{key: "excludeProcesses", description: "Don't track processes whose path contain any of these strings (separated by ;), or owned by user:<name>",
+			value: (*listValue)(&c.ExcludeProcesses)},
+		{key: "minProcessMemory", description: "Don't track processes until they use at least this much memory (KB)",
+			value: (*intValue)(&c.MinProcessMemory)},
+		{key: "cgroupRoot", description: "Where the cgroup file system is mounted (Linux). Empty disables cgroup accounting",
+			value: (*stringValue)(&c.CgroupRoot)},
+		{key: "oomLog", description: "Kernel log to find processes killed by the OOM killer in, such as /dev/kmsg (Linux). Empty means not used",
+			value: (*stringValue)(&c.OOMLog)},
+		{key: "hostName", description: "Name of this host in aggregated views. Empty means the computer name",
+			value: (*stringValue)(&c.HostName)},
+		{key: "agents", description: "Remote PLM agents to aggregate, separated by ;. Each agent is an URL, optionally prefixed with <name>=",
+			value: (*listValue)(&c.Agents)},
+		{key: "agentToken", description: "Token used to access the agents",
+			value: (*stringValue)(&c.AgentToken), secret: true},
+		{key: "acceptPush", description: "Accept measurements pushed from other PLM instances (agents)",
+			value: (*boolValue)(&c.AcceptPush)},
+		{key: "collector", description: "URL of a PLM instance (collector) to push all measurements to",
+			value: (*stringValue)(&c.Collector)},
+		{key: "collectorToken", description: "Token used to access the collector",
+			value: (*stringValue)(&c.CollectorToken), secret: true},
+		{key: "pushBufferSize", description: "Maximum number of measurements stored on disk while the collector cannot be reached",
+			value: (*intValue)(&c.PushBufferSize)}}
+}
+
+// CheckRuntimeChange returns an error if any parameter that cannot be
+// changed without restarting PLM differs from the old configuration.
+func (c *Configuration) CheckRuntimeChange(old *Configuration) error {
+	oldParameters := old.parameters()
+	for i, p := range c.parameters() {
+		if !p.runtime && p.value.String() != oldParameters[i].value.String() {
+			return fmt.Errorf("%s cannot be changed without restarting PLM", p.key)
+		}
+	}
+	return nil
+}
+
+// DefaultConfiguration returns a configuration with the default values.
+func DefaultConfiguration() *Configuration {
+	c := &Configuration{
+		Port:           12124,
+		FastLogTimeMs:  3000,
+		SlowLogFactor:  20,
+		FastLogSize:    1200,
+		SlowLogSize:    1440,
+		RedactDefaults: true,
+		PushBufferSize: 10000,
+		CgroupRoot:     defaultCgroupRoot(),
+		sources:        make(map[string]string)}
+	for _, p := range c.parameters() {
+		c.sources[p.key] = SourceDefault
+	}
+	return c
+}
+
+// defaultCgroupRoot returns where the cgroup file system is mounted by
+// default. Cgroups only exist on Linux.
+func defaultCgroupRoot() string {
+	if runtime.GOOS == "linux" {
+		return monitor.DefaultCgroupRoot
+	}
+	return ""
+}
+
+// RegisterFlags defines one command line flag per configuration parameter
+// in flagSet. The values of the flags that are set on the command line are
+// stored in the returned map, keyed on parameter key. Pass the map to
+// LoadConfiguration after the flags have been parsed.
+func RegisterFlags(flagSet *flag.FlagSet) map[string]string {
+	values := make(map[string]string)
+	for _, p := range DefaultConfiguration().parameters() {
+		flagSet.Var(&flagCollector{key: p.key, values: values, defaultValue: p.value.String()},
+			p.key, p.description)
+	}
+	return values
+}
+
+// flagCollector is a flag.Value that stores the flag value in a map
+type flagCollector struct {
+	key          string
+	values       map[string]string
+	defaultValue string
+}
+
+func (f *flagCollector) Set(s string) error {
+	f.values[f.key] = s
+	return nil
+}
+
+func (f *flagCollector) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.defaultValue
+}
+
+// EnvironmentName returns the name of the environment variable that
+// overrides the parameter with the provided key. For example
+// fastLogTimeMs gives PLM_FAST_LOG_TIME_MS.
+func EnvironmentName(key string) string {
+	var b strings.Builder
+	b.WriteString(EnvironmentPrefix)
+	for i, r := range key {
+		if unicode.IsUpper(r) && i > 0 {
+			b.WriteRune('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// LoadConfiguration loads the configuration and returns a Configuration.
+// The values are taken from (in priority order):
+//   - flags (values returned by RegisterFlags, might be nil)
+//   - environment variables (see EnvironmentName)
+//   - the configuration file
+//   - default values
+//
+// A configuration file that does not exist is not considered an error, but
+// invalid values, unknown parameters in the file and values that don't
+// pass Validate are. All problems found are reported in the returned error.
+func LoadConfiguration(fileName string, flags map[string]string) (*Configuration, error) {
+	c := DefaultConfiguration()
+	c.fileName = fileName
+	var problems []string
+
+	properties, errprop := LoadPropertyFile(fileName)
 	if errprop != nil {
 		log.Println(errprop)
 	}
-	// Create configuration with default values
-	configuration := Configuration{
-		Port:          getPropertyInt(p, "port", 12124),
-		FastLogTimeMs: getPropertyInt(p, "fastLogTimeMs", 3000),
-		SlowLogFactor: getPropertyInt(p, "slowLogFactor", 20),
-		FastLogSize:   getPropertyInt(p, "fastLogSize", 1200),
-		SlowLogSize:   getPropertyInt(p, "slowLogSize", 1440)}
+	known := make(map[string]bool)
+	for _, p := range c.parameters() {
+		known[p.key] = true
+	}
+	for key := range properties {
+		if !known[key] {
+			problems = append(problems, fmt.Sprintf("%s: unknown parameter %s", fileName, key))
+		}
+	}
+
+	for _, p := range c.parameters() {
+		if value, hasKey := properties[p.key]; hasKey {
+			problems = c.set(p, value, fileName, problems)
+		}
+		if value, hasEnv := os.LookupEnv(EnvironmentName(p.key)); hasEnv {
+			problems = c.set(p, value, SourceEnvironment, problems)
+		}
+		if value, hasFlag := flags[p.key]; hasFlag {
+			problems = c.set(p, value, SourceCommandLine, problems)
+		}
+	}
+
+	if len(problems) > 0 {
+		return c, fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return c, c.Validate()
+}
+
+// set sets the value of a parameter and records its source. Problems are
+// appended to the problems slice which is returned.
+func (c *Configuration) set(p parameter, value string, source string, problems []string) []string {
+	err := p.value.Set(strings.TrimSpace(value))
+	if err != nil {
+		return append(problems, fmt.Sprintf("%s (%s): %s", p.key, source, err))
+	}
+	c.sources[p.key] = source
+	return problems
+}
+
+// Source returns where the value of the parameter with the provided key
+// came from. This is one of the Source constants or the configuration file
+// name.
+func (c *Configuration) Source(key string) string {
+	return c.sources[key]
+}
 
-	return &configuration
+// Clone returns a copy of the configuration.
+func (c *Configuration) Clone() *Configuration {
+	clone := *c
+	clone.sources = make(map[string]string)
+	for key, source := range c.sources {
+		clone.sources[key] = source
+	}
+	return &clone
+}
+
+// MarkChanged sets the source to SourceRuntime for all parameters that
+// differ from the old configuration.
+func (c *Configuration) MarkChanged(old *Configuration) {
+	oldParameters := old.parameters()
+	for i, p := range c.parameters() {
+		if p.value.String() != oldParameters[i].value.String() {
+			c.sources[p.key] = SourceRuntime
+		}
+	}
+}
+
+// Describe returns a text listing all parameters with their values and
+// where the values came from.
+func (c *Configuration) Describe() string {
+	parameters := c.parameters()
+	width := 0
+	for _, p := range parameters {
+		if len(p.key) > width {
+			width = len(p.key)
+		}
+	}
+	var b strings.Builder
+	for _, p := range parameters {
+		value := p.value.String()
+		if p.secret && value != "" {
+			value = "********"
+		}
+		fmt.Fprintf(&b, "%-*s = %-10s (%s)\n", width, p.key, value, c.Source(p.key))
+	}
+	return b.String()
+}
+
+// Save writes the configuration back to the file it was loaded from.
+// Comments and unknown properties in the file are preserved. Only the
+// values from the file and the values changed at runtime (see MarkChanged)
+// are written. Default values are not written, so that a changed default
+// of a later version applies, and values given as environment variables or
+// command line flags override the file anyway.
+func (c *Configuration) Save() error {
+	properties := make(map[string]string)
+	for _, p := range c.parameters() {
+		source := c.Source(p.key)
+		if source == c.fileName || source == SourceRuntime {
+			properties[p.key] = p.value.String()
+		}
+	}
+	return SavePropertyFile(c.fileName, properties)
 }
 
-func getPropertyInt(properties map[string]string, key string, defaultValue int) int {
-	value, hasKey := properties[key]
-	if !hasKey {
-		return defaultValue
+// Validate checks that the configuration values are usable. All invalid
+// values are reported in the returned error.
+func (c *Configuration) Validate() error {
+	var problems []string
+	if c.Port < 1 || c.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("port must be between 1 and 65535, got %d", c.Port))
+	}
+	if c.FastLogTimeMs < 1 {
+		problems = append(problems, fmt.Sprintf("fastLogTimeMs must be at least 1, got %d", c.FastLogTimeMs))
+	}
+	if c.SlowLogFactor < 1 {
+		problems = append(problems, fmt.Sprintf("slowLogFactor must be at least 1, got %d", c.SlowLogFactor))
+	}
+	if c.FastLogSize < 1 {
+		problems = append(problems, fmt.Sprintf("fastLogSize must be at least 1, got %d", c.FastLogSize))
+	}
+	if c.SlowLogSize < 1 {
+		problems = append(problems, fmt.Sprintf("slowLogSize must be at least 1, got %d", c.SlowLogSize))
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		problems = append(problems, "tlsCertFile and tlsKeyFile must both be set to use TLS")
+	}
+	if c.ReadToken != "" && c.WriteToken == "" {
+		problems = append(problems, "writeToken must be set if readToken is set")
+	}
+	if _, err := monitor.NewRedactor(c.RedactPatterns, c.RedactDefaults, c.HideCommandLine); err != nil {
+		problems = append(problems, err.Error())
 	}
-	intValue, valueerr := strconv.Atoi(value)
-	if valueerr != nil {
-		log.Printf("Property %s does not have a valid integer value. Using default %d\n", key, defaultValue)
-		return defaultValue
+	if _, err := monitor.NewProcessFilter(c.IncludeProcesses, nil, 0); err != nil {
+		problems = append(problems, fmt.Sprintf("includeProcesses: %s", err))
 	}
-	return intValue
+	if _, err := monitor.NewProcessFilter(nil, c.ExcludeProcesses, 0); err != nil {
+		problems = append(problems, fmt.Sprintf("excludeProcesses: %s", err))
+	}
+	if c.MinProcessMemory < 0 {
+		problems = append(problems, fmt.Sprintf("minProcessMemory must be at least 0, got %d", c.MinProcessMemory))
+	}
+	if _, err := ParseAgents(c.Agents); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if c.Collector != "" && !isHTTPURL(c.Collector) {
+		problems = append(problems, fmt.Sprintf("collector %s is not a valid http or https URL", c.Collector))
+	}
+	if c.PushBufferSize < 1 {
+		problems = append(problems, fmt.Sprintf("pushBufferSize must be at least 1, got %d", c.PushBufferSize))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
 }
 
 // LoadPropertyFile loads property files of the same format as found in Java
@@ -76,3 +486,51 @@ func LoadPropertyFile(fileName string) (map[string]string, error) {
 	}
 	return properties, nil
 }
+
+// SavePropertyFile updates the values of the provided properties in a
+// property file. Lines that don't hold any of the provided properties,
+// such as comments, are kept as is. Properties that are not found in the
+// file are appended. The file is created if it does not exist.
+func SavePropertyFile(fileName string, properties map[string]string) error {
+	var lines []string
+	b, fileerr := ioutil.ReadFile(fileName)
+	if fileerr == nil {
+		lines = strings.Split(string(b), "\n")
+	}
+	trailingNewline := len(lines) > 0 && lines[len(lines)-1] == ""
+	if trailingNewline {
+		lines = lines[:len(lines)-1]
+	}
+	written := make(map[string]bool)
+	for i, line := range lines {
+		tLine := strings.TrimSpace(line)
+		if len(tLine) > 0 && !strings.HasPrefix(tLine, "#") {
+			parts := strings.SplitN(tLine, "=", 2)
+			key := strings.TrimSpace(parts[0])
+			value, hasKey := properties[key]
+			if len(parts) == 2 && hasKey {
+				lines[i] = fmt.Sprintf("%s=%s", key, value)
+				written[key] = true
+			}
+		}
+	}
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		if !written[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		lines = append(lines, fmt.Sprintf("%s=%s", key, properties[key]))
+	}
+	content := strings.Join(lines, "\n")
+	if trailingNewline {
+		content += "\n"
+	}
+	fileerr = ioutil.WriteFile(fileName, []byte(content), 0644)
+	if fileerr != nil {
+		return fmt.Errorf("unable to save properties to %s. Reason: %s", fileName, fileerr)
+	}
+	return nil
+}
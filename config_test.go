@@ -1,8 +1,11 @@
 package main
 
 import (
+	"flag"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -15,16 +18,23 @@ func defaultConfig(t *testing.T) string {
 }
 
 func TestConfig(t *testing.T) {
-	config := LoadConfiguration(defaultConfig(t))
+	config, err := LoadConfiguration(defaultConfig(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
 	assertEqualsInt(t, "config.Port", 12124, config.Port)
 	assertEqualsInt(t, "config.FastLogTimeMs", 6000, config.FastLogTimeMs)
 	assertEqualsInt(t, "config.SlowLogFactor", 10, config.SlowLogFactor)
 	assertEqualsInt(t, "config.FastLogSize", 600, config.FastLogSize)
 	assertEqualsInt(t, "config.SlowLogSize", 1440, config.SlowLogSize)
+	assertEqualsStr(t, "Source of port", defaultConfig(t), config.Source("port"))
 }
 
 func TestConfigInvalidFile(t *testing.T) {
-	config := LoadConfiguration("dont_exist.properties")
+	config, err := LoadConfiguration("dont_exist.properties", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
 	assertEqualsInt(t, "config.Port", 12124, config.Port)
 	assertEqualsInt(t, "config.FastLogTimeMs", 3000, config.FastLogTimeMs)
 	assertEqualsInt(t, "config.SlowLogFactor", 20, config.SlowLogFactor)
@@ -32,11 +42,78 @@ func TestConfigInvalidFile(t *testing.T) {
 	assertEqualsInt(t, "config.SlowLogSize", 1440, config.SlowLogSize)
 }
 
-func TestLoadPropertyInt(t *testing.T) {
-	properties := make(map[string]string)
-	properties["mkey"] = "invalid"
-	value := getPropertyInt(properties, "mkey", 3)
-	assertEqualsInt(t, "mKey value", 3, value)
+func writeTempConfig(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "plm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileName := filepath.Join(dir, DefaultConfigFile)
+	err = ioutil.WriteFile(fileName, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fileName, func() { os.RemoveAll(dir) }
+}
+
+func TestConfigInvalidValues(t *testing.T) {
+	fileName, cleanup := writeTempConfig(t, "port=abc\nslowLogFactor=0\nfastLogSize=10\n")
+	defer cleanup()
+	_, err := LoadConfiguration(fileName, nil)
+	assertTrue(t, "Expected error on invalid integer", err != nil)
+	assertTrue(t, "Error shall mention port", strings.Contains(err.Error(), "port"))
+
+	fileName2, cleanup2 := writeTempConfig(t, "slowLogFactor=0\nfastLogSize=0\n")
+	defer cleanup2()
+	_, err = LoadConfiguration(fileName2, nil)
+	assertTrue(t, "Expected error on zero values", err != nil)
+	assertTrue(t, "Error shall mention slowLogFactor", strings.Contains(err.Error(), "slowLogFactor"))
+	assertTrue(t, "Error shall mention fastLogSize", strings.Contains(err.Error(), "fastLogSize"))
+
+	fileName3, cleanup3 := writeTempConfig(t, "fastLogTimeMS=100\n")
+	defer cleanup3()
+	_, err = LoadConfiguration(fileName3, nil)
+	assertTrue(t, "Expected error on unknown parameter", err != nil)
+}
+
+func TestConfigOverrides(t *testing.T) {
+	fileName, cleanup := writeTempConfig(t, "port=1000\nfastLogTimeMs=2000\nslowLogFactor=5\n")
+	defer cleanup()
+	assertEqualsStr(t, "Environment name", "PLM_FAST_LOG_TIME_MS", EnvironmentName("fastLogTimeMs"))
+	os.Setenv("PLM_FAST_LOG_TIME_MS", "500")
+	os.Setenv("PLM_SLOW_LOG_FACTOR", "7")
+	defer os.Unsetenv("PLM_FAST_LOG_TIME_MS")
+	defer os.Unsetenv("PLM_SLOW_LOG_FACTOR")
+
+	flagSet := flag.NewFlagSet("plm", flag.ContinueOnError)
+	flags := RegisterFlags(flagSet)
+	err := flagSet.Parse([]string{"-slowLogFactor", "9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfiguration(fileName, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqualsInt(t, "config.Port", 1000, config.Port)
+	assertEqualsInt(t, "config.FastLogTimeMs", 500, config.FastLogTimeMs)
+	assertEqualsInt(t, "config.SlowLogFactor", 9, config.SlowLogFactor)
+	assertEqualsInt(t, "config.FastLogSize", 1200, config.FastLogSize)
+	assertEqualsStr(t, "Source of port", fileName, config.Source("port"))
+	assertEqualsStr(t, "Source of fastLogTimeMs", SourceEnvironment, config.Source("fastLogTimeMs"))
+	assertEqualsStr(t, "Source of slowLogFactor", SourceCommandLine, config.Source("slowLogFactor"))
+	assertEqualsStr(t, "Source of fastLogSize", SourceDefault, config.Source("fastLogSize"))
+	assertTrue(t, "Describe lists source", strings.Contains(config.Describe(), "(environment)"))
+	lines := strings.Split(strings.TrimSpace(config.Describe()), "\n")
+	for _, line := range lines {
+		assertEqualsInt(t, "Aligned: "+line, strings.Index(lines[0], " = "), strings.Index(line, " = "))
+	}
+
+	// Invalid environment value
+	os.Setenv("PLM_FAST_LOG_TIME_MS", "fast")
+	_, err = LoadConfiguration(fileName, flags)
+	assertTrue(t, "Expected error on invalid environment value", err != nil)
+	assertTrue(t, "Error shall mention source", strings.Contains(err.Error(), SourceEnvironment))
 }
 
 func TestLoadProperties(t *testing.T) {
@@ -59,3 +136,130 @@ func TestLoadPropertiesInvalidFile(t *testing.T) {
 	}
 	assertEqualsInt(t, "Size of properties", 0, len(properties))
 }
+
+func TestSaveConfiguration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, DefaultConfigFile)
+	original, err := ioutil.ReadFile(defaultConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(fileName, original, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfiguration(fileName, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := config.Clone()
+	config.FastLogTimeMs = 1000
+	config.SlowLogSize = 20
+	config.PushBufferSize = 50
+	config.MarkChanged(old)
+	err = config.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err = LoadConfiguration(fileName, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqualsInt(t, "config.Port", 12124, config.Port)
+	assertEqualsInt(t, "config.FastLogTimeMs", 1000, config.FastLogTimeMs)
+	assertEqualsInt(t, "config.SlowLogFactor", 10, config.SlowLogFactor)
+	assertEqualsInt(t, "config.FastLogSize", 600, config.FastLogSize)
+	assertEqualsInt(t, "config.SlowLogSize", 20, config.SlowLogSize)
+	assertEqualsInt(t, "config.PushBufferSize", 50, config.PushBufferSize)
+
+	// Comments shall be preserved and default values not written
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTrue(t, "Comments preserved", strings.Contains(string(b), "# Network port"))
+	assertTrue(t, "Defaults not written", !strings.Contains(string(b), "\ncgroupRoot=") &&
+		!strings.Contains(string(b), "\nreadToken="))
+	assertTrue(t, "Changed default written", strings.Contains(string(b), "\npushBufferSize=50"))
+}
+
+func TestSavePropertyFileNewFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "new.properties")
+	err = SavePropertyFile(fileName, map[string]string{"b": "2", "a": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	properties, err := LoadPropertyFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqualsInt(t, "Size of properties", 2, len(properties))
+	assertEqualsStr(t, "Value of property a", "1", properties["a"])
+	assertEqualsStr(t, "Value of property b", "2", properties["b"])
+
+	err = SavePropertyFile(filepath.Join(dir, "nodir", "x"), map[string]string{"a": "1"})
+	assertTrue(t, "Expected error when saving to invalid path", err != nil)
+}
+
+func TestValidateConfiguration(t *testing.T) {
+	config := DefaultConfiguration()
+	assertTrue(t, "Default configuration valid", config.Validate() == nil)
+	config.SlowLogFactor = 0
+	assertTrue(t, "Zero slowLogFactor invalid", config.Validate() != nil)
+	config.Port = 70000
+	err := config.Validate()
+	assertTrue(t, "All problems reported", strings.Contains(err.Error(), "port") && strings.Contains(err.Error(), "slowLogFactor"))
+
+	config = DefaultConfiguration()
+	config.TLSCertFile = "cert.pem"
+	assertTrue(t, "TLS certificate without key invalid", config.Validate() != nil)
+	config.TLSKeyFile = "key.pem"
+	assertTrue(t, "TLS certificate and key valid", config.Validate() == nil)
+	config.ReadToken = "secret"
+	assertTrue(t, "Read token without write token invalid", config.Validate() != nil)
+	config.WriteToken = "secret2"
+	assertTrue(t, "Read and write token valid", config.Validate() == nil)
+	assertTrue(t, "Secrets not described", !strings.Contains(config.Describe(), "secret"))
+
+	config = DefaultConfiguration()
+	config.RedactPatterns = []string{"("}
+	assertTrue(t, "Invalid redact pattern", config.Validate() != nil)
+
+	config = DefaultConfiguration()
+	config.ExcludeProcesses = []string{"user:"}
+	config.MinProcessMemory = -1
+	err = config.Validate()
+	assertTrue(t, "Invalid process filter", err != nil &&
+		strings.Contains(err.Error(), "excludeProcesses: pattern user: must include the owner") &&
+		strings.Contains(err.Error(), "minProcessMemory must be at least 0, got -1"))
+}
+
+func TestConfigLists(t *testing.T) {
+	fileName, cleanup := writeTempConfig(t, "redactPatterns=key=(\\S+); -k (\\S+)\nredactDefaults=false\nhideCommandLine=*\nexcludeProcesses=svchost.exe; user:root\nminProcessMemory=1024\n")
+	defer cleanup()
+	config, err := LoadConfiguration(fileName, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqualsInt(t, "Number of redact patterns", 2, len(config.RedactPatterns))
+	assertEqualsStr(t, "Second redact pattern", "-k (\\S+)", config.RedactPatterns[1])
+	assertTrue(t, "Redact defaults", !config.RedactDefaults)
+	assertEqualsInt(t, "Number of hide command line", 1, len(config.HideCommandLine))
+	assertEqualsStr(t, "Second exclude", "user:root", config.ExcludeProcesses[1])
+	assertEqualsInt(t, "Min process memory", 1024, config.MinProcessMemory)
+
+	fileName2, cleanup2 := writeTempConfig(t, "redactDefaults=maybe\n")
+	defer cleanup2()
+	_, err = LoadConfiguration(fileName2, nil)
+	assertTrue(t, "Expected error on invalid boolean", err != nil)
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"path/filepath"
@@ -13,6 +16,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/midstar/plm/monitor"
 )
 
 type version struct {
@@ -23,23 +28,34 @@ type version struct {
 
 // HTTPServer represents the HTTP server
 type HTTPServer struct {
-	measurement *Measurement
+	measurement *monitor.Measurement
+	aggregator  *Aggregator
+	collector   *Collector     // nil if push is not accepted
+	config      *Configuration // Use configMutex for read/write
+	configMutex sync.Mutex
 	server      *http.Server
 	fm          *template.FuncMap
 	basePath    string
 	tags        map[string]time.Time // Use tagsMutext for read/write
 	tagsMutex   sync.Mutex
+	runs        map[string]*Run // Use runsMutex for read/write
+	runsMutex   sync.Mutex
 	ver         version
 }
 
 // CreateHTTPServer creates the HTTP server. Start it with Start.
-func CreateHTTPServer(basePath string, port int, measurement *Measurement) *HTTPServer {
+func CreateHTTPServer(basePath string, config *Configuration, measurement *monitor.Measurement) *HTTPServer {
 	funcMap := &template.FuncMap{
 		// Convert KB to MB only keep one decimal
 		"kb_to_mb": func(kb uint32) string {
 			return fmt.Sprintf("%.1f", float64(kb)/1024.0)
 		},
 
+		// Convert KB to MB only keep one decimal
+		"float_kb_to_mb": func(kb float64) string {
+			return fmt.Sprintf("%.1f", kb/1024.0)
+		},
+
 		// Convert KB to MB only keep one decimal
 		"int_to_str": func(v int) string {
 			return fmt.Sprintf("%d", v)
@@ -55,29 +71,76 @@ func CreateHTTPServer(basePath string, port int, measurement *Measurement) *HTTP
 		},
 
 		// Log utulization in %
-		"log_utilization": func(log Logger) int {
+		"log_utilization": func(log monitor.Logger) int {
 			return int(float64(log.NbrRows*100) / float64(log.MaxRows))
 		}}
-	portStr := fmt.Sprintf(":%d", port)
-	srv := &http.Server{Addr: portStr}
+	address := net.JoinHostPort(config.BindAddress, strconv.Itoa(config.Port))
+	srv := &http.Server{Addr: address}
 	server := &HTTPServer{
 		basePath:    basePath,
 		measurement: measurement,
+		config:      config,
+		configMutex: sync.Mutex{},
 		server:      srv,
 		fm:          funcMap,
 		tags:        make(map[string]time.Time),
 		tagsMutex:   sync.Mutex{},
+		runs:        make(map[string]*Run),
 		ver: version{
 			Version:   applicationVersion,
 			BuildTime: applicationBuildTime,
 			GitHash:   applicationGitHash}}
 
-	http.Handle("/", server)
+	agents, _ := ParseAgents(config.Agents) // Already validated
+	server.aggregator = CreateAggregator(server, config.HostName, agents, config.AgentToken)
+	if config.AcceptPush {
+		server.collector = CreateCollector(server)
+	}
+	srv.Handler = server
 	return server
 }
 
+// serveOtherHost answers GET requests with the host query parameter set to
+// a host pushing its measurements to this instance, using the measurements
+// of that host. Other hosts, such as agents, are only accepted by the
+// aggregated resources of the REST API. Returns false if the request is
+// for this host.
+func (s *HTTPServer) serveOtherHost(w http.ResponseWriter, r *http.Request) bool {
+	host := r.URL.Query().Get("host")
+	if host == "" || host == s.aggregator.LocalName() || strings.HasPrefix(r.URL.Path, APIv1Prefix+"aggregate/") {
+		return false
+	}
+	if s.collector != nil && r.Method == http.MethodGet {
+		if server := s.collector.hostServer(host); server != nil {
+			server.ServeHTTP(w, r)
+			return true
+		}
+	}
+	message := fmt.Sprintf("Invalid parameter host %s. Only hosts pushing to this instance can be queried "+
+		"(GET), use %saggregate for agents", host, APIv1Prefix)
+	if strings.HasPrefix(r.URL.Path, APIv1Prefix) {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, message)
+	} else {
+		http.Error(w, message, http.StatusBadRequest)
+	}
+	return true
+}
+
 // ServeHTTP handles incoming HTTP requests
 func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == strings.TrimSuffix(APIv1Prefix, "/") {
+		r.URL.Path = APIv1Prefix // Answer with JSON errors also without the trailing slash
+	}
+	if !s.authorize(w, r) {
+		return
+	}
+	if s.serveOtherHost(w, r) {
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, APIv1Prefix) {
+		s.serveAPIv1(w, r)
+		return
+	}
 	segments := strings.Split(r.URL.Path, "/")
 	req := fmt.Sprintf("%s %s", r.Method, segments[1])
 	switch req {
@@ -85,6 +148,13 @@ func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		s.serveHTTPIndex(w)
 	case "GET processes":
 		s.serveHTTPListProcesses(w, r.URL.Query())
+	case "GET process":
+		if len(segments) < 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "No UID provided")
+		} else {
+			s.serveHTTPProcess(w, segments[2], r.URL.Query())
+		}
 	case "GET ram":
 		s.serveHTTPGetRAM(w)
 	case "GET plot":
@@ -109,67 +179,113 @@ func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	case "GET tags":
 		s.serveHTTPGetTags(w)
+	case "GET runs":
+		s.serveHTTPRuns(w)
+	case "GET compare":
+		s.serveHTTPCompare(w, r.URL.Query())
 	case "GET version":
 		s.serveHTTPGetVersion(w)
+	case "GET config":
+		s.serveHTTPGetConfig(w)
+	case "PUT config":
+		s.serveHTTPPutConfig(w, r)
 	default:
 		w.WriteHeader(http.StatusNotFound)
 		fmt.Fprintf(w, "This is not a valid path: %s or method %s!", r.URL.Path, r.Method)
 	}
 }
 
+// authorize checks the credentials of the request. If the read token is
+// configured, GET requests require the read or the write token. If the
+// write token is configured, all other requests (creating tags, changing
+// configuration) require the write token.
+//
+// The token is given either as a bearer token or as the password using
+// basic authentication (the user name is ignored), which allows browsers
+// to access the user interface.
+//
+// Returns false, and writes the response, if the request is not authorized.
+func (s *HTTPServer) authorize(w http.ResponseWriter, r *http.Request) bool {
+	s.configMutex.Lock()
+	readToken := s.config.ReadToken
+	writeToken := s.config.WriteToken
+	s.configMutex.Unlock()
+
+	token := ""
+	if _, password, hasBasic := r.BasicAuth(); hasBasic {
+		token = password
+	} else if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	canWrite := writeToken == "" || tokenEquals(token, writeToken)
+	canRead := readToken == "" || canWrite || tokenEquals(token, readToken)
+
+	// Diffing a snapshot only reads data even though the snapshot is posted
+	readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead ||
+		(r.Method == http.MethodPost && r.URL.Path == APIv1Prefix+"snapshot/diff")
+	if readOnly {
+		if canRead {
+			return true
+		}
+	} else if canWrite {
+		return true
+	}
+	if !tokenEquals(token, readToken) {
+		// No or invalid credentials
+		w.Header().Set("WWW-Authenticate", `Basic realm="Process Load Monitor"`)
+		writeError(w, r, http.StatusUnauthorized, ErrorCodeUnauthorized, "Authentication required")
+		return false
+	}
+	writeError(w, r, http.StatusForbidden, ErrorCodeForbidden, "Not permitted to "+r.Method+" "+r.URL.Path)
+	return false
+}
+
+// tokenEquals compares a provided token with an expected token in constant
+// time. An empty expected token never matches.
+func tokenEquals(token string, expected string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
 // getFromTo is a function that identifies if the URL includes any of following
 // query parameters:
 //  - from (restrict result from time in RFC3339 format)
 //  - to (restruct result to time in RFC3339 format)
 //  - fromTag (as from but use a tag)
 //  - toTag (as to but use tag)
+//  - run (start and end of a run, cannot be combined with the above)
+//
+// All of from, to, fromTag and toTag accept time expressions, such as
+// START_TEST+30s or -15m (see resolveTime).
 //
 // If the above is not given the zero (default) time is returned.
 //
 // Returns:
 // (from, to, error)
 func (s *HTTPServer) getFromTo(values url.Values) (time.Time, time.Time, error) {
-	from := time.Time{} // Zero
-	to := time.Time{}   // Zero
-	var err error
+	from, to, hasRun, err := s.getRunFromTo(values)
+	if hasRun {
+		return from, to, err
+	}
 
 	fromStr, hasElement := values["from"]
+	if !hasElement {
+		fromStr, hasElement = values["fromTag"]
+	}
 	if hasElement {
-		from, err = time.Parse(time.RFC3339, fromStr[0])
+		from, err = s.resolveTime(fromStr[0])
 		if err != nil {
-			return from, to, fmt.Errorf("Invalid parameter from %s. Reason: %s", fromStr[0], err)
-		}
-	} else {
-		var fromTagStr []string
-		fromTagStr, hasElement = values["fromTag"]
-		if hasElement {
-			s.tagsMutex.Lock()
-			var hasTag bool
-			from, hasTag = s.tags[fromTagStr[0]]
-			s.tagsMutex.Unlock()
-			if !hasTag {
-				return from, to, fmt.Errorf("Invalid tag: %s", fromTagStr[0])
-			}
+			return from, to, fmt.Errorf("Invalid parameter from. Reason: %s", err)
 		}
 	}
 
 	toStr, hasElement := values["to"]
+	if !hasElement {
+		toStr, hasElement = values["toTag"]
+	}
 	if hasElement {
-		to, err = time.Parse(time.RFC3339, toStr[0])
+		to, err = s.resolveTime(toStr[0])
 		if err != nil {
-			return from, to, fmt.Errorf("Invalid parameter to %s. Reason: %s", toStr[0], err)
-		}
-	} else {
-		var toTagStr []string
-		toTagStr, hasElement = values["toTag"]
-		if hasElement {
-			s.tagsMutex.Lock()
-			var hasTag bool
-			to, hasTag = s.tags[toTagStr[0]]
-			s.tagsMutex.Unlock()
-			if !hasTag {
-				return from, to, fmt.Errorf("Invalid tag: %s", toTagStr[0])
-			}
+			return from, to, fmt.Errorf("Invalid parameter to. Reason: %s", err)
 		}
 	}
 
@@ -180,35 +296,64 @@ func (s *HTTPServer) getFromTo(values url.Values) (time.Time, time.Time, error)
 // query parameters:
 //  - uids (list of uids, example uids=12,42,1234)
 //  - match (match text, example match=myprocess.exe)
+//  - pid (processes with PID alive during the period given by getFromTo,
+//    example pid=1234). Add descendants=true to include their children,
+//    grand children etc.
 //
 // If none of the above query pararameters where listed it is assumed that all
 // UIDs shall be used.
 //
 // It is not possible to combine the above parameters.
 //
+// If the run query parameter is given, only the processes alive during the
+// run are included.
+//
 // Returns a list of uids and error.
 func (s *HTTPServer) getUIDs(values url.Values) ([]int, error) {
+	from, to, hasRun, err := s.getRunFromTo(values)
+	if err != nil {
+		return nil, err
+	}
+
 	// First check query parameter
 	uids, err := parseQueryUIDs(values)
 	if err != nil {
 		return uids, err
 	}
-	if uids != nil {
-		return uids, nil
-	}
 
 	// If not given, check the match parameter
-	uids = s.parseQueryMatch(values)
-	if uids != nil {
-		return uids, nil
+	if uids == nil {
+		uids = s.parseQueryMatch(values)
+	}
+
+	// If not given, check the pid parameter
+	if uids == nil {
+		uids, err = s.parseQueryPid(values)
+		if err != nil {
+			return uids, err
+		}
 	}
 
-	// If none given, return all uids
 	s.measurement.Mutex.Lock()
 	defer s.measurement.Mutex.Unlock()
-	uids = make([]int, 0, len(s.measurement.PM.All))
-	for uid := range s.measurement.PM.All {
-		uids = append(uids, uid)
+
+	// If none given, use all uids
+	if uids == nil {
+		uids = make([]int, 0, len(s.measurement.PM.All))
+		for uid := range s.measurement.PM.All {
+			uids = append(uids, uid)
+		}
+	}
+
+	if hasRun {
+		observed := make([]int, 0, len(uids))
+		for _, uid := range uids {
+			process, hasElement := s.measurement.PM.All[uid]
+			if hasElement && isObserved(process, from, to) {
+				observed = append(observed, uid)
+			}
+		}
+		uids = observed
 	}
 
 	return uids, nil
@@ -264,14 +409,47 @@ func (s *HTTPServer) parseQueryMatch(values url.Values) []int {
 	return uids
 }
 
+// parseQueryPid parses the pid and descendants query parameters and
+// returns the UIDs of the processes. If the pid parameter is not provided
+// nil will be returned.
+func (s *HTTPServer) parseQueryPid(values url.Values) ([]int, error) {
+	pidStr, hasElement := values["pid"]
+	if !hasElement {
+		return nil, nil
+	}
+	pid, err := strconv.ParseUint(pidStr[0], 10, 32)
+	if err != nil {
+		return make([]int, 0), fmt.Errorf("Invalid parameter pid. PID %s is not a valid integer", pidStr[0])
+	}
+	descendants := false
+	if descendantsStr := values.Get("descendants"); descendantsStr != "" {
+		descendants, err = strconv.ParseBool(descendantsStr)
+		if err != nil {
+			return make([]int, 0), fmt.Errorf("Invalid parameter descendants %s. Shall be true or false", descendantsStr)
+		}
+	}
+	from, to, err := s.getFromTo(values)
+	if err != nil {
+		return make([]int, 0), err
+	}
+
+	s.measurement.Mutex.Lock()
+	defer s.measurement.Mutex.Unlock()
+	uids := make([]int, 0)
+	for uid, process := range s.measurement.PM.All {
+		if process.Pid == uint32(pid) && isObserved(process, from, to) {
+			uids = append(uids, uid)
+		}
+	}
+	if descendants {
+		uids = s.measurement.PM.GetDescendants(uids)
+	}
+	return uids, nil
+}
+
 // serveHTTPGetMinMaxMem returns the highest and lowest memory consumption
 // during a specific time
 func (s *HTTPServer) serveHTTPGetMinMaxMem(w http.ResponseWriter, values url.Values) {
-	type ProcessMinMaxMem struct {
-		Process
-		MaxMemoryInPeriod uint32 // Maximum memory during period (KB)
-		MinMemoryInPeriod uint32 // Minimum memory during period(KB)
-	}
 	uids, err := s.getUIDs(values)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -282,30 +460,7 @@ func (s *HTTPServer) serveHTTPGetMinMaxMem(w http.ResponseWriter, values url.Val
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	measurements := s.measurement.GetProcessMeasurementsBetween(uids, from, to) // Thread safe
-	s.measurement.Mutex.Lock()
-	defer s.measurement.Mutex.Unlock()
-	result := make([]ProcessMinMaxMem, 0, len(measurements.Memory))
-	for uid, values := range measurements.Memory {
-		process, hasElement := s.measurement.PM.All[uid]
-		if hasElement {
-			p := ProcessMinMaxMem{
-				Process:           *process,
-				MaxMemoryInPeriod: 0,
-				MinMemoryInPeriod: 4294967295} // = 2 ^ 32 - 1
-			for _, value := range values {
-				if value > p.MaxMemoryInPeriod {
-					p.MaxMemoryInPeriod = value
-				}
-				if value < p.MinMemoryInPeriod {
-					p.MinMemoryInPeriod = value
-				}
-			}
-			result = append(result, p)
-		}
-	}
-	js, err := json.Marshal(result)
-
+	js, err := json.Marshal(s.measurement.GetMinMaxMem(uids, from, to))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -335,6 +490,26 @@ func (s *HTTPServer) serveHTTPMeasurements(w http.ResponseWriter, values url.Val
 	w.Write(js)
 }
 
+// DefaultPlotPoints is the highest number of values of each series in a
+// plot, unless the points parameter is given
+const DefaultPlotPoints = 1000
+
+// SecondaryPhysical is the value of the secondary parameter of the plot
+// that plots the used physical memory on the secondary y axis
+const SecondaryPhysical = "physical"
+
+// metricTitles are the titles of the y axis when a metric is plotted
+var metricTitles = map[string]string{
+	monitor.MetricMemory:         "Memory (MB)",
+	monitor.MetricFDs:            "File descriptors",
+	monitor.MetricThreads:        "Threads",
+	monitor.MetricReadBytes:      "Read (bytes/s)",
+	monitor.MetricWriteBytes:     "Written (bytes/s)",
+	monitor.MetricDiskReadBytes:  "Read from disk (bytes/s)",
+	monitor.MetricDiskWriteBytes: "Written to disk (bytes/s)",
+	monitor.MetricReadOps:        "Read operations/s",
+	monitor.MetricWriteOps:       "Write operations/s"}
+
 func (s *HTTPServer) serveHTTPPlot(w http.ResponseWriter, values url.Values) {
 	uids, err := s.getUIDs(values)
 	if err != nil {
@@ -346,29 +521,93 @@ func (s *HTTPServer) serveHTTPPlot(w http.ResponseWriter, values url.Values) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	metric, err := getMetric(values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	points, err := getPoints(values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if points == 0 {
+		points = DefaultPlotPoints
+	}
+	secondary := values.Get("secondary")
+	if err = monitor.CheckMetric(secondary); err != nil && secondary != SecondaryPhysical {
+		http.Error(w, fmt.Sprintf("Invalid parameter secondary %s", secondary), http.StatusBadRequest)
+		return
+	}
 	templateFile := filepath.Join(s.basePath, "templates", "plot.gohtml")
 	t, err := template.New("").Funcs(*s.fm).ParseFiles(templateFile)
 	if err != nil {
 		http.Error(w, "Create template: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	type MeasAndProcesses struct {
-		Measurements *ProcessMeasurements
-		Processes    map[int]*Process
-	}
-	measAndProcesses := MeasAndProcesses{Processes: make(map[int]*Process)}
-	measAndProcesses.Measurements = s.measurement.GetProcessMeasurementsBetween(uids, from, to) // Thread safe
-	s.measurement.Mutex.Lock()
-	for uid := range measAndProcesses.Measurements.Memory {
-		measAndProcesses.Processes[uid] = s.measurement.PM.All[uid]
-	}
-	err = t.ExecuteTemplate(w, "plot.gohtml", measAndProcesses)
-	s.measurement.Mutex.Unlock()
+	// The data is embedded in the page, so that a saved plot (see plmc plot)
+	// works without the server. The page fetches the data again from the
+	// REST API when a time range is selected.
+	type plotData struct {
+		Metric                string
+		Secondary             string                      // Metric of the secondary y axis, SecondaryPhysical or empty
+		Titles                map[string]string           // Titles of the metrics
+		YTitle                string                      // Title of the y axis
+		Others                bool                        // Plot the memory of the processes not tracked
+		UIDs                  []int                       // Processes to plot
+		Processes             map[int]plotProcess         // Keyed on UID
+		From, To              time.Time                   // Zero if not restricted
+		Points                int                         // Highest number of values of each series
+		Measurements          Measurements                // The metric, downsampled to Points
+		SecondaryMeasurements *Measurements               // Only set if Secondary is a metric
+		System                *monitor.SystemMeasurements // Only set if Secondary is SecondaryPhysical
+	}
+	d := plotData{Metric: metric, Secondary: secondary, Titles: metricTitles, YTitle: metricTitles[metric],
+		Others: values.Get("others") == "true" && metric == monitor.MetricMemory,
+		UIDs:   make([]int, 0, len(uids)), From: from, To: to, Points: points}
+	d.Measurements = s.getMeasurements(uids, metric, from, to) // Thread safe
+	d.Measurements.downsample(points)
+	for _, series := range d.Measurements.Series {
+		d.UIDs = append(d.UIDs, series.UID)
+	}
+	d.Processes = s.getPlotProcesses(d.UIDs)
+	if secondary == SecondaryPhysical {
+		d.System = s.measurement.GetSystemMeasurementsBetween(from, to) // Thread safe
+		d.System.Downsample(points)
+	} else if secondary != "" {
+		m := s.getMeasurements(d.UIDs, secondary, from, to)
+		m.downsample(points)
+		d.SecondaryMeasurements = &m
+	}
+	err = t.ExecuteTemplate(w, "plot.gohtml", d)
 	if err != nil {
 		http.Error(w, "Execute template: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+}
+
+// plotProcess is the name and command line of a plotted process
+type plotProcess struct {
+	Name        string
+	CommandLine string
+}
 
+// getPlotProcesses returns the plotted processes keyed on UID. A process
+// removed after it was measured (see RemoveOldProcesses) is named by its
+// UID.
+func (s *HTTPServer) getPlotProcesses(uids []int) map[int]plotProcess {
+	s.measurement.Mutex.Lock()
+	defer s.measurement.Mutex.Unlock()
+	processes := make(map[int]plotProcess, len(uids))
+	for _, uid := range uids {
+		process, hasElement := s.measurement.PM.All[uid]
+		if hasElement {
+			processes[uid] = plotProcess{Name: process.Name, CommandLine: process.CommandLine}
+		} else {
+			processes[uid] = plotProcess{Name: fmt.Sprintf("UID %d", uid)}
+		}
+	}
+	return processes
 }
 
 func (s *HTTPServer) serveHTTPIndex(w http.ResponseWriter) {
@@ -379,12 +618,16 @@ func (s *HTTPServer) serveHTTPIndex(w http.ResponseWriter) {
 		return
 	}
 	type data struct {
-		*Measurement
+		*monitor.Measurement
 		*version
+		Hosts []HostStatus // Only set if there are agents
 	}
 	d := data{
 		Measurement: s.measurement,
 		version:     &s.ver}
+	if s.aggregator.HasAgents() {
+		d.Hosts = s.aggregator.Statuses()
+	}
 	s.measurement.Mutex.Lock()
 	err = t.ExecuteTemplate(w, "index.gohtml", d)
 	s.measurement.Mutex.Unlock()
@@ -394,6 +637,60 @@ func (s *HTTPServer) serveHTTPIndex(w http.ResponseWriter) {
 	}
 }
 
+// serveHTTPProcess shows the details of one process: its lifecycle and
+// statistics of its memory between from and to (if given)
+func (s *HTTPServer) serveHTTPProcess(w http.ResponseWriter, id string, values url.Values) {
+	uid, err := strconv.Atoi(id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("UID %s is not a valid integer", id), http.StatusBadRequest)
+		return
+	}
+	from, to, err := s.getFromTo(values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	templateFile := filepath.Join(s.basePath, "templates", "process.gohtml")
+	t, err := template.New("").Funcs(*s.fm).ParseFiles(templateFile)
+	if err != nil {
+		http.Error(w, "Create template: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	type data struct {
+		*version
+		Process  monitor.Process
+		Parent   *monitor.Process // Only set if the parent is still alive
+		Events   []Event
+		Stats    monitor.Stats
+		From, To string // The from and to parameters, passed on to the plot
+	}
+	d := data{version: &s.ver, From: values.Get("from"), To: values.Get("to")}
+	s.measurement.Mutex.Lock()
+	process, hasElement := s.measurement.PM.All[uid]
+	if hasElement {
+		d.Process = *process
+		parent, hasParent := s.measurement.PM.Alive[process.ParentPid]
+		if hasParent && !parent.Created.After(process.Created) { // Not a reused PID
+			p := *parent
+			d.Parent = &p
+		}
+	}
+	s.measurement.Mutex.Unlock()
+	if !hasElement {
+		http.Error(w, fmt.Sprintf("Process with UID %d not found", uid), http.StatusNotFound)
+		return
+	}
+	d.Events = s.getEvents([]int{uid}, time.Time{}, time.Time{})
+	if stats := s.measurement.GetStats([]int{uid}, from, to); len(stats) > 0 { // Thread safe
+		d.Stats = stats[0].Stats
+	}
+	err = t.ExecuteTemplate(w, "process.gohtml", d)
+	if err != nil {
+		http.Error(w, "Execute template: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 func (s *HTTPServer) serveHTTPListProcesses(w http.ResponseWriter, values url.Values) {
 
 	uids, err := s.getUIDs(values)
@@ -405,7 +702,7 @@ func (s *HTTPServer) serveHTTPListProcesses(w http.ResponseWriter, values url.Va
 	s.measurement.Mutex.Lock()
 	defer s.measurement.Mutex.Unlock()
 
-	processes := make(map[int]*Process)
+	processes := make(map[int]*monitor.Process)
 	for _, uid := range uids {
 		process, hasElement := s.measurement.PM.All[uid]
 		if hasElement {
@@ -434,10 +731,23 @@ func (s *HTTPServer) serveHTTPGetRAM(w http.ResponseWriter) {
 	w.Write(js)
 }
 
-func (s *HTTPServer) serveHTTPPostTag(w http.ResponseWriter, tagName string) {
+// setTag sets a tag to the current time. The tag is also set on all agents
+// (if any). Returns the tag time.
+func (s *HTTPServer) setTag(tagName string) time.Time {
 	s.tagsMutex.Lock()
-	defer s.tagsMutex.Unlock()
-	s.tags[tagName] = time.Now()
+	t := time.Now()
+	s.tags[tagName] = t
+	s.tagsMutex.Unlock()
+	if s.aggregator.HasAgents() {
+		// In the background, so that a slow agent doesn't delay the
+		// response. Failures are logged.
+		go s.aggregator.SetTag(tagName)
+	}
+	return t
+}
+
+func (s *HTTPServer) serveHTTPPostTag(w http.ResponseWriter, tagName string) {
+	s.setTag(tagName)
 }
 
 func (s *HTTPServer) serveHTTPGetTag(w http.ResponseWriter, tagName string) {
@@ -480,10 +790,86 @@ func (s *HTTPServer) serveHTTPGetVersion(w http.ResponseWriter) {
 	w.Write(js)
 }
 
+func (s *HTTPServer) serveHTTPGetConfig(w http.ResponseWriter) {
+	s.configMutex.Lock()
+	defer s.configMutex.Unlock()
+	js, err := json.Marshal(s.config)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(js)
+}
+
+// putConfig changes the configuration without restarting PLM. The body is
+// a JSON object with the configuration parameters to change. Omitted
+// parameters keep their current values. The new configuration is applied to
+// the measurement and written back to the configuration file.
+//
+// Returns the new configuration. The error is a *httpError.
+func (s *HTTPServer) putConfig(body io.Reader) (*Configuration, error) {
+	s.configMutex.Lock()
+	defer s.configMutex.Unlock()
+	newConfig := s.config.Clone()
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields() // Report misspelled keys, for example from plmc config
+	err := decoder.Decode(newConfig)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, ErrorCodeInvalidBody, "Invalid configuration. Reason: %s", err)
+	}
+	err = newConfig.CheckRuntimeChange(s.config)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, ErrorCodeInvalidBody, "%s", err)
+	}
+	err = newConfig.Validate()
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, ErrorCodeInvalidBody, "%s", err)
+	}
+	s.measurement.Reconfigure(newConfig.FastLogSize, newConfig.SlowLogSize,
+		newConfig.FastLogTimeMs, newConfig.SlowLogFactor) // Thread safe
+	newConfig.MarkChanged(s.config)
+	*s.config = *newConfig
+	log.Printf("Configuration changed:\n%s", s.config.Describe())
+	err = s.config.Save()
+	if err != nil {
+		return nil, newHTTPError(http.StatusInternalServerError, ErrorCodeInternal,
+			"Configuration applied but not saved. Reason: %s", err)
+	}
+	return s.config.Clone(), nil
+}
+
+func (s *HTTPServer) serveHTTPPutConfig(w http.ResponseWriter, r *http.Request) {
+	config, err := s.putConfig(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), err.(*httpError).status)
+		return
+	}
+	js, err := json.Marshal(config)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(js)
+}
+
 // Start starts the HTTP server. Stop it using the Stop function.
+//
+// HTTPS is used if a TLS certificate and key is configured.
 func (s *HTTPServer) Start() {
+	s.configMutex.Lock()
+	certFile := s.config.TLSCertFile
+	keyFile := s.config.TLSKeyFile
+	s.configMutex.Unlock()
 	go func() {
-		if err := s.server.ListenAndServe(); err != nil {
+		var err error
+		if certFile != "" {
+			err = s.server.ListenAndServeTLS(certFile, keyFile)
+		} else {
+			err = s.server.ListenAndServe()
+		}
+		if err != nil {
 			// cannot panic, because this probably is an intentional close
 			log.Printf("Httpserver: ListenAndServe() shutdown reason: %s", err)
 		}
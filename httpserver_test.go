@@ -2,16 +2,27 @@ package main
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/big"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/midstar/plm/monitor"
 	"github.com/midstar/proci"
 )
 
@@ -33,23 +44,36 @@ func TestHttpServer(t *testing.T) {
 
 	// Creata a Measurement object and generate some data
 	pMock := proci.GenerateMock(10)
-	m := CreateMeasurement(3, 6, 3, 6, pMock)
+	m := monitor.CreateMeasurement(3, 6, 3, 6, pMock)
+
+	// Use a temporary configuration file, since the configuration might be
+	// written back
+	configDir, err := ioutil.TempDir("", "plm")
+	if err != nil {
+		t.Fatal("Unable to create temporary directory. Reason: ", err)
+	}
+	defer os.RemoveAll(configDir)
+	configFile := filepath.Join(configDir, DefaultConfigFile)
+	config, err := LoadConfiguration(configFile, nil)
+	if err != nil {
+		t.Fatal("Unable to load configuration. Reason: ", err)
+	}
+	config.Port = port
 
 	// Create and start the HTTP server
-	httpServer := CreateHTTPServer("", port, m)
+	httpServer := CreateHTTPServer("", config, m)
 	t.Log("Starting HTTP server")
 	httpServer.Start()
 
 	// Add some measurements
-	var err error
-	m.measureAndLog(false)
+	m.MeasureAndLog(false)
 	time.Sleep(2 * time.Second) // To make time differ
 	_, err = http.Post(fmt.Sprintf("%s/tag/t1", baseURL), "", nil)
 	if err != nil {
 		t.Fatal("Unable to post tag. Reason: ", err)
 	}
 	timeStamp1 := time.Now()
-	m.measureAndLog(true)
+	m.MeasureAndLog(true)
 	time.Sleep(2 * time.Second) // To make time differ
 	timeStamp2 := time.Now()
 	_, err = http.Post(fmt.Sprintf("%s/tag/t2", baseURL), "", nil)
@@ -57,10 +81,11 @@ func TestHttpServer(t *testing.T) {
 		t.Fatal("Unable to post tag. Reason: ", err)
 	}
 	time.Sleep(2 * time.Second) // To make time differ
-	m.measureAndLog(false)
+	m.MeasureAndLog(false)
 
 	// Tests
 	testGetIndex(t, baseURL)
+	testGetProcessPage(t, baseURL)
 	testGetAllProcesses(t, baseURL)
 	testGetProcessesWithUID(t, baseURL)
 	testGetProcessesWithMatch(t, baseURL)
@@ -68,12 +93,14 @@ func TestHttpServer(t *testing.T) {
 	testGetAllRAM(t, baseURL)
 	testGetPlot(t, baseURL)
 	testGetPlotBetween(t, baseURL, timeStamp1, timeStamp2)
+	testGetPlotProcesses(t, httpServer, m)
 	testGetMeasurements(t, baseURL)
 	testGetMeasurementsBetween(t, baseURL, timeStamp1, timeStamp2)
 	testGetMinMaxMem(t, baseURL)
 	testInvalidPath(t, baseURL)
 	testTags(t, baseURL)
 	testGetVersion(t, baseURL)
+	testConfig(t, baseURL, m, config, configFile)
 
 	// Stop HTTP server
 	httpServer.Stop()
@@ -92,8 +119,33 @@ func testGetIndex(t *testing.T, baseURL string) {
 	if !strings.Contains(respString, "<title>Process Load Monitor</title>") {
 		t.Fatal("Index html title missing")
 	}
-	if !strings.Contains(respString, "path_5") {
-		t.Fatal("Processes are missing")
+	if !strings.Contains(respString, "<table id=\"processtable\">") {
+		t.Fatal("Process explorer is missing")
+	}
+}
+
+// Called from TestHttpServer
+func testGetProcessPage(t *testing.T, baseURL string) {
+	resp, err := http.Get(fmt.Sprintf("%s/process/5?from=t1", baseURL))
+	if err != nil {
+		t.Fatal("Process page not loaded. Reason: ", err)
+	}
+	assertEqualsInt(t, "Status", http.StatusOK, resp.StatusCode)
+	respString := respToString(resp.Body)
+	assertTrue(t, "Process name on process page", strings.Contains(respString, "path_"))
+	assertTrue(t, "Lifecycle on process page", strings.Contains(respString, "<td>started</td>"))
+	assertTrue(t, "Period on process page", strings.Contains(respString, "from t1"))
+
+	for path, status := range map[string]int{
+		"/process/1000":         http.StatusNotFound,
+		"/process/invalid":      http.StatusBadRequest,
+		"/process/5?from=wrong": http.StatusBadRequest,
+		"/process":              http.StatusBadRequest} {
+		resp, err = http.Get(baseURL + path)
+		if err != nil {
+			t.Fatal("Unable to get process page. Reason: ", err)
+		}
+		assertEqualsInt(t, "Status of "+path, status, resp.StatusCode)
 	}
 }
 
@@ -111,7 +163,7 @@ func testGetAllProcesses(t *testing.T, baseURL string) {
 	if err != nil {
 		t.Fatal("Unable to get processes. Reason: ", err)
 	}
-	var processes map[int]*Process
+	var processes map[int]*monitor.Process
 	err = json.Unmarshal(body, &processes)
 	if err != nil {
 		t.Fatal("Unable decode get processes. Reason: ", err)
@@ -135,7 +187,7 @@ func testGetProcessesWithUID(t *testing.T, baseURL string) {
 	if err != nil {
 		t.Fatal("Unable to get processes. Reason: ", err)
 	}
-	var processes map[int]*Process
+	var processes map[int]*monitor.Process
 	err = json.Unmarshal(body, &processes)
 	if err != nil {
 		t.Fatal("Unable decode get processes. Reason: ", err)
@@ -174,7 +226,7 @@ func testGetProcessesWithMatch(t *testing.T, baseURL string) {
 	if err != nil {
 		t.Fatal("Unable to get processes. Reason: ", err)
 	}
-	var processes map[int]*Process
+	var processes map[int]*monitor.Process
 	err = json.Unmarshal(body, &processes)
 	if err != nil {
 		t.Fatal("Unable decode get processes. Reason: ", err)
@@ -204,7 +256,7 @@ func testGetProcessesWithMultipleMatch(t *testing.T, baseURL string) {
 	if err != nil {
 		t.Fatal("Unable to get processes. Reason: ", err)
 	}
-	var processes map[int]*Process
+	var processes map[int]*monitor.Process
 	err = json.Unmarshal(body, &processes)
 	if err != nil {
 		t.Fatal("Unable decode get processes. Reason: ", err)
@@ -228,7 +280,7 @@ func testGetAllRAM(t *testing.T, baseURL string) {
 	if err != nil {
 		t.Fatal("Unable to get ram. Reason: ", err)
 	}
-	var phys PhysicalMemory
+	var phys monitor.PhysicalMemory
 	err = json.Unmarshal(body, &phys)
 	if err != nil {
 		t.Fatal("Unable decode get phys. Reason: ", err)
@@ -307,6 +359,57 @@ func testGetPlotBetween(t *testing.T, baseURL string, from time.Time, to time.Ti
 	if resp.StatusCode != http.StatusBadRequest {
 		t.Fatal("Unexpected status code: ", resp.StatusCode)
 	}
+
+	// Test other metric
+	resp, err = http.Get(fmt.Sprintf("%s/plot?metric=writeBytes", baseURL))
+	if err != nil {
+		t.Fatal("Unable to get plot. Reason: ", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("Unexpected status code: ", resp.StatusCode)
+	}
+	if !strings.Contains(respToString(resp.Body), "Written (bytes/s)") {
+		t.Fatal("Title of metric is missing")
+	}
+	resp, err = http.Get(fmt.Sprintf("%s/plot?metric=invalid", baseURL))
+	if err != nil {
+		t.Fatal("Unable to get plot. Reason: ", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatal("Unexpected status code: ", resp.StatusCode)
+	}
+
+	// Secondary axis and downsampling
+	for query, status := range map[string]int{
+		"secondary=physical&points=1": http.StatusOK,
+		"secondary=threads":           http.StatusOK,
+		"secondary=invalid":           http.StatusBadRequest,
+		"points=-1":                   http.StatusBadRequest} {
+		resp, err = http.Get(fmt.Sprintf("%s/plot?%s", baseURL, query))
+		if err != nil {
+			t.Fatal("Unable to get plot. Reason: ", err)
+		}
+		assertEqualsInt(t, "Status of plot?"+query, status, resp.StatusCode)
+		respString = respToString(resp.Body)
+		if query == "secondary=physical&points=1" {
+			assertTrue(t, "System measurements embedded", strings.Contains(respString, `"Used":[`))
+			assertTrue(t, "Downsampled", strings.Contains(respString, `"Downsampled":true`))
+		}
+		if query == "secondary=threads" {
+			assertTrue(t, "Secondary measurements embedded", strings.Contains(respString, `"Metric":"threads"`))
+		}
+	}
+}
+
+// Called from TestHttpServer
+func testGetPlotProcesses(t *testing.T, httpServer *HTTPServer, m *monitor.Measurement) {
+	uid := m.PM.Alive[1].UID
+	removedUID := 12345 // As if removed by RemoveOldProcesses after it was measured
+	processes := httpServer.getPlotProcesses([]int{uid, removedUID})
+	assertEqualsStr(t, "Name", m.PM.All[uid].Name, processes[uid].Name)
+	assertEqualsStr(t, "Removed process", "UID 12345", processes[removedUID].Name)
+	m.Mutex.Lock() // Not kept locked
+	m.Mutex.Unlock()
 }
 
 // Called from TestHttpServer
@@ -323,7 +426,7 @@ func testGetMeasurements(t *testing.T, baseURL string) {
 	if err != nil {
 		t.Fatal("Unable to get processes. Reason: ", err)
 	}
-	var measurements ProcessMeasurements
+	var measurements monitor.ProcessMeasurements
 	err = json.Unmarshal(body, &measurements)
 	if err != nil {
 		t.Fatal("Unable decode get measurements. Reason: ", err)
@@ -368,7 +471,7 @@ func testGetMeasurementsBetween(t *testing.T, baseURL string, from time.Time, to
 	if err != nil {
 		t.Fatal("Unable to get processes. Reason: ", err)
 	}
-	var measurements ProcessMeasurements
+	var measurements monitor.ProcessMeasurements
 	err = json.Unmarshal(body, &measurements)
 	if err != nil {
 		t.Fatal("Unable decode get measurements. Reason: ", err)
@@ -400,7 +503,7 @@ func testGetMeasurementsBetween(t *testing.T, baseURL string, from time.Time, to
 	if err != nil {
 		t.Fatal("Unable to get processes. Reason: ", err)
 	}
-	var measurementsTags ProcessMeasurements
+	var measurementsTags monitor.ProcessMeasurements
 	err = json.Unmarshal(body, &measurementsTags)
 	if err != nil {
 		t.Fatal("Unable decode get measurements with tags. Reason: ", err)
@@ -459,7 +562,7 @@ func testGetMinMaxMem(t *testing.T, baseURL string) {
 		t.Fatal("Unable to get processes. Reason: ", err)
 	}
 	type ProcessMinMaxMem struct {
-		Process
+		monitor.Process
 		MaxMemoryInPeriod uint32 // Maximum memory during period (KB)
 		MinMemoryInPeriod uint32 // Minimum memory during period(KB)
 	}
@@ -599,3 +702,185 @@ func testGetVersion(t *testing.T, baseURL string) {
 		t.Fatal("Unexpected GitHash: ", ver.GitHash)
 	}
 }
+
+// Called from TestHttpServer
+func testConfig(t *testing.T, baseURL string, m *monitor.Measurement, plmConfig *Configuration, configFile string) {
+	// GET config
+	resp, err := http.Get(fmt.Sprintf("%s/config", baseURL))
+	if err != nil {
+		t.Fatal("Unable to get config. Reason: ", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("Unexpected status code: ", resp.StatusCode)
+	}
+	var config Configuration
+	err = json.Unmarshal([]byte(respToString(resp.Body)), &config)
+	if err != nil {
+		t.Fatal("Unable decode config. Reason: ", err)
+	}
+	assertEqualsInt(t, "config.FastLogSize", 1200, config.FastLogSize)
+
+	// PUT config
+	put := func(body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/config", baseURL), strings.NewReader(body))
+		if err != nil {
+			t.Fatal("Unable to create request. Reason: ", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("Unable to put config. Reason: ", err)
+		}
+		return resp
+	}
+	resp = put(`{"FastLogSize": 2, "SlowLogFactor": 3}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("Unexpected status code: ", resp.StatusCode, respToString(resp.Body))
+	}
+	m.Mutex.Lock()
+	assertEqualsInt(t, "FastLogger.MaxRows", 2, m.FastLogger.MaxRows)
+	assertEqualsInt(t, "FastLogger.NbrRows", 2, m.FastLogger.NbrRows)
+	assertEqualsInt(t, "SlowLogFactor", 3, m.SlowLogFactor)
+	m.Mutex.Unlock()
+	properties, err := LoadPropertyFile(configFile)
+	if err != nil {
+		t.Fatal("Configuration not saved. Reason: ", err)
+	}
+	assertEqualsStr(t, "Saved fastLogSize", "2", properties["fastLogSize"])
+	assertEqualsStr(t, "Saved slowLogFactor", "3", properties["slowLogFactor"])
+	assertEqualsStr(t, "Changed value source", SourceRuntime, plmConfig.Source("fastLogSize"))
+
+	// Invalid values
+	resp = put(`{"SlowLogFactor": 0}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatal("Unexpected status code: ", resp.StatusCode)
+	}
+	resp = put(`{"Port": 1234}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatal("Unexpected status code: ", resp.StatusCode)
+	}
+	resp = put(`{"FastLogTimeMz": 1000}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatal("Unexpected status code for unknown key: ", resp.StatusCode)
+	}
+	assertTrue(t, "Unknown key reported", strings.Contains(respToString(resp.Body), "FastLogTimeMz"))
+	resp = put(`not json`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatal("Unexpected status code: ", resp.StatusCode)
+	}
+}
+
+func TestHttpServerAuthentication(t *testing.T) {
+	port := 9091
+	baseURL := fmt.Sprintf("http://localhost:%d", port)
+	config := DefaultConfiguration()
+	config.Port = port
+	config.BindAddress = "localhost"
+	config.ReadToken = "readsecret"
+	config.WriteToken = "writesecret"
+	m := monitor.CreateMeasurement(3, 6, 3, 6, proci.GenerateMock(3))
+	httpServer := CreateHTTPServer("", config, m)
+	httpServer.Start()
+	defer httpServer.Stop()
+	time.Sleep(100 * time.Millisecond) // Allow server to start
+
+	request := func(method string, path string, token string, basic bool) int {
+		req, err := http.NewRequest(method, baseURL+path, nil)
+		if err != nil {
+			t.Fatal("Unable to create request. Reason: ", err)
+		}
+		if basic {
+			req.SetBasicAuth("anyuser", token)
+		} else if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("Unable to send request. Reason: ", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assertEqualsInt(t, "Read without token", http.StatusUnauthorized, request("GET", "/processes", "", false))
+	assertEqualsInt(t, "Read with invalid token", http.StatusUnauthorized, request("GET", "/processes", "invalid", false))
+	assertEqualsInt(t, "Read with read token", http.StatusOK, request("GET", "/processes", "readsecret", false))
+	assertEqualsInt(t, "Read with write token", http.StatusOK, request("GET", "/processes", "writesecret", false))
+	assertEqualsInt(t, "Read with basic auth", http.StatusOK, request("GET", "/processes", "readsecret", true))
+	assertEqualsInt(t, "Write without token", http.StatusUnauthorized, request("POST", "/tag/t1", "", false))
+	assertEqualsInt(t, "Write with read token", http.StatusForbidden, request("POST", "/tag/t1", "readsecret", false))
+	assertEqualsInt(t, "Write with write token", http.StatusOK, request("POST", "/tag/t1", "writesecret", false))
+	assertEqualsInt(t, "Write with basic auth", http.StatusOK, request("POST", "/tag/t2", "writesecret", true))
+
+	// Only write token set, reading is open
+	httpServer.configMutex.Lock()
+	config.ReadToken = ""
+	httpServer.configMutex.Unlock()
+	assertEqualsInt(t, "Read without token", http.StatusOK, request("GET", "/tags", "", false))
+	assertEqualsInt(t, "Write without token", http.StatusUnauthorized, request("POST", "/tag/t3", "", false))
+}
+
+func TestHttpServerTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	certPEM := writeSelfSignedCert(t, certFile, keyFile)
+
+	port := 9092
+	config := DefaultConfiguration()
+	config.Port = port
+	config.TLSCertFile = certFile
+	config.TLSKeyFile = keyFile
+	m := monitor.CreateMeasurement(3, 6, 3, 6, proci.GenerateMock(3))
+	httpServer := CreateHTTPServer("", config, m)
+	httpServer.Start()
+	defer httpServer.Stop()
+	time.Sleep(100 * time.Millisecond) // Allow server to start
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := client.Get(fmt.Sprintf("https://localhost:%d/version", port))
+	if err != nil {
+		t.Fatal("Unable to get version using HTTPS. Reason: ", err)
+	}
+	resp.Body.Close()
+	assertEqualsInt(t, "Status code", http.StatusOK, resp.StatusCode)
+}
+
+// writeSelfSignedCert creates a self signed certificate for localhost and
+// returns the certificate in PEM format.
+func writeSelfSignedCert(t *testing.T, certFile string, keyFile string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err = ioutil.WriteFile(certFile, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certPEM
+}
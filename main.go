@@ -1,20 +1,28 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 
 	"github.com/kardianos/service"
 )
 
 type program struct {
-	plm        *PLM
-	workingDir string
+	plm         *PLM
+	workingDir  string
+	configFlags map[string]string
 }
 
 func (p *program) Start(s service.Service) error {
 	// Start should not block. Do the actual work async.
-	p.plm = CreatePLM(p.workingDir)
+	var err error
+	p.plm, err = CreatePLM(p.workingDir, p.configFlags)
+	if err != nil {
+		return err
+	}
 	go p.run()
 	return nil
 }
@@ -27,16 +35,44 @@ func (p *program) Stop(s service.Service) error {
 	return nil
 }
 
+// checkConfig prints the effective configuration and where each value came
+// from. Returns the exit code.
+func checkConfig(workingDir string, configFlags map[string]string) int {
+	configuration, err := LoadConfiguration(filepath.Join(workingDir, DefaultConfigFile), configFlags)
+	fmt.Print(configuration.Describe())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println("Configuration is valid")
+	return 0
+}
+
 // Main method can be runned as a "normal" console application AND as a
 // service. See install.bat for how to install the service on Windows.
 //
 // The application takes one optional argument which is the working
 // directory, i.e. where logs, configs and templates are found.
 // If not specified the current directory is used.
+//
+// All configuration parameters can also be given as flags before the
+// working directory, for example:
+//
+//	plm -fastLogTimeMs 1000 C:\plm
+//
+// Use -check-config to print the effective configuration without starting.
 func main() {
+	doCheckConfig := flag.Bool("check-config", false, "Print the effective configuration and where each value came from, then exit")
+	configFlags := RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
 	workingDir := ""
-	if len(os.Args) > 1 {
-		workingDir = os.Args[1]
+	if flag.NArg() > 0 {
+		workingDir = flag.Arg(0)
+	}
+
+	if *doCheckConfig {
+		os.Exit(checkConfig(workingDir, configFlags))
 	}
 
 	svcConfig := &service.Config{
@@ -45,7 +81,7 @@ func main() {
 		Description: "Process Load Monitor Service",
 	}
 
-	prg := &program{workingDir: workingDir}
+	prg := &program{workingDir: workingDir, configFlags: configFlags}
 	s, err := service.New(prg, svcConfig)
 	if err != nil {
 		log.Fatal(err)
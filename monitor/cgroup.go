@@ -0,0 +1,286 @@
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCgroupRoot is where the cgroup file system is mounted on Linux
+const DefaultCgroupRoot = "/sys/fs/cgroup"
+
+// unlimitedCgroupMemory is the lowest memory limit in bytes that is
+// considered unlimited. Cgroup v1 reports no limit as a huge number.
+const unlimitedCgroupMemory = 1 << 62
+
+// Cgroup is the memory accounting of a control group (Linux). The
+// processes are grouped by Process.Cgroup.
+type Cgroup struct {
+	Path          string    // Path in the cgroup hierarchy, same as Process.Cgroup
+	Version       int       // Cgroup version, 1 or 2
+	LastMemory    uint32    // Last memory measured (KB)
+	MaxMemoryEver uint32    // Maximum memory ever measured (KB)
+	MinMemoryEver uint32    // Minimum memory ever measured (KB)
+	Limit         uint32    // Memory limit (KB). 0 if unlimited
+	LimitHits     uint64    // Number of times the memory limit was reached
+	OOMs          uint64    // Number of times the OOM killer was invoked (only cgroup v2)
+	OOMKills      uint64    // Number of processes killed by the OOM killer
+	UIDs          []int     // The processes in the cgroup, sorted
+	Created       time.Time // When the cgroup was first seen
+	LastUpdate    time.Time // When the cgroup was last measured
+}
+
+// LogCgroup represents one memory measurement for one cgroup
+type LogCgroup struct {
+	Path    string // Path of the cgroup
+	MemUsed uint32 // Measured memory used by the cgroup (KB)
+}
+
+// cgroupFiles are the files read for each cgroup version
+type cgroupFiles struct {
+	current string // Memory used (bytes)
+	limit   string // Memory limit (bytes)
+	events  string // Key value pairs with events
+}
+
+var cgroupV1Files = cgroupFiles{current: "memory.usage_in_bytes", limit: "memory.limit_in_bytes", events: "memory.oom_control"}
+var cgroupV2Files = cgroupFiles{current: "memory.current", limit: "memory.max", events: "memory.events"}
+
+// readCgroup reads the memory accounting of the cgroup with the provided
+// path from the cgroup file system mounted at root. The memory controller
+// hierarchy of cgroup v1 is used if it exists, otherwise the unified
+// hierarchy of cgroup v2.
+func readCgroup(root string, path string) (Cgroup, error) {
+	cgroup := Cgroup{Path: path, Version: 1}
+	dir := filepath.Join(root, "memory", filepath.FromSlash(path))
+	files := cgroupV1Files
+	if _, err := os.Stat(filepath.Join(dir, files.current)); err != nil {
+		cgroup.Version = 2
+		dir = filepath.Join(root, filepath.FromSlash(path))
+		files = cgroupV2Files
+	}
+	current, err := readCgroupValue(filepath.Join(dir, files.current))
+	if err != nil {
+		return cgroup, err
+	}
+	cgroup.LastMemory = uint32(current / 1024) // Byte to KiloByte
+	if limit, err := readCgroupValue(filepath.Join(dir, files.limit)); err == nil && limit < unlimitedCgroupMemory {
+		cgroup.Limit = uint32(limit / 1024) // Byte to KiloByte
+	}
+	events, _ := readCgroupKeyValues(filepath.Join(dir, files.events))
+	cgroup.OOMKills = events["oom_kill"]
+	if cgroup.Version == 2 {
+		cgroup.LimitHits = events["max"]
+		cgroup.OOMs = events["oom"]
+	} else {
+		cgroup.LimitHits, _ = readCgroupValue(filepath.Join(dir, "memory.failcnt"))
+	}
+	return cgroup, nil
+}
+
+// readCgroupValue reads a file with one value. "max" means unlimited.
+func readCgroupValue(fileName string) (uint64, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+	text := strings.TrimSpace(string(b))
+	if text == "max" {
+		return unlimitedCgroupMemory, nil
+	}
+	value, err := strconv.ParseUint(text, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid value %q in %s", text, fileName)
+	}
+	return value, nil
+}
+
+// readCgroupKeyValues reads a file with one key and value per line, such as
+// memory.events. Lines that are not integers are ignored.
+func readCgroupKeyValues(fileName string) (map[string]uint64, error) {
+	values := make(map[string]uint64)
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return values, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if value, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = value
+		}
+	}
+	return values, nil
+}
+
+// updateCgroups measures the cgroups of the living processes and of the
+// processes that died in the last update. Cgroups that cannot be read, for
+// example since the cgroup file system is not mounted at CgroupRoot, are
+// ignored. If the OOM kill counter of a cgroup has increased, the processes
+// of the cgroup that died are marked as OOM killed.
+func (processMap *ProcessMap) updateCgroups() {
+	if processMap.CgroupRoot == "" {
+		return
+	}
+	paths := make(map[string]bool)
+	for _, process := range processMap.Alive {
+		if process.Cgroup != "" {
+			paths[process.Cgroup] = true
+		}
+	}
+	for _, process := range processMap.died {
+		if process.Cgroup != "" {
+			paths[process.Cgroup] = true
+		}
+	}
+	for path := range paths {
+		measured, err := readCgroup(processMap.CgroupRoot, path)
+		if err != nil {
+			continue
+		}
+		cgroup, hasCgroup := processMap.Cgroups[path]
+		if !hasCgroup {
+			cgroup = &Cgroup{Path: path, Created: processMap.LastUpdate}
+			processMap.Cgroups[path] = cgroup
+		} else if measured.OOMKills > cgroup.OOMKills {
+			processMap.applyCgroupOOMKills(path, measured.OOMKills-cgroup.OOMKills)
+		}
+		cgroup.Version = measured.Version
+		cgroup.LastMemory = measured.LastMemory
+		cgroup.Limit = measured.Limit
+		cgroup.LimitHits = measured.LimitHits
+		cgroup.OOMs = measured.OOMs
+		cgroup.OOMKills = measured.OOMKills
+		cgroup.LastUpdate = processMap.LastUpdate
+		if cgroup.MinMemoryEver == 0 || cgroup.LastMemory < cgroup.MinMemoryEver {
+			cgroup.MinMemoryEver = cgroup.LastMemory
+		}
+		if cgroup.LastMemory > cgroup.MaxMemoryEver {
+			cgroup.MaxMemoryEver = cgroup.LastMemory
+		}
+	}
+}
+
+// GetCgroups returns copies of the cgroups whose path contain matcher,
+// sorted on path, including the processes of each cgroup.
+func (processMap *ProcessMap) GetCgroups(matcher string) []Cgroup {
+	uids := make(map[string][]int)
+	for uid, process := range processMap.All {
+		if process.Cgroup != "" {
+			uids[process.Cgroup] = append(uids[process.Cgroup], uid)
+		}
+	}
+	cgroups := make([]Cgroup, 0, len(processMap.Cgroups))
+	for path, cgroup := range processMap.Cgroups {
+		if !strings.Contains(path, matcher) {
+			continue
+		}
+		c := *cgroup
+		c.UIDs = uids[path]
+		sort.Ints(c.UIDs)
+		cgroups = append(cgroups, c)
+	}
+	sort.Slice(cgroups, func(i, j int) bool { return cgroups[i].Path < cgroups[j].Path })
+	return cgroups
+}
+
+// removeOldCgroups removes the cgroups that no process belongs to
+func (processMap *ProcessMap) removeOldCgroups() {
+	used := make(map[string]bool)
+	for _, process := range processMap.All {
+		used[process.Cgroup] = true
+	}
+	for path := range processMap.Cgroups {
+		if !used[path] {
+			delete(processMap.Cgroups, path)
+		}
+	}
+}
+
+// logCgroups returns the memory of the cgroups measured in the last update
+func (processMap *ProcessMap) logCgroups() []*LogCgroup {
+	var logCgroups []*LogCgroup
+	for path, cgroup := range processMap.Cgroups {
+		if !cgroup.LastUpdate.Before(processMap.LastUpdate) {
+			logCgroups = append(logCgroups, &LogCgroup{Path: path, MemUsed: cgroup.LastMemory})
+		}
+	}
+	return logCgroups
+}
+
+// CgroupMeasurements are the measurements of cgroups. Lengths of all
+// arrays are the same. If a cgroup was not measured at a certain time the
+// value is 0.
+type CgroupMeasurements struct {
+	Memory map[string][]uint32 // Keyed on cgroup path
+	Times  []time.Time
+}
+
+// GetCgroupMeasurementsBetween returns the memory of the cgroups with the
+// provided paths between from and to. Zero values of from and/or to means
+// no restriction.
+func (m *Measurement) GetCgroupMeasurementsBetween(paths []string, from time.Time, to time.Time) *CgroupMeasurements {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	cm := &CgroupMeasurements{Memory: make(map[string][]uint32)}
+	for _, path := range paths {
+		cm.Memory[path] = make([]uint32, 0)
+	}
+	m.forEachRowBetween(from, to, func(row *LogRow) {
+		cm.Times = append(cm.Times, row.Time)
+		for path, memory := range cm.Memory {
+			var memUsed uint32
+			for _, logCgroup := range row.Cgroups {
+				if logCgroup.Path == path {
+					memUsed = logCgroup.MemUsed
+					break
+				}
+			}
+			cm.Memory[path] = append(memory, memUsed)
+		}
+	})
+	return cm
+}
+
+// CgroupMinMaxMem is a cgroup with the highest and lowest memory used
+// during a specific time
+type CgroupMinMaxMem struct {
+	Cgroup
+	MaxMemoryInPeriod uint32 // Maximum memory during period (KB)
+	MinMemoryInPeriod uint32 // Minimum memory during period (KB). 0 if not measured during the period
+}
+
+// GetCgroupMinMaxMem returns the highest and lowest memory used between from
+// and to by the cgroups whose path contain matcher, sorted on path. Zero
+// values of from and/or to means no restriction.
+func (m *Measurement) GetCgroupMinMaxMem(matcher string, from time.Time, to time.Time) []CgroupMinMaxMem {
+	m.Mutex.Lock()
+	cgroups := m.PM.GetCgroups(matcher)
+	m.Mutex.Unlock()
+	paths := make([]string, 0, len(cgroups))
+	for _, cgroup := range cgroups {
+		paths = append(paths, cgroup.Path)
+	}
+	measurements := m.GetCgroupMeasurementsBetween(paths, from, to) // Thread safe
+	result := make([]CgroupMinMaxMem, 0, len(cgroups))
+	for _, cgroup := range cgroups {
+		c := CgroupMinMaxMem{Cgroup: cgroup}
+		for _, value := range measurements.Memory[cgroup.Path] {
+			if value > c.MaxMemoryInPeriod {
+				c.MaxMemoryInPeriod = value
+			}
+			if value != 0 && (c.MinMemoryInPeriod == 0 || value < c.MinMemoryInPeriod) {
+				c.MinMemoryInPeriod = value
+			}
+		}
+		result = append(result, c)
+	}
+	return result
+}
@@ -0,0 +1,104 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/midstar/proci"
+)
+
+// writeCgroupFiles writes files of a fake cgroup file system
+func writeCgroupFiles(t *testing.T, dir string, files map[string]string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadCgroup(t *testing.T) {
+	root, err := ioutil.TempDir("", "plm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// Cgroup v2
+	writeCgroupFiles(t, filepath.Join(root, "system.slice", "app.scope"), map[string]string{
+		"memory.current": "2097152\n",
+		"memory.max":     "4194304\n",
+		"memory.events":  "low 0\nhigh 0\nmax 5\noom 2\noom_kill 1\n"})
+	cgroup, err := readCgroup(root, "/system.slice/app.scope")
+	assertTrue(t, "No error", err == nil)
+	assertEqualsInt(t, "Version", 2, cgroup.Version)
+	assertEqualsInt(t, "Memory", 2048, int(cgroup.LastMemory))
+	assertEqualsInt(t, "Limit", 4096, int(cgroup.Limit))
+	assertEqualsInt(t, "Limit hits", 5, int(cgroup.LimitHits))
+	assertEqualsInt(t, "OOMs", 2, int(cgroup.OOMs))
+	assertEqualsInt(t, "OOM kills", 1, int(cgroup.OOMKills))
+
+	writeCgroupFiles(t, filepath.Join(root, "unlimited"), map[string]string{"memory.current": "1024", "memory.max": "max"})
+	cgroup, _ = readCgroup(root, "/unlimited")
+	assertEqualsInt(t, "Unlimited", 0, int(cgroup.Limit))
+
+	// Cgroup v1
+	writeCgroupFiles(t, filepath.Join(root, "memory", "docker", "abc"), map[string]string{
+		"memory.usage_in_bytes": "3145728",
+		"memory.limit_in_bytes": "9223372036854771712",
+		"memory.failcnt":        "3",
+		"memory.oom_control":    "oom_kill_disable 0\nunder_oom 0\noom_kill 4\n"})
+	cgroup, err = readCgroup(root, "/docker/abc")
+	assertTrue(t, "No error", err == nil)
+	assertEqualsInt(t, "Version", 1, cgroup.Version)
+	assertEqualsInt(t, "Memory", 3072, int(cgroup.LastMemory))
+	assertEqualsInt(t, "Unlimited", 0, int(cgroup.Limit))
+	assertEqualsInt(t, "Limit hits", 3, int(cgroup.LimitHits))
+	assertEqualsInt(t, "OOM kills", 4, int(cgroup.OOMKills))
+
+	_, err = readCgroup(root, "/missing")
+	assertTrue(t, "Missing", err != nil)
+}
+
+func TestMeasureCgroups(t *testing.T) {
+	root, err := ioutil.TempDir("", "plm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "job")
+	writeCgroupFiles(t, dir, map[string]string{"memory.current": "1048576", "memory.max": "2097152"})
+
+	oMock := ownerMock{Mock: proci.GenerateMock(3), owners: map[uint32]Owner{
+		1: {Cgroup: "/job"}, 2: {Cgroup: "/job"}, 3: {Cgroup: "/missing"}}}
+	m := CreateMeasurement(10, 10, 1000, 1, oMock)
+	m.PM.CgroupRoot = root
+	m.MeasureAndLog(false)
+	time.Sleep(time.Millisecond)
+	writeCgroupFiles(t, dir, map[string]string{"memory.current": "1572864"})
+	m.MeasureAndLog(false)
+	time.Sleep(time.Millisecond)
+	writeCgroupFiles(t, dir, map[string]string{"memory.current": "524288"})
+	m.MeasureAndLog(false)
+
+	cgroups := m.PM.GetCgroups("")
+	assertEqualsInt(t, "Cgroups", 1, len(cgroups))
+	assertEqualsStr(t, "Path", "/job", cgroups[0].Path)
+	assertEqualsInt(t, "Processes", 2, len(cgroups[0].UIDs))
+	assertEqualsInt(t, "Limit", 2048, int(cgroups[0].Limit))
+	assertEqualsInt(t, "Last", 512, int(cgroups[0].LastMemory))
+	assertEqualsInt(t, "Max ever", 1536, int(cgroups[0].MaxMemoryEver))
+	assertEqualsInt(t, "No match", 0, len(m.PM.GetCgroups("other")))
+
+	minMax := m.GetCgroupMinMaxMem("job", m.FastLogger.LogRows[1].Time, time.Time{})
+	assertEqualsInt(t, "Max in period", 1536, int(minMax[0].MaxMemoryInPeriod))
+	assertEqualsInt(t, "Min in period", 512, int(minMax[0].MinMemoryInPeriod))
+	cm := m.GetCgroupMeasurementsBetween([]string{"/job"}, time.Time{}, time.Time{})
+	assertEqualsInt(t, "Times", 3, len(cm.Times))
+	assertEqualsInt(t, "First", 1024, int(cm.Memory["/job"][0]))
+}
@@ -0,0 +1,77 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Metrics that are measured for each process
+const (
+	MetricMemory  = "memory"  // Memory used (KB)
+	MetricFDs     = "fds"     // Open file descriptors (Linux) or handles (Windows)
+	MetricThreads = "threads" // Number of threads
+)
+
+// ProcessCounts are the number of open file descriptors (handles on
+// Windows) and threads of a process
+type ProcessCounts struct {
+	FDs     uint32 // 0 if not permitted to read
+	Threads uint32
+}
+
+// CountReader is implemented by process interfaces that can read the
+// number of file descriptors and threads of a process.
+type CountReader interface {
+	GetProcessCounts(pid uint32) (ProcessCounts, error)
+}
+
+// Metrics are all metrics measured for each process
+var Metrics = []string{MetricMemory, MetricFDs, MetricThreads, MetricReadBytes, MetricWriteBytes,
+	MetricDiskReadBytes, MetricDiskWriteBytes, MetricReadOps, MetricWriteOps}
+
+// CheckMetric returns an error if metric isn't one of the metrics measured
+// for each process (see Metrics). An empty metric means MetricMemory.
+func CheckMetric(metric string) error {
+	if metric == "" {
+		return nil
+	}
+	for _, m := range Metrics {
+		if metric == m {
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid metric %s. Shall be one of %s", metric, strings.Join(Metrics, ", "))
+}
+
+// value returns the value of the metric. The metric shall be valid (see
+// CheckMetric) and not an I/O rate (see ioRater).
+func (lp *LogProcess) value(metric string) uint32 {
+	switch metric {
+	case MetricFDs:
+		return lp.FDs
+	case MetricThreads:
+		return lp.Threads
+	}
+	return lp.MemUsed
+}
+
+// updateCounts reads the number of file descriptors and threads of a
+// process, if the process interface can read them
+func (processMap *ProcessMap) updateCounts(process *Process) {
+	reader, isReader := processMap.Pi.(CountReader)
+	if !isReader {
+		return
+	}
+	counts, err := reader.GetProcessCounts(process.Pid)
+	if err != nil {
+		process.LastFDs, process.LastThreads = 0, 0
+		return
+	}
+	process.LastFDs, process.LastThreads = counts.FDs, counts.Threads
+	if counts.FDs > process.MaxFDsEver {
+		process.MaxFDsEver = counts.FDs
+	}
+	if counts.Threads > process.MaxThreadsEver {
+		process.MaxThreadsEver = counts.Threads
+	}
+}
@@ -0,0 +1,33 @@
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// getProcessCounts counts the entries of /proc/<pid>/fd and reads the
+// threads from /proc/<pid>/status. The file descriptors of processes of
+// other users can only be read by root, and are 0 otherwise.
+func getProcessCounts(pid uint32) (ProcessCounts, error) {
+	var counts ProcessCounts
+	status, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return counts, err
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if strings.HasPrefix(line, "Threads:") {
+			threads, _ := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "Threads:")), 10, 32)
+			counts.Threads = uint32(threads)
+			break
+		}
+	}
+	if dir, err := os.Open(fmt.Sprintf("/proc/%d/fd", pid)); err == nil {
+		names, _ := dir.Readdirnames(-1)
+		dir.Close()
+		counts.FDs = uint32(len(names))
+	}
+	return counts, nil
+}
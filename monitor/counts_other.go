@@ -0,0 +1,11 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package monitor
+
+import "fmt"
+
+// getProcessCounts is not supported on this platform
+func getProcessCounts(pid uint32) (ProcessCounts, error) {
+	return ProcessCounts{}, fmt.Errorf("Process counts not supported on this platform")
+}
@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/midstar/proci"
+)
+
+// countMock is a mock that also can read the number of file descriptors
+// and threads of the processes
+type countMock struct {
+	*proci.Mock
+	counts map[uint32]ProcessCounts
+}
+
+func (m countMock) GetProcessCounts(pid uint32) (ProcessCounts, error) {
+	counts, hasPid := m.counts[pid]
+	if !hasPid {
+		return counts, fmt.Errorf("Process %d not found", pid)
+	}
+	return counts, nil
+}
+
+func TestMeasureCounts(t *testing.T) {
+	cMock := countMock{Mock: proci.GenerateMock(2), counts: map[uint32]ProcessCounts{
+		1: {FDs: 10, Threads: 2}, 2: {FDs: 20, Threads: 4}}}
+	m := CreateMeasurement(10, 10, 1000, 1, cMock)
+	m.MeasureAndLog(false)
+	time.Sleep(time.Millisecond)
+	cMock.counts[1] = ProcessCounts{FDs: 15, Threads: 3}
+	m.MeasureAndLog(false)
+	time.Sleep(time.Millisecond)
+	cMock.counts[1] = ProcessCounts{FDs: 12, Threads: 3}
+	m.MeasureAndLog(false)
+
+	process := m.PM.Alive[1]
+	other := m.PM.Alive[2]
+	assertEqualsInt(t, "Last FDs", 12, int(process.LastFDs))
+	assertEqualsInt(t, "Max FDs", 15, int(process.MaxFDsEver))
+	assertEqualsInt(t, "Last threads", 3, int(process.LastThreads))
+	assertEqualsInt(t, "Max threads", 3, int(process.MaxThreadsEver))
+
+	fds := m.GetProcessMetricBetween([]int{process.UID, other.UID}, MetricFDs, time.Time{}, time.Time{})
+	assertEqualsInt(t, "Times", 3, len(fds.Times))
+	assertEqualsInt(t, "First FDs", 10, int(fds.Memory[process.UID][0]))
+	assertEqualsInt(t, "Second FDs", 15, int(fds.Memory[process.UID][1]))
+	assertEqualsInt(t, "Other process FDs", 20, int(fds.Memory[other.UID][2]))
+	threads := m.GetProcessMetricBetween([]int{other.UID}, MetricThreads, time.Time{}, time.Time{})
+	assertEqualsInt(t, "Threads", 4, int(threads.Memory[other.UID][0]))
+	memory := m.GetProcessMetricBetween([]int{other.UID}, MetricMemory, time.Time{}, time.Time{})
+	assertEqualsInt(t, "Memory", 3, int(memory.Memory[other.UID][0]))
+
+	assertTrue(t, "Valid metric", CheckMetric(MetricThreads) == nil)
+	assertTrue(t, "Default metric", CheckMetric("") == nil)
+	assertTrue(t, "Invalid metric", CheckMetric("cpu") != nil)
+}
+
+func TestGetProcessCounts(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "windows" {
+		t.Skip("Process counts not supported on", runtime.GOOS)
+	}
+	counts, err := getProcessCounts(uint32(os.Getpid()))
+	assertTrue(t, "No error", err == nil)
+	assertTrue(t, "Threads", counts.Threads >= 1)
+	assertTrue(t, "FDs of own process", counts.FDs >= 1)
+}
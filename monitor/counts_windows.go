@@ -0,0 +1,43 @@
+package monitor
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var procGetProcessHandleCount = kernel32.NewProc("GetProcessHandleCount")
+
+// getProcessCounts reads the number of handles with GetProcessHandleCount
+// and the number of threads from a snapshot of all processes
+func getProcessCounts(pid uint32) (ProcessCounts, error) {
+	var counts ProcessCounts
+	snapshot, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return counts, err
+	}
+	defer syscall.CloseHandle(snapshot)
+	var entry syscall.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	found := false
+	for err = syscall.Process32First(snapshot, &entry); err == nil; err = syscall.Process32Next(snapshot, &entry) {
+		if entry.ProcessID == pid {
+			counts.Threads = entry.Threads
+			found = true
+			break
+		}
+	}
+	if !found {
+		return counts, fmt.Errorf("Process %d not found", pid)
+	}
+	process, err := syscall.OpenProcess(processQueryLimitedInformation, false, pid)
+	if err != nil {
+		return counts, nil // Handles of processes of other users are 0
+	}
+	defer syscall.CloseHandle(process)
+	var handles uint32
+	if r, _, _ := procGetProcessHandleCount.Call(uintptr(process), uintptr(unsafe.Pointer(&handles))); r != 0 {
+		counts.FDs = handles
+	}
+	return counts, nil
+}
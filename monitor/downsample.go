@@ -0,0 +1,77 @@
+package monitor
+
+import "time"
+
+// Downsample reduces values to at most points values, for example to plot a
+// long period. The values are split in points intervals with (almost) the
+// same number of values, and the mean, the lowest and the highest value of
+// each interval are returned. If ignoreZero is true, zero values, which
+// means that the process was not alive, are not included and the result is
+// 0 for intervals with only zero values. The values are returned as is (as
+// mean, min and max) if there are no more than points values.
+func Downsample(values []uint32, points int, ignoreZero bool) (mean []uint32, min []uint32, max []uint32) {
+	if points <= 0 || len(values) <= points {
+		return values, values, values
+	}
+	mean = make([]uint32, points)
+	min = make([]uint32, points)
+	max = make([]uint32, points)
+	for i := 0; i < points; i++ {
+		start, end := interval(len(values), points, i)
+		var sum uint64
+		count := 0
+		for _, value := range values[start:end] {
+			if value == 0 && ignoreZero {
+				continue
+			}
+			if count == 0 || value < min[i] {
+				min[i] = value
+			}
+			if value > max[i] {
+				max[i] = value
+			}
+			sum += uint64(value)
+			count++
+		}
+		if count > 0 {
+			mean[i] = uint32((sum + uint64(count)/2) / uint64(count))
+		}
+	}
+	return mean, min, max
+}
+
+// DownsampleTimes returns the time in the middle of each interval used by
+// Downsample
+func DownsampleTimes(times []time.Time, points int) []time.Time {
+	if points <= 0 || len(times) <= points {
+		return times
+	}
+	result := make([]time.Time, points)
+	for i := 0; i < points; i++ {
+		start, end := interval(len(times), points, i)
+		result[i] = times[start].Add(times[end-1].Sub(times[start]) / 2)
+	}
+	return result
+}
+
+// interval returns the start (inclusive) and the end (exclusive) index of
+// interval i, when n values are split in points intervals
+func interval(n int, points int, i int) (int, int) {
+	return i * n / points, (i + 1) * n / points
+}
+
+// Downsample reduces the system measurements to at most points values, see
+// Downsample. Only the mean of each interval is kept.
+func (sm *SystemMeasurements) Downsample(points int) {
+	downsample := func(values []uint32) []uint32 {
+		mean, _, _ := Downsample(values, points, false)
+		return mean
+	}
+	sm.Used = downsample(sm.Used)
+	sm.Cached = downsample(sm.Cached)
+	sm.Buffers = downsample(sm.Buffers)
+	sm.SwapUsed = downsample(sm.SwapUsed)
+	sm.CommitTotal = downsample(sm.CommitTotal)
+	sm.PageFaults = downsample(sm.PageFaults)
+	sm.Times = DownsampleTimes(sm.Times, points)
+}
@@ -0,0 +1,49 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDownsample(t *testing.T) {
+	values := []uint32{1, 3, 0, 0, 10, 20, 30, 0, 5, 7}
+	mean, min, max := Downsample(values, 20, true)
+	assertEqualsInt(t, "Not downsampled", len(values), len(mean))
+	assertEqualsInt(t, "Min is the value", 3, int(min[1]))
+	assertEqualsInt(t, "Max is the value", 3, int(max[1]))
+
+	// Intervals are [1 3 0] [0 10 20] [30 0 5 7]
+	mean, min, max = Downsample(values, 3, true)
+	assertEqualsInt(t, "Number of means", 3, len(mean))
+	assertEqualsInt(t, "Number of min", 3, len(min))
+	assertEqualsInt(t, "Number of max", 3, len(max))
+	assertEqualsInt(t, "Mean without zeros", 2, int(mean[0]))
+	assertEqualsInt(t, "Min without zeros", 1, int(min[0]))
+	assertEqualsInt(t, "Max", 3, int(max[0]))
+	assertEqualsInt(t, "Mean", 15, int(mean[1]))
+	assertEqualsInt(t, "Min", 10, int(min[1]))
+	assertEqualsInt(t, "Max", 20, int(max[1]))
+	assertEqualsInt(t, "Mean rounded", 14, int(mean[2]))
+	assertEqualsInt(t, "Min", 5, int(min[2]))
+	assertEqualsInt(t, "Max", 30, int(max[2]))
+
+	// Zero values included
+	mean, min, _ = Downsample(values, 3, false)
+	assertEqualsInt(t, "Mean with zeros", 1, int(mean[0]))
+	assertEqualsInt(t, "Min with zeros", 0, int(min[0]))
+
+	// Only zero values
+	mean, min, max = Downsample([]uint32{0, 0, 0, 0}, 2, true)
+	assertTrue(t, "Only zeros", mean[1] == 0 && min[1] == 0 && max[1] == 0)
+
+	start := time.Now()
+	times := make([]time.Time, len(values))
+	for i := range times {
+		times[i] = start.Add(time.Duration(i) * time.Second)
+	}
+	downsampled := DownsampleTimes(times, 3)
+	assertEqualsInt(t, "Number of times", 3, len(downsampled))
+	assertTrue(t, "Middle of first interval", downsampled[0].Equal(times[1]))
+	assertTrue(t, "Middle of last interval", downsampled[2].Equal(start.Add(7500*time.Millisecond)))
+	assertEqualsInt(t, "Times not downsampled", len(times), len(DownsampleTimes(times, 0)))
+}
@@ -0,0 +1,86 @@
+package monitor
+
+import (
+	"sort"
+)
+
+// Exit reasons (see Exit)
+const (
+	ExitNormal    = "exited"     // Exited with exit code 0
+	ExitFailed    = "failed"     // Exited with another exit code
+	ExitSignaled  = "signaled"   // Terminated by a signal
+	ExitOOMKilled = "oom-killed" // Killed by the OOM killer of the kernel
+)
+
+// Exit describes why a process died. The reason is only known if it was
+// reported, for example by plmc exec, or detected from the kernel log or
+// the OOM kill counter of the cgroup of the process (Linux).
+type Exit struct {
+	Reason string // One of the exit reasons, such as ExitOOMKilled. Empty if unknown
+	Detail string // For example the exit code, the signal or how an OOM kill was detected
+}
+
+// IsAbnormal returns true if the process did not exit with exit code 0. An
+// unknown reason is not abnormal.
+func (e Exit) IsAbnormal() bool {
+	return e.Reason != "" && e.Reason != ExitNormal
+}
+
+// SetExit sets why the process with the provided UID died (or will die).
+// An OOM kill is never replaced, since the process only sees the signal.
+// Returns false if there is no such process.
+func (processMap *ProcessMap) SetExit(uid int, exit Exit) bool {
+	process, hasElement := processMap.All[uid]
+	if !hasElement {
+		return false
+	}
+	if process.Exit.Reason != ExitOOMKilled {
+		process.Exit = exit
+	}
+	return true
+}
+
+// setOOMKilled marks the latest process with the provided PID as killed by
+// the OOM killer. Returns false if there is no such process.
+func (processMap *ProcessMap) setOOMKilled(pid uint32, detail string) bool {
+	var latest *Process
+	for _, process := range processMap.All {
+		if process.Pid == pid && (latest == nil || process.Created.After(latest.Created)) {
+			latest = process
+		}
+	}
+	if latest == nil {
+		return false
+	}
+	latest.Exit = Exit{Reason: ExitOOMKilled, Detail: detail}
+	return true
+}
+
+// applyOOMLog marks the processes found in the kernel log as OOM killed
+func (processMap *ProcessMap) applyOOMLog() {
+	if processMap.OOMLog == nil {
+		return
+	}
+	for _, kill := range processMap.OOMLog.takeKills() {
+		processMap.setOOMKilled(kill.Pid, "kernel log: "+kill.Message)
+	}
+}
+
+// applyCgroupOOMKills marks processes of the cgroup that died in the last
+// update as OOM killed, since the OOM kill counter of the cgroup increased
+// by kills. The OOM killer selects the process using most memory, so the
+// processes using most memory are marked first. An exit reported as
+// signaled (by plmc exec, before the death was detected) is replaced, since
+// the parent only sees the signal.
+func (processMap *ProcessMap) applyCgroupOOMKills(path string, kills uint64) {
+	candidates := make([]*Process, 0)
+	for _, process := range processMap.died {
+		if process.Cgroup == path && (process.Exit.Reason == "" || process.Exit.Reason == ExitSignaled) {
+			candidates = append(candidates, process)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].LastMemory > candidates[j].LastMemory })
+	for i := 0; i < len(candidates) && uint64(i) < kills; i++ {
+		candidates[i].Exit = Exit{Reason: ExitOOMKilled, Detail: "OOM kill counter of cgroup " + path}
+	}
+}
@@ -0,0 +1,82 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/midstar/proci"
+)
+
+func TestSetExit(t *testing.T) {
+	pMap := NewProcessMap(proci.GenerateMock(2))
+	pMap.Update()
+	uid := pMap.Alive[1].UID
+	assertTrue(t, "Set", pMap.SetExit(uid, Exit{Reason: ExitFailed, Detail: "exit code 1"}))
+	assertEqualsStr(t, "Reason", ExitFailed, pMap.All[uid].Exit.Reason)
+	assertTrue(t, "Abnormal", pMap.All[uid].Exit.IsAbnormal())
+	assertTrue(t, "Unknown is not abnormal", !Exit{}.IsAbnormal())
+	assertTrue(t, "No such process", !pMap.SetExit(1234, Exit{Reason: ExitNormal}))
+
+	// OOM kills are not replaced by the signal seen by the parent
+	pMap.setOOMKilled(1, "test")
+	pMap.SetExit(uid, Exit{Reason: ExitSignaled, Detail: "signal: killed"})
+	assertEqualsStr(t, "Still OOM killed", ExitOOMKilled, pMap.All[uid].Exit.Reason)
+}
+
+func TestOOMLogKills(t *testing.T) {
+	pMock := proci.GenerateMock(3)
+	pMap := NewProcessMap(pMock)
+	pMap.OOMLog = &OOMLog{kills: []OOMKill{{Pid: 2, Name: "path_2", Message: "Killed process 2 (path_2)"}, {Pid: 1234}}}
+	pMap.Update()
+	delete(pMock.Processes, 2)
+	pMap.Update()
+	died := pMap.All[pMap.GetUIDs("path_2")[0]]
+	assertTrue(t, "Died", !died.IsAlive)
+	assertEqualsStr(t, "Reason", ExitOOMKilled, died.Exit.Reason)
+	assertEqualsStr(t, "Detail", "kernel log: Killed process 2 (path_2)", died.Exit.Detail)
+	assertEqualsStr(t, "Others", "", pMap.Alive[1].Exit.Reason)
+}
+
+func TestCgroupOOMKills(t *testing.T) {
+	root, err := ioutil.TempDir("", "plm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "job")
+	writeCgroupFiles(t, dir, map[string]string{"memory.current": "1048576", "memory.events": "oom 0\noom_kill 0\n"})
+
+	job := Owner{Cgroup: "/job"}
+	oMock := ownerMock{Mock: proci.GenerateMock(4), owners: map[uint32]Owner{1: job, 2: job, 3: job, 4: {Cgroup: "/other"}}}
+	pMap := NewProcessMap(oMock)
+	pMap.CgroupRoot = root
+	pMap.Update()
+
+	// PID 1 and 2 die but only one is killed, the one using most memory
+	// (PID 2). PID 4 is in another cgroup.
+	delete(oMock.Processes, 1)
+	delete(oMock.Processes, 2)
+	delete(oMock.Processes, 4)
+	writeCgroupFiles(t, dir, map[string]string{"memory.events": "oom 1\noom_kill 1\n"})
+	pMap.Update()
+	for _, process := range pMap.All {
+		expected := ""
+		if process.Pid == 2 {
+			expected = ExitOOMKilled
+		}
+		assertEqualsStr(t, process.Path, expected, process.Exit.Reason)
+	}
+	assertEqualsInt(t, "OOM kills", 1, int(pMap.Cgroups["/job"].OOMKills))
+
+	// The exit of PID 3 is reported as signaled before the death is
+	// detected, as by plmc exec
+	uid3 := pMap.Alive[3].UID
+	pMap.SetExit(uid3, Exit{Reason: ExitSignaled, Detail: "signal: killed"})
+	delete(oMock.Processes, 3)
+	writeCgroupFiles(t, dir, map[string]string{"memory.events": "oom 2\noom_kill 2\n"})
+	pMap.Update()
+	assertEqualsStr(t, "Reported exit replaced", ExitOOMKilled, pMap.All[uid3].Exit.Reason)
+	assertEqualsInt(t, "OOM kills", 2, int(pMap.Cgroups["/job"].OOMKills))
+}
@@ -0,0 +1,71 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProcessFilter decides which processes are tracked, i.e. stored in the
+// process map and the log rows. The memory of the processes that are not
+// tracked is summed up in LogRow.Untracked.
+//
+// Each pattern is either text that the path of the process shall contain,
+// or matches the owner of the process, such as user:jenkins (see
+// Process.Matches).
+type ProcessFilter struct {
+	Include   []string // Only track processes matching any of these. Empty means all processes
+	Exclude   []string // Don't track processes matching any of these
+	MinMemory uint32   // Don't track processes until they use at least this much memory (KB)
+}
+
+// NewProcessFilter creates a ProcessFilter. Returns nil (track all
+// processes) if there are no patterns and minMemory is 0.
+func NewProcessFilter(include []string, exclude []string, minMemory int) (*ProcessFilter, error) {
+	for _, pattern := range append(append([]string{}, include...), exclude...) {
+		if pattern == "" {
+			return nil, fmt.Errorf("pattern must not be empty")
+		}
+		if isOwnerMatcher(pattern) && strings.HasSuffix(pattern, ":") {
+			return nil, fmt.Errorf("pattern %s must include the owner, for example user:jenkins", pattern)
+		}
+	}
+	if minMemory < 0 {
+		return nil, fmt.Errorf("minimum memory must be at least 0, got %d", minMemory)
+	}
+	if len(include) == 0 && len(exclude) == 0 && minMemory == 0 {
+		return nil, nil
+	}
+	return &ProcessFilter{Include: include, Exclude: exclude, MinMemory: uint32(minMemory)}, nil
+}
+
+// NeedsOwner returns true if any pattern matches the owner of the process
+func (f *ProcessFilter) NeedsOwner() bool {
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if isOwnerMatcher(pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches returns true if a process with the provided path and owner is
+// included and not excluded. The memory of the process is not checked.
+func (f *ProcessFilter) Matches(path string, owner Owner) bool {
+	process := &Process{Path: path, Owner: owner}
+	included := len(f.Include) == 0
+	for _, pattern := range f.Include {
+		if process.Matches(pattern) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, pattern := range f.Exclude {
+		if process.Matches(pattern) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/midstar/proci"
+)
+
+// ownerMock is a mock that also can read the owner of processes
+type ownerMock struct {
+	*proci.Mock
+	owners map[uint32]Owner // Owners keyed on PID
+}
+
+func (m ownerMock) GetProcessOwner(pid uint32) (Owner, error) {
+	return m.owners[pid], nil
+}
+
+func TestProcessFilter(t *testing.T) {
+	f, err := NewProcessFilter(nil, nil, 0)
+	assertTrue(t, "No filter", f == nil && err == nil)
+	_, err = NewProcessFilter([]string{"user:"}, nil, 0)
+	assertTrue(t, "User missing", err != nil)
+	_, err = NewProcessFilter(nil, nil, -1)
+	assertTrue(t, "Negative memory", err != nil)
+
+	f, err = NewProcessFilter([]string{"app", "user:jenkins"}, []string{"helper"}, 0)
+	assertTrue(t, "No error", err == nil)
+	assertTrue(t, "Needs user", f.NeedsOwner())
+	assertTrue(t, "Path included", f.Matches("/bin/app", Owner{User: "root"}))
+	assertTrue(t, "User included", f.Matches("/bin/other", Owner{User: "jenkins"}))
+	assertTrue(t, "Windows user included", f.Matches("C:\\other.exe", Owner{User: "BUILD\\Jenkins"}))
+	assertTrue(t, "Not included", !f.Matches("/bin/other", Owner{User: "root"}))
+	assertTrue(t, "Excluded", !f.Matches("/bin/apphelper", Owner{User: "jenkins"}))
+
+	f, _ = NewProcessFilter(nil, []string{"helper"}, 0)
+	assertTrue(t, "Doesn't need user", !f.NeedsOwner())
+	assertTrue(t, "All included", f.Matches("/bin/other", Owner{User: ""}))
+}
+
+func TestUpdateFiltered(t *testing.T) {
+	jenkins := Owner{User: "jenkins", UserID: "1001"}
+	oMock := ownerMock{Mock: proci.GenerateMock(5), owners: map[uint32]Owner{1: {User: "root", UserID: "0"},
+		2: jenkins, 3: jenkins, 4: jenkins, 5: jenkins}}
+	pMap := NewProcessMap(oMock)
+	// PID 1 (root) and PID 3 (path) are excluded, PID 2 uses too little memory
+	pMap.Filter, _ = NewProcessFilter([]string{"user:jenkins"}, []string{"path_3"}, 4)
+	pMap.Update()
+	assertEqualsInt(t, "Tracked", 2, len(pMap.All))
+	assertTrue(t, "PID 4 tracked", pMap.Alive[4] != nil)
+	assertTrue(t, "PID 5 tracked", pMap.Alive[5] != nil)
+	assertEqualsInt(t, "Untracked memory", 2+3+4, int(pMap.Untracked))
+
+	// PID 2 grows and is tracked. PID 3 is reused by another process
+	oMock.Processes[2].MemoryUsage = 10 * 1024
+	oMock.Processes[3].Path = "other_3"
+	pMap.Update()
+	assertEqualsInt(t, "Tracked", 4, len(pMap.All))
+	assertEqualsInt(t, "Memory of PID 2", 10, int(pMap.Alive[2].LastMemory))
+	assertEqualsStr(t, "PID 3", "other_3", pMap.Alive[3].Path)
+	assertEqualsInt(t, "Untracked memory", 2, int(pMap.Untracked))
+
+	// Tracked processes are not dropped when they shrink
+	oMock.Processes[2].MemoryUsage = 1024
+	pMap.Update()
+	assertTrue(t, "PID 2 still tracked", pMap.Alive[2] != nil)
+}
+
+func TestMeasureFiltered(t *testing.T) {
+	m := CreateMeasurement(10, 10, 1000, 1, proci.GenerateMock(3))
+	m.PM.Filter, _ = NewProcessFilter(nil, []string{"path_1"}, 0)
+	m.MeasureAndLog(false)
+	time.Sleep(time.Millisecond)
+	m.MeasureAndLog(false)
+	pm := m.GetProcessMeasurements(m.PM.GetUIDs(""))
+	assertEqualsInt(t, "Processes", 2, len(pm.Memory))
+	assertEqualsInt(t, "Untracked series", 2, len(pm.Untracked))
+	assertEqualsInt(t, "Untracked memory", 2, int(pm.Untracked[1]))
+	assertEqualsInt(t, "Total memory", 2<<20, int(m.FastLogger.LogRows[0].MemUsed))
+}
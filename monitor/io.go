@@ -0,0 +1,203 @@
+package monitor
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metrics of the I/O of each process. The measurements are rates per
+// second, calculated from the cumulative counters of ProcessIO.
+const (
+	MetricReadBytes      = "readBytes"      // Bytes read per second, including network and pipes
+	MetricWriteBytes     = "writeBytes"     // Bytes written per second, including network and pipes
+	MetricDiskReadBytes  = "diskReadBytes"  // Bytes read from storage per second (Linux)
+	MetricDiskWriteBytes = "diskWriteBytes" // Bytes written to storage per second (Linux)
+	MetricReadOps        = "readOps"        // Read operations per second
+	MetricWriteOps       = "writeOps"       // Write operations per second
+)
+
+// ProcessIO are the cumulative I/O counters of a process since it was
+// started. The bytes and operations include all I/O, such as files,
+// network and pipes, while the disk bytes are the bytes that caused
+// storage I/O. The disk bytes are only measured on Linux.
+type ProcessIO struct {
+	ReadBytes      uint64
+	WriteBytes     uint64
+	DiskReadBytes  uint64
+	DiskWriteBytes uint64
+	ReadOps        uint64
+	WriteOps       uint64
+}
+
+// IOReader is implemented by process interfaces that can read the I/O
+// counters of a process.
+type IOReader interface {
+	GetProcessIO(pid uint32) (ProcessIO, error)
+}
+
+// isIOMetric returns true if the metric is a rate of the I/O counters
+func isIOMetric(metric string) bool {
+	switch metric {
+	case MetricReadBytes, MetricWriteBytes, MetricDiskReadBytes, MetricDiskWriteBytes, MetricReadOps, MetricWriteOps:
+		return true
+	}
+	return false
+}
+
+// counter returns the counter of an I/O metric
+func (pio *ProcessIO) counter(metric string) uint64 {
+	switch metric {
+	case MetricReadBytes:
+		return pio.ReadBytes
+	case MetricWriteBytes:
+		return pio.WriteBytes
+	case MetricDiskReadBytes:
+		return pio.DiskReadBytes
+	case MetricDiskWriteBytes:
+		return pio.DiskWriteBytes
+	case MetricReadOps:
+		return pio.ReadOps
+	}
+	return pio.WriteOps
+}
+
+// sub returns the counters of pio minus the counters of other. Counters
+// that decreased are 0.
+func (pio ProcessIO) sub(other ProcessIO) ProcessIO {
+	diff := func(a, b uint64) uint64 {
+		if a < b {
+			return 0
+		}
+		return a - b
+	}
+	return ProcessIO{
+		ReadBytes:      diff(pio.ReadBytes, other.ReadBytes),
+		WriteBytes:     diff(pio.WriteBytes, other.WriteBytes),
+		DiskReadBytes:  diff(pio.DiskReadBytes, other.DiskReadBytes),
+		DiskWriteBytes: diff(pio.DiskWriteBytes, other.DiskWriteBytes),
+		ReadOps:        diff(pio.ReadOps, other.ReadOps),
+		WriteOps:       diff(pio.WriteOps, other.WriteOps)}
+}
+
+// updateIO reads the I/O counters of a process, if the process interface
+// can read them. The counters of processes of other users can only be read
+// by root on Linux, and are then not measured.
+func (processMap *ProcessMap) updateIO(process *Process) {
+	reader, isReader := processMap.Pi.(IOReader)
+	if !isReader {
+		return
+	}
+	pio, err := reader.GetProcessIO(process.Pid)
+	if err != nil {
+		process.IO = nil
+		return
+	}
+	process.IO = &pio
+}
+
+// ioSample is the counter of an I/O metric of a process at a certain time
+type ioSample struct {
+	counter uint64
+	time    time.Time
+}
+
+// ioRater calculates the rate of an I/O metric from the counters of
+// consecutive log rows
+type ioRater struct {
+	metric string
+	prev   map[int]ioSample // Keyed on UID
+}
+
+func newIORater(metric string) *ioRater {
+	return &ioRater{metric: metric, prev: make(map[int]ioSample)}
+}
+
+// rate returns the rate per second of the metric of a process since the
+// previous row. 0 for the first row of the process or if not measured.
+// Rates above the max value of uint32 are saturated.
+func (r *ioRater) rate(uid int, row *LogRow, logProcess *LogProcess) uint32 {
+	if logProcess == nil || logProcess.IO == nil {
+		delete(r.prev, uid)
+		return 0
+	}
+	sample := ioSample{counter: logProcess.IO.counter(r.metric), time: row.Time}
+	prev, hasPrev := r.prev[uid]
+	r.prev[uid] = sample
+	seconds := sample.time.Sub(prev.time).Seconds()
+	if !hasPrev || seconds <= 0 || sample.counter < prev.counter {
+		return 0
+	}
+	return uint32(math.Min(float64(sample.counter-prev.counter)/seconds, math.MaxUint32))
+}
+
+// ProcessIOInPeriod is a process with the I/O it did during a specific time
+type ProcessIOInPeriod struct {
+	Process
+	IOInPeriod ProcessIO // I/O during the period
+}
+
+// GetProcessIOBetween returns the I/O done between from and to by the
+// provided processes, sorted on UID. The I/O is counted from the first
+// measurement in the period, or from the start of the process if it was
+// first seen in the period. Zero values of from and/or to means no
+// restriction.
+func (m *Measurement) GetProcessIOBetween(uids []int, from time.Time, to time.Time) []ProcessIOInPeriod {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	first := make(map[int]ProcessIO)
+	last := make(map[int]ProcessIO)
+	m.forEachRowBetween(from, to, func(row *LogRow) {
+		for _, uid := range uids {
+			logProcess := row.findLogProcess(uid)
+			if logProcess == nil || logProcess.IO == nil {
+				continue
+			}
+			if _, hasFirst := first[uid]; !hasFirst {
+				first[uid] = *logProcess.IO
+			}
+			last[uid] = *logProcess.IO
+		}
+	})
+	result := make([]ProcessIOInPeriod, 0, len(uids))
+	for _, uid := range uids {
+		process, hasElement := m.PM.All[uid]
+		if !hasElement {
+			continue
+		}
+		p := ProcessIOInPeriod{Process: *process}
+		if counters, hasLast := last[uid]; hasLast {
+			if from.IsZero() || !process.Created.Before(from) {
+				p.IOInPeriod = counters
+			} else {
+				p.IOInPeriod = counters.sub(first[uid])
+			}
+		}
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].UID < result[j].UID })
+	return result
+}
+
+// parseProcIO parses the content of /proc/<pid>/io (Linux)
+func parseProcIO(content string) ProcessIO {
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if value, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[strings.TrimSuffix(fields[0], ":")] = value
+		}
+	}
+	return ProcessIO{
+		ReadBytes:      values["rchar"],
+		WriteBytes:     values["wchar"],
+		DiskReadBytes:  values["read_bytes"],
+		DiskWriteBytes: values["write_bytes"],
+		ReadOps:        values["syscr"],
+		WriteOps:       values["syscw"]}
+}
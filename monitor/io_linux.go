@@ -0,0 +1,15 @@
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+)
+
+// getProcessIO reads /proc/<pid>/io
+func getProcessIO(pid uint32) (ProcessIO, error) {
+	content, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/io", pid))
+	if err != nil {
+		return ProcessIO{}, err
+	}
+	return parseProcIO(string(content)), nil
+}
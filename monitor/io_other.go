@@ -0,0 +1,11 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package monitor
+
+import "fmt"
+
+// getProcessIO is not supported on this platform
+func getProcessIO(pid uint32) (ProcessIO, error) {
+	return ProcessIO{}, fmt.Errorf("Process I/O not supported on this platform")
+}
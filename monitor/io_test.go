@@ -0,0 +1,90 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/midstar/proci"
+)
+
+// ioMock is a mock that also can read the I/O counters of the processes
+type ioMock struct {
+	*proci.Mock
+	io map[uint32]ProcessIO
+}
+
+func (m ioMock) GetProcessIO(pid uint32) (ProcessIO, error) {
+	pio, hasPid := m.io[pid]
+	if !hasPid {
+		return pio, fmt.Errorf("Process %d not found", pid)
+	}
+	return pio, nil
+}
+
+func TestParseProcIO(t *testing.T) {
+	pio := parseProcIO(`rchar: 323934931
+wchar: 323929600
+syscr: 632687
+syscw: 632675
+read_bytes: 4096
+write_bytes: 323932160
+cancelled_write_bytes: 0
+`)
+	assertEqualsInt(t, "Read bytes", 323934931, int(pio.ReadBytes))
+	assertEqualsInt(t, "Write bytes", 323929600, int(pio.WriteBytes))
+	assertEqualsInt(t, "Disk read bytes", 4096, int(pio.DiskReadBytes))
+	assertEqualsInt(t, "Disk write bytes", 323932160, int(pio.DiskWriteBytes))
+	assertEqualsInt(t, "Read ops", 632687, int(pio.ReadOps))
+	assertEqualsInt(t, "Write ops", 632675, int(pio.WriteOps))
+}
+
+func TestMeasureIO(t *testing.T) {
+	iMock := ioMock{Mock: proci.GenerateMock(2), io: map[uint32]ProcessIO{
+		1: {WriteBytes: 1000, WriteOps: 10}, 2: {ReadBytes: 500}}}
+	m := CreateMeasurement(10, 10, 1000, 1, iMock)
+	m.MeasureAndLog(false)
+	from := time.Now()
+	time.Sleep(100 * time.Millisecond)
+	iMock.io[1] = ProcessIO{WriteBytes: 3000, WriteOps: 20}
+	m.MeasureAndLog(false)
+	time.Sleep(100 * time.Millisecond)
+	iMock.io[1] = ProcessIO{WriteBytes: 6000, WriteOps: 30}
+	m.MeasureAndLog(false)
+
+	process := m.PM.Alive[1]
+	other := m.PM.Alive[2]
+	assertEqualsInt(t, "Last counter", 6000, int(process.IO.WriteBytes))
+
+	rates := m.GetProcessMetricBetween([]int{process.UID}, MetricWriteBytes, time.Time{}, time.Time{})
+	assertEqualsInt(t, "Times", 3, len(rates.Times))
+	assertEqualsInt(t, "No rate at first measurement", 0, int(rates.Memory[process.UID][0]))
+	rate := rates.Memory[process.UID][1]
+	assertTrue(t, fmt.Sprintf("Write rate %d", rate), rate > 5000 && rate <= 20000)
+
+	all := m.GetProcessIOBetween([]int{process.UID, other.UID}, time.Time{}, time.Time{})
+	assertEqualsInt(t, "Processes", 2, len(all))
+	written := all[0].IOInPeriod
+	if all[0].UID != process.UID {
+		written = all[1].IOInPeriod
+	}
+	assertEqualsInt(t, "Written since start", 6000, int(written.WriteBytes))
+	assertEqualsInt(t, "Write ops since start", 30, int(written.WriteOps))
+
+	inPeriod := m.GetProcessIOBetween([]int{process.UID}, from, time.Time{})
+	assertEqualsInt(t, "Written in period", 3000, int(inPeriod[0].IOInPeriod.WriteBytes))
+	assertEqualsInt(t, "Write ops in period", 10, int(inPeriod[0].IOInPeriod.WriteOps))
+}
+
+func TestGetProcessIO(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "windows" {
+		t.Skip("Process I/O not supported on", runtime.GOOS)
+	}
+	pio, err := getProcessIO(uint32(os.Getpid()))
+	if err != nil {
+		t.Skip("Process I/O not readable:", err)
+	}
+	assertTrue(t, "Read ops of own process", pio.ReadOps >= 1)
+}
@@ -0,0 +1,37 @@
+package monitor
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var procGetProcessIoCounters = kernel32.NewProc("GetProcessIoCounters")
+
+// ioCounters is IO_COUNTERS of the Windows API
+type ioCounters struct {
+	ReadOperationCount  uint64
+	WriteOperationCount uint64
+	OtherOperationCount uint64
+	ReadTransferCount   uint64
+	WriteTransferCount  uint64
+	OtherTransferCount  uint64
+}
+
+// getProcessIO reads the I/O counters with GetProcessIoCounters. Windows
+// doesn't separate storage I/O, so the disk bytes are not measured.
+func getProcessIO(pid uint32) (ProcessIO, error) {
+	process, err := syscall.OpenProcess(processQueryLimitedInformation, false, pid)
+	if err != nil {
+		return ProcessIO{}, err
+	}
+	defer syscall.CloseHandle(process)
+	var counters ioCounters
+	if r, _, err := procGetProcessIoCounters.Call(uintptr(process), uintptr(unsafe.Pointer(&counters))); r == 0 {
+		return ProcessIO{}, err
+	}
+	return ProcessIO{
+		ReadBytes:  counters.ReadTransferCount,
+		WriteBytes: counters.WriteTransferCount,
+		ReadOps:    counters.ReadOperationCount,
+		WriteOps:   counters.WriteOperationCount}, nil
+}
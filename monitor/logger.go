@@ -0,0 +1,132 @@
+package monitor
+
+import (
+	"time"
+)
+
+// LogProcess represents one measurement for one process
+type LogProcess struct {
+	UID     int        // Process unique ID (not same as PID, which is not unique)
+	MemUsed uint32     // Measured memory used by the process
+	FDs     uint32     // Number of open file descriptors (handles on Windows)
+	Threads uint32     // Number of threads
+	IO      *ProcessIO // Cumulative I/O counters (nil if not measured)
+}
+
+// LogRow represents measurements from all living processes at
+// a certain time
+type LogRow struct {
+	Time         time.Time        // Time when data was measured
+	MemUsed      uint32           // Measured total memory used (by all processes)
+	Untracked    uint32           // Memory used by the processes not tracked (see ProcessFilter)
+	LogProcesses []*LogProcess    // All process entries
+	Cgroups      []*LogCgroup     // Memory of the cgroups of the processes (Linux)
+	System       *LogSystemMemory // Breakdown of the system memory (nil if not measured)
+}
+
+// Logger is a collection of LogRows. It is a circular buffer.
+type Logger struct {
+	LogRows []*LogRow // All rows (circular buffer)
+	MaxRows int       // Maximum rows in LogRows
+	NbrRows int       // Number of rows written (saturates at MaxRows)
+	Index   int       // Next index to write in LogRows
+}
+
+// CreateLogger creates a logger with a certain size
+func CreateLogger(size int) *Logger {
+	return &Logger{
+		LogRows: make([]*LogRow, size, size),
+		MaxRows: size,
+		NbrRows: 0,
+		Index:   0}
+}
+
+// GetMemUsed returns memory used for a specific process. If process is not
+// listed 0 is returned.
+func (lr *LogRow) GetMemUsed(uid int) uint32 {
+	memUsed, _ := lr.findMemUsed(uid)
+	return memUsed
+}
+
+// findMemUsed returns memory used for a specific process, and false if the
+// process is not listed
+func (lr *LogRow) findMemUsed(uid int) (uint32, bool) {
+	logProcess := lr.findLogProcess(uid)
+	if logProcess == nil {
+		return 0, false
+	}
+	return logProcess.MemUsed, true
+}
+
+// findLogProcess returns the measurement of a specific process. nil if the
+// process is not listed
+func (lr *LogRow) findLogProcess(uid int) *LogProcess {
+	for _, logProcess := range lr.LogProcesses {
+		if logProcess.UID == uid {
+			return logProcess
+		}
+	}
+	return nil
+}
+
+// AddRow adds a new row to the logger
+func (l *Logger) AddRow(row *LogRow) {
+	l.LogRows[l.Index] = row
+	l.Index++
+	if l.Index >= l.MaxRows {
+		l.Index = 0 // Wrap of log
+	}
+	if l.NbrRows < l.MaxRows {
+		l.NbrRows++
+	}
+}
+
+// OldestIndex gets the index of the oldest entry. -1 if
+// no entries exist.
+func (l *Logger) OldestIndex() int {
+	if l.NbrRows == 0 {
+		return -1
+	}
+	oldestIndex := l.Index
+	if l.NbrRows < l.MaxRows {
+		// No wrap yet, oldest is the first element
+		oldestIndex = 0
+	}
+	return oldestIndex
+}
+
+// OldestDate returns the date for the oldest log entry. If no entry exist
+// the current date is returned.
+func (l *Logger) OldestDate() time.Time {
+	oldestIndex := l.OldestIndex()
+	if oldestIndex == -1 {
+		return time.Now()
+	}
+	return l.LogRows[oldestIndex].Time
+}
+
+// Resize changes the size of the logger. Existing rows are preserved in
+// the same order. If the new size is smaller than the number of rows
+// written, only the newest rows are kept.
+func (l *Logger) Resize(size int) {
+	rows := make([]*LogRow, 0, l.NbrRows)
+	index := l.OldestIndex()
+	for i := 0; i < l.NbrRows; i++ {
+		rows = append(rows, l.LogRows[index])
+		index++
+		if index == l.MaxRows {
+			// Wrap of log
+			index = 0
+		}
+	}
+	if len(rows) > size {
+		rows = rows[len(rows)-size:]
+	}
+	l.LogRows = make([]*LogRow, size, size)
+	l.MaxRows = size
+	l.NbrRows = 0
+	l.Index = 0
+	for _, row := range rows {
+		l.AddRow(row)
+	}
+}
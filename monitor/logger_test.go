@@ -1,4 +1,4 @@
-package main
+package monitor
 
 import (
 	"testing"
@@ -59,3 +59,35 @@ func TestLogger(t *testing.T) {
 	// Get mem used on non existing process
 	assertEqualsInt(t, "Get mem used for non existing process", 0, int(logger.LogRows[0].GetMemUsed(234432)))
 }
+
+func TestLoggerResize(t *testing.T) {
+	logger := CreateLogger(3)
+	for i := 0; i < 4; i++ {
+		logger.AddRow(&LogRow{
+			Time:         time.Now(),
+			MemUsed:      uint32(i),
+			LogProcesses: make([]*LogProcess, 0)})
+	}
+
+	// Grow. All rows shall be kept in order.
+	logger.Resize(5)
+	assertEqualsInt(t, "MaxRows", 5, logger.MaxRows)
+	assertEqualsInt(t, "Number of elements", 3, logger.NbrRows)
+	assertEqualsInt(t, "Oldest index", 0, logger.OldestIndex())
+	assertEqualsInt(t, "First MemUsed", 1, int(logger.LogRows[0].MemUsed))
+	assertEqualsInt(t, "Last MemUsed", 3, int(logger.LogRows[2].MemUsed))
+
+	// Shrink. Only the newest rows shall be kept.
+	logger.Resize(2)
+	assertEqualsInt(t, "MaxRows", 2, logger.MaxRows)
+	assertEqualsInt(t, "Number of elements", 2, logger.NbrRows)
+	assertEqualsInt(t, "Next index", 0, logger.Index)
+	assertEqualsInt(t, "First MemUsed", 2, int(logger.LogRows[0].MemUsed))
+	assertEqualsInt(t, "Second MemUsed", 3, int(logger.LogRows[1].MemUsed))
+
+	// Resize empty logger
+	logger = CreateLogger(3)
+	logger.Resize(1)
+	assertEqualsInt(t, "Number of elements", 0, logger.NbrRows)
+	assertEqualsInt(t, "Oldest index on empty list", -1, logger.OldestIndex())
+}
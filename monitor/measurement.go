@@ -0,0 +1,430 @@
+// Package monitor measures the memory of processes. It is the core of
+// the PLM service, and can also be used to measure processes from other
+// Go programs, for example tests. See NewPidSelector to only measure
+// selected processes.
+package monitor
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/midstar/proci"
+)
+
+// Measurement holds all measurements.
+type Measurement struct {
+	FastLogger    *Logger
+	SlowLogger    *Logger
+	PM            *ProcessMap
+	FastLogTimeMs int
+	SlowLogFactor int
+	Mutex         *sync.Mutex // Only access this struct using this mutex
+	OnRow         RowListener // Called after each measurement. Might be nil
+	halt          chan bool   // Send to halt measurement
+	watches       map[int]*Watch
+	nextWatchID   int
+}
+
+// RowListener is called, with the measurement mutex locked, after each
+// measurement
+type RowListener func(pm *ProcessMap, row *LogRow, addedToSlowLog bool)
+
+// ProcessMeasurements are measuremens from an individual process extracted
+// from the Measurement struct. Lengths of all arrays are the same, including
+// time. If no measurement was found for a certain time, the measured value
+// is set to 0.
+type ProcessMeasurements struct {
+	Memory    map[int][]uint32 // Keyed on UID, values are all measured memory (or the measured metric, see GetProcessMetricBetween)
+	Times     []time.Time      // Time values
+	Untracked []uint32         // Memory used by the processes not tracked (see ProcessFilter)
+	Filled    map[int][]int    `json:"-"` // Keyed on UID, indexes (ascending) of values copied from the previous value since a watch sampled other processes
+}
+
+// Measured returns the times and values of the process with the provided
+// UID, without the values copied from the previous value (see Filled). Use
+// it for statistics, where the copies would count as measurements.
+func (pm *ProcessMeasurements) Measured(uid int) ([]time.Time, []uint32) {
+	filled := pm.Filled[uid]
+	if len(filled) == 0 {
+		return pm.Times, pm.Memory[uid]
+	}
+	values := pm.Memory[uid]
+	times := make([]time.Time, 0, len(values)-len(filled))
+	measured := make([]uint32, 0, len(values)-len(filled))
+	for i, value := range values {
+		if len(filled) > 0 && filled[0] == i {
+			filled = filled[1:]
+			continue
+		}
+		times = append(times, pm.Times[i])
+		measured = append(measured, value)
+	}
+	return times, measured
+}
+
+// samples returns true if the row holds any of the processes
+func (pm *ProcessMeasurements) samples(row *LogRow) bool {
+	for _, logProcess := range row.LogProcesses {
+		if _, hasElement := pm.Memory[logProcess.UID]; hasElement {
+			return true
+		}
+	}
+	return false
+}
+
+// WithoutFilled returns a copy with only the rows where no value was copied
+// from the previous value (see Filled), i.e. where all processes were
+// measured
+func (pm *ProcessMeasurements) WithoutFilled() *ProcessMeasurements {
+	filled := make(map[int]bool)
+	for _, indexes := range pm.Filled {
+		for _, i := range indexes {
+			filled[i] = true
+		}
+	}
+	result := &ProcessMeasurements{
+		Memory:    make(map[int][]uint32),
+		Times:     make([]time.Time, 0, len(pm.Times)-len(filled)),
+		Untracked: make([]uint32, 0, len(pm.Times)-len(filled)),
+		Filled:    make(map[int][]int)}
+	for uid := range pm.Memory {
+		result.Memory[uid] = make([]uint32, 0, len(pm.Times)-len(filled))
+	}
+	for i, t := range pm.Times {
+		if filled[i] {
+			continue
+		}
+		result.Times = append(result.Times, t)
+		result.Untracked = append(result.Untracked, pm.Untracked[i])
+		for uid, memory := range pm.Memory {
+			result.Memory[uid] = append(result.Memory[uid], memory[i])
+		}
+	}
+	return result
+}
+
+// CreateMeasurement creates a new measurment object
+func CreateMeasurement(fastLoggerSize int, slowLoggerSize int,
+	fastLogTimeMs int, slowLogFactor int,
+	pi proci.Interface) *Measurement {
+	return &Measurement{
+		FastLogger:    CreateLogger(fastLoggerSize),
+		SlowLogger:    CreateLogger(slowLoggerSize),
+		PM:            NewProcessMap(pi),
+		FastLogTimeMs: fastLogTimeMs,
+		SlowLogFactor: slowLogFactor,
+		Mutex:         &sync.Mutex{},
+		halt:          make(chan bool)}
+}
+
+// Start starts the measurement as a separate goroutine.
+//
+// Stop the measurement with Stop.
+func (m *Measurement) Start() {
+	go m.measureLoop()
+}
+
+// Stop stops the measurement and all watches.
+func (m *Measurement) Stop() {
+	m.halt <- true
+	for _, w := range m.GetWatches() {
+		m.StopWatch(w.ID)
+	}
+}
+
+// GetProcessMeasurementsBetween same as GetProcessMeasurements but only extracts
+// measuared values between from and to.
+// If from and/or to are set to zero values (default) no restriction is set.
+func (m *Measurement) GetProcessMeasurementsBetween(uids []int, from time.Time, to time.Time) *ProcessMeasurements {
+	return m.GetProcessMetricBetween(uids, MetricMemory, from, to)
+}
+
+// GetProcessMetricBetween is the same as GetProcessMeasurementsBetween but
+// extracts the provided metric, such as MetricFDs, instead of the memory.
+// The values are returned in the Memory field. The I/O metrics are rates
+// since the previous measurement, and are 0 for the first measurement of a
+// process in the period. Samples of watches only measure memory, and are
+// only included for MetricMemory.
+func (m *Measurement) GetProcessMetricBetween(uids []int, metric string, from time.Time, to time.Time) *ProcessMeasurements {
+	m.Mutex.Lock()
+	maxSize := m.SlowLogger.NbrRows + m.FastLogger.NbrRows
+	pm := &ProcessMeasurements{
+		Memory:    make(map[int][]uint32),
+		Times:     make([]time.Time, 0, maxSize),
+		Untracked: make([]uint32, 0, maxSize),
+		Filled:    make(map[int][]int)}
+	for _, uid := range uids {
+		_, hasElement := m.PM.All[uid]
+		if hasElement {
+			pm.Memory[uid] = make([]uint32, 0, maxSize)
+		} else {
+			log.Printf("Trying to get measurement for process with UID %d which don't exist", uid)
+		}
+	}
+	// Samples of watches are merged with the log rows, if they sampled any
+	// of the processes. Processes not sampled by a watch, and the memory of
+	// the processes not tracked, keep their value from the previous row
+	// (see Filled).
+	var watchRows []*LogRow
+	if metric == "" || metric == MetricMemory {
+		for _, row := range m.watchRowsBetween(from, to) {
+			if pm.samples(row) {
+				watchRows = append(watchRows, row)
+			}
+		}
+	}
+	var rater *ioRater
+	if isIOMetric(metric) {
+		rater = newIORater(metric)
+	}
+	addRow := func(row *LogRow, isWatchRow bool) {
+		pm.Times = append(pm.Times, row.Time)
+		untracked := row.Untracked
+		if isWatchRow && len(pm.Untracked) > 0 {
+			untracked = pm.Untracked[len(pm.Untracked)-1]
+		}
+		pm.Untracked = append(pm.Untracked, untracked)
+		for uid, memory := range pm.Memory {
+			var value uint32
+			logProcess := row.findLogProcess(uid)
+			if rater != nil {
+				value = rater.rate(uid, row, logProcess)
+			} else if logProcess != nil {
+				value = logProcess.value(metric)
+			} else if isWatchRow && len(memory) > 0 {
+				value = memory[len(memory)-1]
+				pm.Filled[uid] = append(pm.Filled[uid], len(memory))
+			}
+			pm.Memory[uid] = append(memory, value)
+		}
+	}
+	m.forEachRowBetween(from, to, func(row *LogRow) {
+		for len(watchRows) > 0 && watchRows[0].Time.Before(row.Time) {
+			addRow(watchRows[0], true)
+			watchRows = watchRows[1:]
+		}
+		addRow(row, false)
+	})
+	for _, row := range watchRows {
+		addRow(row, true)
+	}
+	m.Mutex.Unlock()
+	return pm
+}
+
+// GetMemUsedBetween returns the total memory used (by all processes) between
+// from and to. Zero values of from and/or to means no restriction.
+func (m *Measurement) GetMemUsedBetween(from time.Time, to time.Time) ([]time.Time, []uint32) {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	maxSize := m.SlowLogger.NbrRows + m.FastLogger.NbrRows
+	times := make([]time.Time, 0, maxSize)
+	memUsed := make([]uint32, 0, maxSize)
+	m.forEachRowBetween(from, to, func(row *LogRow) {
+		times = append(times, row.Time)
+		memUsed = append(memUsed, row.MemUsed)
+	})
+	return times, memUsed
+}
+
+// forEachRowBetween calls fn for all rows between from and to (zero values
+// means no restriction), oldest first. The slow log is used for the times
+// not covered by the fast log. Mutex shall be locked by the caller.
+func (m *Measurement) forEachRowBetween(from time.Time, to time.Time, fn func(row *LogRow)) {
+	fastLogOldestTime := m.FastLogger.OldestDate()
+
+	// Start with extracting values from the Slow Log
+	slowIndex := m.SlowLogger.OldestIndex()
+	handledRows := 0
+	for handledRows < m.SlowLogger.NbrRows {
+		row := m.SlowLogger.LogRows[slowIndex]
+		if row.Time == fastLogOldestTime || row.Time.After(fastLogOldestTime) {
+			// Continue with the fast log
+			break
+		}
+		// Only add time if to / from restrictions are fullfilled
+		if (from.IsZero() || !row.Time.Before(from)) && (to.IsZero() || !row.Time.After(to)) {
+			fn(row)
+		}
+		handledRows++
+		slowIndex++
+		if slowIndex == m.SlowLogger.MaxRows {
+			// Wrap of log
+			slowIndex = 0
+		}
+	}
+
+	// Continue extract from the fast log
+	fastIndex := m.FastLogger.OldestIndex()
+	handledRows = 0
+	for handledRows < m.FastLogger.NbrRows {
+		row := m.FastLogger.LogRows[fastIndex]
+		// Only add time if to / from restrictions are fullfilled
+		if (from.IsZero() || !row.Time.Before(from)) && (to.IsZero() || !row.Time.After(to)) {
+			fn(row)
+		}
+		handledRows++
+		fastIndex++
+		if fastIndex == m.FastLogger.MaxRows {
+			// Wrap of log
+			fastIndex = 0
+		}
+	}
+}
+
+// ProcessMinMaxMem is a process with the highest and lowest memory
+// consumption during a specific time
+type ProcessMinMaxMem struct {
+	Process
+	MaxMemoryInPeriod uint32 // Maximum memory during period (KB)
+	MinMemoryInPeriod uint32 // Minimum memory during period(KB)
+}
+
+// GetMinMaxMem returns the highest and lowest memory consumption between
+// from and to for the provided processes, sorted on UID. Zero values of
+// from and/or to means no restriction.
+func (m *Measurement) GetMinMaxMem(uids []int, from time.Time, to time.Time) []ProcessMinMaxMem {
+	measurements := m.GetProcessMeasurementsBetween(uids, from, to) // Thread safe
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	result := make([]ProcessMinMaxMem, 0, len(measurements.Memory))
+	for uid, values := range measurements.Memory {
+		process, hasElement := m.PM.All[uid]
+		if hasElement {
+			p := ProcessMinMaxMem{
+				Process:           *process,
+				MaxMemoryInPeriod: 0,
+				MinMemoryInPeriod: 4294967295} // = 2 ^ 32 - 1
+			for _, value := range values {
+				if value > p.MaxMemoryInPeriod {
+					p.MaxMemoryInPeriod = value
+				}
+				if value < p.MinMemoryInPeriod {
+					p.MinMemoryInPeriod = value
+				}
+			}
+			result = append(result, p)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].UID < result[j].UID })
+	return result
+}
+
+// GetProcessMeasurements "extracts" the measured values for the provided list
+// of processes (using UID as selector) .
+func (m *Measurement) GetProcessMeasurements(uids []int) *ProcessMeasurements {
+	return m.GetProcessMeasurementsBetween(uids, time.Time{}, time.Time{})
+}
+
+// Reconfigure changes the logger sizes, the time between measurements and
+// the slow log factor while the measurement is running. The measured values
+// are preserved. If a logger is made smaller only the newest values are
+// kept.
+func (m *Measurement) Reconfigure(fastLoggerSize int, slowLoggerSize int,
+	fastLogTimeMs int, slowLogFactor int) {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	if fastLoggerSize != m.FastLogger.MaxRows {
+		log.Printf("Resizing fast log from %d to %d rows", m.FastLogger.MaxRows, fastLoggerSize)
+		m.FastLogger.Resize(fastLoggerSize)
+	}
+	if slowLoggerSize != m.SlowLogger.MaxRows {
+		log.Printf("Resizing slow log from %d to %d rows", m.SlowLogger.MaxRows, slowLoggerSize)
+		m.SlowLogger.Resize(slowLoggerSize)
+	}
+	m.FastLogTimeMs = fastLogTimeMs
+	m.SlowLogFactor = slowLogFactor
+}
+
+// measureLoop runs the measurement loop. Supposed to be runned as a goroutine.
+func (m *Measurement) measureLoop() {
+	haltMeasurement := false
+	addToSlowLog := false
+	iter := 1
+	for !haltMeasurement {
+
+		// The configuration might be changed using Reconfigure
+		m.Mutex.Lock()
+		fastLogTimeMs := m.FastLogTimeMs
+		slowLogFactor := m.SlowLogFactor
+		m.Mutex.Unlock()
+
+		if iter%slowLogFactor == 0 {
+			addToSlowLog = true
+			iter = 0
+		} else {
+			addToSlowLog = false
+		}
+
+		m.MeasureAndLog(addToSlowLog)
+		m.RemoveOldProcesses()
+		m.RemoveOldWatches()
+
+		iter++
+
+		select {
+		case <-m.halt:
+			haltMeasurement = true
+		case <-time.After(time.Duration(fastLogTimeMs) * time.Millisecond):
+		}
+	}
+}
+
+// MeasureAndLog performs measurement and add to FastLogger. Optionally also log to SlowLogger.
+//
+// Normally called by the measurement loop (see Start), but can be called
+// directly to measure at specific times.
+func (m *Measurement) MeasureAndLog(addToSlowLogger bool) {
+	m.Mutex.Lock()
+
+	m.PM.Update()
+
+	logProcesses := make([]*LogProcess, len(m.PM.Alive), len(m.PM.Alive))
+	i := 0
+	for _, process := range m.PM.Alive {
+		logProcesses[i] = &LogProcess{
+			UID:     process.UID,
+			MemUsed: process.LastMemory,
+			FDs:     process.LastFDs,
+			Threads: process.LastThreads,
+			IO:      process.IO}
+		i++
+	}
+
+	row := LogRow{
+		Time:         m.PM.LastUpdate,
+		MemUsed:      m.PM.Phys.LastPhys,
+		Untracked:    m.PM.Untracked,
+		LogProcesses: logProcesses,
+		Cgroups:      m.PM.logCgroups(),
+		System:       m.PM.logSystemMemory()}
+
+	m.FastLogger.AddRow(&row)
+	if addToSlowLogger {
+		m.SlowLogger.AddRow(&row)
+	}
+	if m.OnRow != nil {
+		m.OnRow(m.PM, &row, addToSlowLogger)
+	}
+
+	m.Mutex.Unlock()
+}
+
+// RemoveOldProcesses removes all dead processes where no log entries exists.
+func (m *Measurement) RemoveOldProcesses() {
+	m.Mutex.Lock()
+	// Only remove entries if the log is full
+	if m.SlowLogger.NbrRows == m.SlowLogger.MaxRows {
+		oldestTime := m.SlowLogger.OldestDate()
+		for uid, process := range m.PM.All {
+			if !process.IsAlive && process.Died.Before(oldestTime) {
+				log.Printf("Removing process %d. Died: %s, Last entry: %s", uid, process.Died.Format(time.RFC3339), oldestTime.Format(time.RFC3339))
+				delete(m.PM.All, uid)
+			}
+		}
+		m.PM.removeOldCgroups()
+	}
+	m.Mutex.Unlock()
+}
@@ -1,4 +1,4 @@
-package main
+package monitor
 
 import (
 	"testing"
@@ -11,7 +11,7 @@ func TestGetProcessMeasurements(t *testing.T) {
 	pMock := proci.GenerateMock(10)
 	m := CreateMeasurement(2, 4, 2, 4, pMock)
 
-	m.measureAndLog(false)
+	m.MeasureAndLog(false)
 	var pid1 uint32 = 1
 	var pid2 uint32 = 3
 	uid1 := m.PM.Alive[pid1].UID
@@ -25,7 +25,7 @@ func TestGetProcessMeasurements(t *testing.T) {
 	time.Sleep(50 * time.Millisecond) // To make time differ
 	pMock.Processes[pid1].MemoryUsage = 1024 * 34
 	pMock.Processes[pid2].MemoryUsage = 1024 * 12
-	m.measureAndLog(true)
+	m.MeasureAndLog(true)
 	pm = m.GetProcessMeasurements(uids)
 	assertEqualsSlice(t, "Values 1", []uint32{pid1 + 1, 34}, pm.Memory[uid1])
 	assertEqualsSlice(t, "Values 2", []uint32{pid2 + 1, 12}, pm.Memory[uid2])
@@ -33,7 +33,7 @@ func TestGetProcessMeasurements(t *testing.T) {
 	time.Sleep(50 * time.Millisecond) // To make time differ
 	pMock.Processes[pid1].MemoryUsage = 1024 * 87
 	pMock.Processes[pid2].MemoryUsage = 1024 * 21
-	m.measureAndLog(false)
+	m.MeasureAndLog(false)
 	pm = m.GetProcessMeasurements(uids)
 	assertEqualsSlice(t, "Values 1", []uint32{34, 87}, pm.Memory[uid1])
 	assertEqualsSlice(t, "Values 2", []uint32{12, 21}, pm.Memory[uid2])
@@ -41,7 +41,7 @@ func TestGetProcessMeasurements(t *testing.T) {
 	time.Sleep(50 * time.Millisecond) // To make time differ
 	pMock.Processes[pid1].MemoryUsage = 1024 * 44
 	pMock.Processes[pid2].MemoryUsage = 1024 * 11
-	m.measureAndLog(true)
+	m.MeasureAndLog(true)
 	pm = m.GetProcessMeasurements(uids)
 	assertEqualsSlice(t, "Values 1", []uint32{34, 87, 44}, pm.Memory[uid1])
 	assertEqualsSlice(t, "Values 2", []uint32{12, 21, 11}, pm.Memory[uid2])
@@ -50,7 +50,7 @@ func TestGetProcessMeasurements(t *testing.T) {
 
 	pMock.Processes[pid1].MemoryUsage = 1024 * 10
 	pMock.Processes[pid2].MemoryUsage = 1024 * 43
-	m.measureAndLog(false)
+	m.MeasureAndLog(false)
 	pm = m.GetProcessMeasurements(uids)
 	assertEqualsSlice(t, "Values 1", []uint32{34, 44, 10}, pm.Memory[uid1])
 	assertEqualsSlice(t, "Values 2", []uint32{12, 11, 43}, pm.Memory[uid2])
@@ -58,7 +58,7 @@ func TestGetProcessMeasurements(t *testing.T) {
 	time.Sleep(50 * time.Millisecond) // To make time differ
 	pMock.Processes[pid1].MemoryUsage = 1024 * 65
 	pMock.Processes[pid2].MemoryUsage = 1024 * 56
-	m.measureAndLog(true)
+	m.MeasureAndLog(true)
 	pm = m.GetProcessMeasurements(uids)
 	assertEqualsSlice(t, "Values 1", []uint32{34, 44, 10, 65}, pm.Memory[uid1])
 	assertEqualsSlice(t, "Values 2", []uint32{12, 11, 43, 56}, pm.Memory[uid2])
@@ -66,7 +66,7 @@ func TestGetProcessMeasurements(t *testing.T) {
 	time.Sleep(50 * time.Millisecond) // To make time differ
 	pMock.Processes[pid1].MemoryUsage = 1024 * 87
 	pMock.Processes[pid2].MemoryUsage = 1024 * 78
-	m.measureAndLog(false)
+	m.MeasureAndLog(false)
 	pm = m.GetProcessMeasurements(uids)
 	assertEqualsSlice(t, "Values 1", []uint32{34, 44, 65, 87}, pm.Memory[uid1])
 	assertEqualsSlice(t, "Values 2", []uint32{12, 11, 56, 78}, pm.Memory[uid2])
@@ -74,7 +74,7 @@ func TestGetProcessMeasurements(t *testing.T) {
 	time.Sleep(50 * time.Millisecond) // To make time differ
 	pMock.Processes[pid1].MemoryUsage = 1024 * 28
 	pMock.Processes[pid2].MemoryUsage = 1024 * 87
-	m.measureAndLog(true)
+	m.MeasureAndLog(true)
 	pm = m.GetProcessMeasurements(uids)
 	assertEqualsSlice(t, "Values 1", []uint32{34, 44, 65, 87, 28}, pm.Memory[uid1])
 	assertEqualsSlice(t, "Values 2", []uint32{12, 11, 56, 78, 87}, pm.Memory[uid2])
@@ -82,7 +82,7 @@ func TestGetProcessMeasurements(t *testing.T) {
 	time.Sleep(50 * time.Millisecond) // To make time differ
 	pMock.Processes[pid1].MemoryUsage = 1024 * 71
 	pMock.Processes[pid2].MemoryUsage = 1024 * 17
-	m.measureAndLog(false)
+	m.MeasureAndLog(false)
 	pm = m.GetProcessMeasurements(uids)
 	assertEqualsSlice(t, "Values 1", []uint32{34, 44, 65, 28, 71}, pm.Memory[uid1])
 	assertEqualsSlice(t, "Values 2", []uint32{12, 11, 56, 87, 17}, pm.Memory[uid2])
@@ -90,7 +90,7 @@ func TestGetProcessMeasurements(t *testing.T) {
 	time.Sleep(50 * time.Millisecond) // To make time differ
 	pMock.Processes[pid1].MemoryUsage = 1024 * 98
 	pMock.Processes[pid2].MemoryUsage = 1024 * 89
-	m.measureAndLog(true)
+	m.MeasureAndLog(true)
 	pm = m.GetProcessMeasurements(uids)
 	assertEqualsSlice(t, "Values 1", []uint32{44, 65, 28, 71, 98}, pm.Memory[uid1])
 	assertEqualsSlice(t, "Values 2", []uint32{11, 56, 87, 17, 89}, pm.Memory[uid2])
@@ -124,8 +124,8 @@ func TestRemoveOldProcesses(t *testing.T) {
 	pMock := proci.GenerateMock(3)
 	m := CreateMeasurement(2, 4, 2, 4, pMock)
 
-	m.measureAndLog(true)
-	m.removeOldProcesses()
+	m.MeasureAndLog(true)
+	m.RemoveOldProcesses()
 	assertEqualsInt(t, "Number of alive processes", 3, len(m.PM.Alive))
 	assertEqualsInt(t, "Total number of processes", 3, len(m.PM.All))
 
@@ -134,64 +134,64 @@ func TestRemoveOldProcesses(t *testing.T) {
 	delete(pMock.Processes, 2)
 
 	time.Sleep(50 * time.Millisecond) // To make time differ
-	m.measureAndLog(false)
-	m.removeOldProcesses()
+	m.MeasureAndLog(false)
+	m.RemoveOldProcesses()
 	assertEqualsInt(t, "Number of alive processes", 2, len(m.PM.Alive))
 	assertEqualsInt(t, "Total number of processes", 3, len(m.PM.All))
 	_, hasElement := m.PM.All[uid]
 	assertTrue(t, "Removed process still available", hasElement)
 
 	time.Sleep(50 * time.Millisecond) // To make time differ
-	m.measureAndLog(true)
-	m.removeOldProcesses()
+	m.MeasureAndLog(true)
+	m.RemoveOldProcesses()
 	assertEqualsInt(t, "Number of alive processes", 2, len(m.PM.Alive))
 	assertEqualsInt(t, "Total number of processes", 3, len(m.PM.All))
 	_, hasElement = m.PM.All[uid]
 	assertTrue(t, "Removed process still available", hasElement)
 
 	time.Sleep(50 * time.Millisecond) // To make time differ
-	m.measureAndLog(false)
-	m.removeOldProcesses()
+	m.MeasureAndLog(false)
+	m.RemoveOldProcesses()
 	assertEqualsInt(t, "Number of alive processes", 2, len(m.PM.Alive))
 	assertEqualsInt(t, "Total number of processes", 3, len(m.PM.All))
 	_, hasElement = m.PM.All[uid]
 	assertTrue(t, "Removed process still available", hasElement)
 
 	time.Sleep(50 * time.Millisecond) // To make time differ
-	m.measureAndLog(true)
-	m.removeOldProcesses()
+	m.MeasureAndLog(true)
+	m.RemoveOldProcesses()
 	assertEqualsInt(t, "Number of alive processes", 2, len(m.PM.Alive))
 	assertEqualsInt(t, "Total number of processes", 3, len(m.PM.All))
 	_, hasElement = m.PM.All[uid]
 	assertTrue(t, "Removed process still available", hasElement)
 
 	time.Sleep(50 * time.Millisecond) // To make time differ
-	m.measureAndLog(false)
-	m.removeOldProcesses()
+	m.MeasureAndLog(false)
+	m.RemoveOldProcesses()
 	assertEqualsInt(t, "Number of alive processes", 2, len(m.PM.Alive))
 	assertEqualsInt(t, "Total number of processes", 3, len(m.PM.All))
 	_, hasElement = m.PM.All[uid]
 	assertTrue(t, "Removed process still available", hasElement)
 
 	time.Sleep(50 * time.Millisecond) // To make time differ
-	m.measureAndLog(true)
-	m.removeOldProcesses()
+	m.MeasureAndLog(true)
+	m.RemoveOldProcesses()
 	assertEqualsInt(t, "Number of alive processes", 2, len(m.PM.Alive))
 	assertEqualsInt(t, "Total number of processes", 3, len(m.PM.All))
 	_, hasElement = m.PM.All[uid]
 	assertTrue(t, "Removed process still available", hasElement)
 
 	time.Sleep(50 * time.Millisecond) // To make time differ
-	m.measureAndLog(false)
-	m.removeOldProcesses()
+	m.MeasureAndLog(false)
+	m.RemoveOldProcesses()
 	assertEqualsInt(t, "Number of alive processes", 2, len(m.PM.Alive))
 	assertEqualsInt(t, "Total number of processes", 3, len(m.PM.All))
 	_, hasElement = m.PM.All[uid]
 	assertTrue(t, "Removed process still available", hasElement)
 
 	time.Sleep(50 * time.Millisecond) // To make time differ
-	m.measureAndLog(true)
-	m.removeOldProcesses()
+	m.MeasureAndLog(true)
+	m.RemoveOldProcesses()
 	assertEqualsInt(t, "Number of alive processes", 2, len(m.PM.Alive))
 	assertEqualsInt(t, "Total number of processes", 2, len(m.PM.All))
 	_, hasElement = m.PM.All[uid]
@@ -201,23 +201,43 @@ func TestRemoveOldProcesses(t *testing.T) {
 func TestMeasurement(t *testing.T) {
 	m := CreateMeasurement(2, 4, 200, 3, proci.Proci{})
 
-	m.measureAndLog(false)
+	m.MeasureAndLog(false)
 	assertEqualsInt(t, "Size of FastLogger", 1, m.FastLogger.NbrRows)
 	assertEqualsInt(t, "Size of SlowLogger", 0, m.SlowLogger.NbrRows)
 
-	m.measureAndLog(true)
+	m.MeasureAndLog(true)
 	assertEqualsInt(t, "Size of FastLogger", 2, m.FastLogger.NbrRows)
 	assertEqualsInt(t, "Size of SlowLogger", 1, m.SlowLogger.NbrRows)
 
-	m.measureAndLog(false)
+	m.MeasureAndLog(false)
 	assertEqualsInt(t, "Size of FastLogger", 2, m.FastLogger.NbrRows)
 	assertEqualsInt(t, "Size of SlowLogger", 1, m.SlowLogger.NbrRows)
 
-	m.measureAndLog(true)
+	m.MeasureAndLog(true)
 	assertEqualsInt(t, "Size of FastLogger", 2, m.FastLogger.NbrRows)
 	assertEqualsInt(t, "Size of SlowLogger", 2, m.SlowLogger.NbrRows)
 }
 
+func TestReconfigure(t *testing.T) {
+	pMock := proci.GenerateMock(3)
+	m := CreateMeasurement(4, 4, 2, 4, pMock)
+	for i := 0; i < 4; i++ {
+		time.Sleep(10 * time.Millisecond) // To make time differ
+		pMock.Processes[1].MemoryUsage = uint64(1024 * (i + 1))
+		m.MeasureAndLog(i%2 == 0)
+	}
+
+	uid := m.PM.Alive[1].UID
+
+	m.Reconfigure(2, 6, 100, 2)
+	assertEqualsInt(t, "FastLogTimeMs", 100, m.FastLogTimeMs)
+	assertEqualsInt(t, "SlowLogFactor", 2, m.SlowLogFactor)
+	assertEqualsInt(t, "FastLogger.MaxRows", 2, m.FastLogger.MaxRows)
+	assertEqualsInt(t, "SlowLogger.MaxRows", 6, m.SlowLogger.MaxRows)
+	pm := m.GetProcessMeasurements([]int{uid})
+	assertEqualsSlice(t, "Values", []uint32{1, 3, 4}, pm.Memory[uid])
+}
+
 func TestMeasureLoop(t *testing.T) {
 	m := CreateMeasurement(20, 20, 500, 2, proci.Proci{})
 	m.Start()
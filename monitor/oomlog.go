@@ -0,0 +1,118 @@
+package monitor
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// oomKillPattern matches the message of the kernel OOM killer, for example
+// "Out of memory: Killed process 1234 (myapp) total-vm:..." or
+// "Memory cgroup out of memory: Killed process 1234 (myapp) ..."
+var oomKillPattern = regexp.MustCompile(`[Kk]illed process (\d+) \(([^)]*)\)`)
+
+// oomLogPollTime is the time between reads when the end of the log is
+// reached
+const oomLogPollTime = time.Second
+
+// OOMKill is a process killed by the OOM killer, found in the kernel log
+type OOMKill struct {
+	Pid     uint32
+	Name    string // Name of the process (truncated by the kernel)
+	Message string // The log message, without the prefix of /dev/kmsg
+}
+
+// OOMLog follows a kernel log, such as /dev/kmsg or /var/log/kern.log, and
+// collects the processes killed by the OOM killer. Only messages written
+// after the log was opened are used.
+type OOMLog struct {
+	FileName string
+	file     *os.File
+	mutex    sync.Mutex
+	kills    []OOMKill // Use mutex for read/write
+}
+
+// OpenOOMLog opens the kernel log and starts following it
+func OpenOOMLog(fileName string) (*OOMLog, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = file.Seek(0, io.SeekEnd); err != nil {
+		file.Close()
+		return nil, err
+	}
+	l := &OOMLog{FileName: fileName, file: file}
+	go l.follow()
+	return l, nil
+}
+
+// Close stops following the log
+func (l *OOMLog) Close() error {
+	return l.file.Close()
+}
+
+// follow reads the log until it is closed. A regular file is polled when
+// the end is reached, while reads of /dev/kmsg block until a message is
+// written.
+func (l *OOMLog) follow() {
+	reader := bufio.NewReader(l.file)
+	line := ""
+	for {
+		text, err := reader.ReadString('\n')
+		line += text
+		if err == nil {
+			if kill, isKill := parseOOMKill(line); isKill {
+				l.mutex.Lock()
+				l.kills = append(l.kills, kill)
+				l.mutex.Unlock()
+			}
+			line = ""
+			continue
+		}
+		if errors.Is(err, syscall.EPIPE) {
+			// Messages of /dev/kmsg were overwritten before they were read.
+			// Reading continues with the oldest message available.
+			line = ""
+			continue
+		}
+		if err != io.EOF {
+			return // Closed or failed
+		}
+		time.Sleep(oomLogPollTime)
+	}
+}
+
+// takeKills returns the kills found since the previous call
+func (l *OOMLog) takeKills() []OOMKill {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	kills := l.kills
+	l.kills = nil
+	return kills
+}
+
+// parseOOMKill parses a line of the kernel log. Returns false if the line
+// isn't a message of the OOM killer.
+func parseOOMKill(line string) (OOMKill, bool) {
+	match := oomKillPattern.FindStringSubmatchIndex(line)
+	if match == nil {
+		return OOMKill{}, false
+	}
+	pid, err := strconv.ParseUint(line[match[2]:match[3]], 10, 32)
+	if err != nil {
+		return OOMKill{}, false
+	}
+	message := line
+	if index := strings.Index(line[:match[0]], ";"); index >= 0 {
+		message = line[index+1:] // Prefix of /dev/kmsg, for example 3,1234,5678,-;
+	}
+	return OOMKill{Pid: uint32(pid), Name: line[match[4]:match[5]], Message: strings.TrimSpace(message)}, true
+}
@@ -0,0 +1,54 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseOOMKill(t *testing.T) {
+	kill, isKill := parseOOMKill("3,1234,5678,-;Out of memory: Killed process 4321 (myapp) total-vm:123kB, anon-rss:100kB\n")
+	assertTrue(t, "Kill", isKill)
+	assertEqualsInt(t, "PID", 4321, int(kill.Pid))
+	assertEqualsStr(t, "Name", "myapp", kill.Name)
+	assertEqualsStr(t, "Message", "Out of memory: Killed process 4321 (myapp) total-vm:123kB, anon-rss:100kB", kill.Message)
+
+	kill, isKill = parseOOMKill("Oct 19 10:00:00 host kernel: [ 12.3] Memory cgroup out of memory: Killed process 99 (java) total-vm:1kB")
+	assertTrue(t, "Cgroup kill", isKill)
+	assertEqualsInt(t, "PID", 99, int(kill.Pid))
+
+	_, isKill = parseOOMKill("6,1235,5679,-;usb 1-1: new high-speed USB device")
+	assertTrue(t, "Not a kill", !isKill)
+}
+
+func TestOpenOOMLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "kern.log")
+	ioutil.WriteFile(fileName, []byte("Out of memory: Killed process 1 (old)\n"), 0644)
+
+	l, err := OpenOOMLog(fileName)
+	assertTrue(t, "Opened", err == nil)
+	defer l.Close()
+	file, _ := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, 0644)
+	file.WriteString("other message\nOut of memory: Killed process 2 (new)\n")
+	file.Close()
+
+	// Only messages written after the log was opened are used
+	var kills []OOMKill
+	for i := 0; i < 30 && len(kills) == 0; i++ {
+		time.Sleep(100 * time.Millisecond)
+		kills = l.takeKills()
+	}
+	assertEqualsInt(t, "Kills", 1, len(kills))
+	assertEqualsInt(t, "PID", 2, int(kills[0].Pid))
+	assertEqualsInt(t, "Taken", 0, len(l.takeKills()))
+
+	_, err = OpenOOMLog(filepath.Join(dir, "missing"))
+	assertTrue(t, "Missing", err != nil)
+}
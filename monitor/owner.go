@@ -0,0 +1,119 @@
+package monitor
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Prefixes of matchers that match the owner of a process (see
+// Process.Matches)
+const (
+	UserPrefix      = "user:"      // User name or ID
+	SessionPrefix   = "session:"   // Session ID
+	CgroupPrefix    = "cgroup:"    // Part of the control group path
+	ContainerPrefix = "container:" // Container ID or the start of it
+)
+
+// ownerPrefixes are all prefixes of matchers that match the owner
+var ownerPrefixes = []string{UserPrefix, SessionPrefix, CgroupPrefix, ContainerPrefix}
+
+// Owner identifies who is running a process. It is read when the process is
+// first seen. Fields that cannot be read on the platform are empty.
+type Owner struct {
+	User        string // User name. On Windows including the domain (DOMAIN\name)
+	UserID      string // User ID on Linux, SID on Windows
+	Session     uint32 // Session ID (Windows session or Linux session leader PID)
+	Cgroup      string // Control group (Linux)
+	ContainerID string // ID of the container running the process, found in the control group (Linux)
+}
+
+// OwnerReader is implemented by process interfaces that can read the owner
+// of a process.
+type OwnerReader interface {
+	GetProcessOwner(pid uint32) (Owner, error)
+}
+
+// containerIDPattern matches the container IDs of Docker, Podman and
+// containerd in control group paths
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// isOwnerMatcher returns true if the matcher matches the owner of processes
+func isOwnerMatcher(matcher string) bool {
+	for _, prefix := range ownerPrefixes {
+		if strings.HasPrefix(matcher, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches returns true if the process matches the matcher. A matcher
+// starting with user:, session:, cgroup: or container: matches the owner of
+// the process. Other matchers match text in the path, name or command
+// line.
+func (p *Process) Matches(matcher string) bool {
+	switch {
+	case strings.HasPrefix(matcher, UserPrefix):
+		user := strings.TrimPrefix(matcher, UserPrefix)
+		return IsUser(p.User, user) || (p.UserID != "" && p.UserID == user)
+	case strings.HasPrefix(matcher, SessionPrefix):
+		session, err := strconv.ParseUint(strings.TrimPrefix(matcher, SessionPrefix), 10, 32)
+		return err == nil && p.Session == uint32(session)
+	case strings.HasPrefix(matcher, CgroupPrefix):
+		return p.Cgroup != "" && strings.Contains(p.Cgroup, strings.TrimPrefix(matcher, CgroupPrefix))
+	case strings.HasPrefix(matcher, ContainerPrefix):
+		container := strings.TrimPrefix(matcher, ContainerPrefix)
+		return p.ContainerID != "" && container != "" && strings.HasPrefix(p.ContainerID, container)
+	}
+	return strings.Contains(p.Path, matcher) ||
+		strings.Contains(p.Name, matcher) ||
+		strings.Contains(p.CommandLine, matcher)
+}
+
+// IsUser returns true if user is the user with the provided name. On
+// Windows the user includes the domain, such as DOMAIN\name, which matches
+// both DOMAIN\name and name. The comparison is case insensitive.
+func IsUser(user string, name string) bool {
+	if user == "" {
+		return false
+	}
+	if strings.EqualFold(user, name) {
+		return true
+	}
+	index := strings.LastIndex(user, `\`)
+	return index >= 0 && strings.EqualFold(user[index+1:], name)
+}
+
+// parseCgroup returns the control group of a process from the content of
+// /proc/<pid>/cgroup. The memory controller hierarchy (v1) is preferred,
+// since the unified (v2) hierarchy has no controllers if both are used.
+func parseCgroup(content string) string {
+	unified := ""
+	for _, line := range strings.Split(content, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			unified = parts[2]
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			if controller == "memory" {
+				return parts[2]
+			}
+		}
+	}
+	return unified
+}
+
+// parseContainerID returns the container ID in a control group path, such
+// as /docker/<id> or /system.slice/docker-<id>.scope. Empty if the path
+// has no container ID.
+func parseContainerID(cgroup string) string {
+	ids := containerIDPattern.FindAllString(cgroup, -1)
+	if len(ids) == 0 {
+		return ""
+	}
+	return ids[len(ids)-1]
+}
@@ -0,0 +1,48 @@
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// getProcessOwner reads the real user ID of a process from
+// /proc/<pid>/status, the session from /proc/<pid>/stat and the control
+// group from /proc/<pid>/cgroup. The user name is the user ID if the user
+// has no name.
+func getProcessOwner(pid uint32) (Owner, error) {
+	var owner Owner
+	status, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return owner, err
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if !strings.HasPrefix(line, "Uid:") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "Uid:"))
+		if len(fields) > 0 {
+			owner.UserID = fields[0]
+			owner.User = fields[0]
+			if u, err := user.LookupId(fields[0]); err == nil {
+				owner.User = u.Username
+			}
+		}
+		break
+	}
+	if owner.UserID == "" {
+		return owner, fmt.Errorf("Invalid status of process %d", pid)
+	}
+	if fields, err := readStat(pid); err == nil {
+		if session, err := strconv.ParseUint(fields[3], 10, 32); err == nil {
+			owner.Session = uint32(session)
+		}
+	}
+	if cgroup, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid)); err == nil {
+		owner.Cgroup = parseCgroup(string(cgroup))
+		owner.ContainerID = parseContainerID(owner.Cgroup)
+	}
+	return owner, nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package monitor
+
+import "fmt"
+
+// getProcessOwner is not supported on this platform
+func getProcessOwner(pid uint32) (Owner, error) {
+	return Owner{}, fmt.Errorf("Process owner not supported on this platform")
+}
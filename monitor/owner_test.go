@@ -0,0 +1,56 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/midstar/proci"
+)
+
+func TestProcessMatches(t *testing.T) {
+	p := &Process{Path: "/usr/bin/app", Name: "app", CommandLine: "app -x",
+		Owner: Owner{User: "jenkins-7", UserID: "1007", Session: 42, Cgroup: "/system.slice/docker-0123abcd.scope",
+			ContainerID: "0123abcd"}}
+	assertTrue(t, "Path", p.Matches("/usr/bin"))
+	assertTrue(t, "Command line", p.Matches("-x"))
+	assertTrue(t, "User", p.Matches("user:jenkins-7"))
+	assertTrue(t, "User ID", p.Matches("user:1007"))
+	assertTrue(t, "Other user", !p.Matches("user:jenkins"))
+	assertTrue(t, "Session", p.Matches("session:42"))
+	assertTrue(t, "Other session", !p.Matches("session:4"))
+	assertTrue(t, "Cgroup", p.Matches("cgroup:docker"))
+	assertTrue(t, "Container", p.Matches("container:0123"))
+	assertTrue(t, "Other container", !p.Matches("container:abcd"))
+	assertTrue(t, "Empty container", !(&Process{}).Matches("container:"))
+
+	assertTrue(t, "Windows user", IsUser(`BUILD\Jenkins`, "jenkins"))
+	assertTrue(t, "Windows user with domain", IsUser(`BUILD\Jenkins`, `build\jenkins`))
+	assertTrue(t, "No user", !IsUser("", ""))
+}
+
+func TestParseCgroup(t *testing.T) {
+	id := "4f1e7cd0b52e7e9f5c4d1a3b2c6e8f0a1b2c3d4e5f60718293a4b5c6d7e8f901"
+	v1 := "12:pids:/docker/" + id + "\n4:memory:/docker/" + id + "\n1:name=systemd:/docker/" + id + "\n"
+	assertEqualsStr(t, "Memory controller", "/docker/"+id, parseCgroup(v1))
+	assertEqualsStr(t, "Hybrid", "/docker/"+id, parseCgroup(v1+"0::/\n"))
+	v2 := "0::/system.slice/docker-" + id + ".scope\n"
+	assertEqualsStr(t, "Unified", "/system.slice/docker-"+id+".scope", parseCgroup(v2))
+	assertEqualsStr(t, "Container ID", id, parseContainerID(parseCgroup(v2)))
+	assertEqualsStr(t, "No container", "", parseContainerID("/user.slice/user-1000.slice/session-2.scope"))
+	assertEqualsStr(t, "Invalid", "", parseCgroup("invalid"))
+}
+
+func TestUpdateOwner(t *testing.T) {
+	oMock := ownerMock{Mock: proci.GenerateMock(3), owners: map[uint32]Owner{
+		1: {User: "root", UserID: "0"}, 2: {User: "jenkins-7", UserID: "1007"}, 3: {User: "jenkins-8", UserID: "1008"}}}
+	pMap := NewProcessMap(oMock)
+	pMap.Update()
+	assertEqualsStr(t, "User", "jenkins-7", pMap.Alive[2].User)
+	uids := pMap.GetUIDs("user:jenkins-7")
+	assertEqualsInt(t, "Processes of user", 1, len(uids))
+	assertEqualsInt(t, "PID", 2, int(pMap.All[uids[0]].Pid))
+
+	// Processes without owner reader have no owner
+	pMap = NewProcessMap(proci.GenerateMock(1))
+	pMap.Update()
+	assertEqualsStr(t, "No user", "", pMap.Alive[1].User)
+}
@@ -0,0 +1,46 @@
+package monitor
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// processQueryLimitedInformation is the access right needed to open the
+// token of processes owned by other users
+const processQueryLimitedInformation = 0x1000
+
+var kernel32 = syscall.NewLazyDLL("kernel32.dll")
+
+var procProcessIDToSessionID = kernel32.NewProc("ProcessIdToSessionId")
+
+// getProcessOwner reads the user of the process token and the session of
+// the process
+func getProcessOwner(pid uint32) (Owner, error) {
+	var owner Owner
+	process, err := syscall.OpenProcess(processQueryLimitedInformation, false, pid)
+	if err != nil {
+		return owner, err
+	}
+	defer syscall.CloseHandle(process)
+	var token syscall.Token
+	if err = syscall.OpenProcessToken(process, syscall.TOKEN_QUERY, &token); err != nil {
+		return owner, err
+	}
+	defer token.Close()
+	tokenUser, err := token.GetTokenUser()
+	if err != nil {
+		return owner, err
+	}
+	if owner.UserID, err = tokenUser.User.Sid.String(); err != nil {
+		return owner, err
+	}
+	owner.User = owner.UserID
+	if account, domain, _, err := tokenUser.User.Sid.LookupAccount(""); err == nil {
+		owner.User = domain + `\` + account
+	}
+	var session uint32
+	if r, _, _ := procProcessIDToSessionID.Call(uintptr(pid), uintptr(unsafe.Pointer(&session))); r != 0 {
+		owner.Session = session
+	}
+	return owner, nil
+}
@@ -0,0 +1,40 @@
+package monitor
+
+import (
+	"github.com/midstar/proci"
+)
+
+// SystemProci reads the processes of the operating system. It extends
+// proci.Proci with the parent (see ParentReader) and the owner (see
+// OwnerReader) of the processes, the number of file descriptors and threads
+// of the processes (see CountReader), the I/O of the processes (see
+// IOReader) and the breakdown of the system memory (see SystemMemoryReader).
+type SystemProci struct {
+	proci.Proci
+}
+
+// GetProcessParentPid returns the PID of the parent of a process
+func (p SystemProci) GetProcessParentPid(pid uint32) (uint32, error) {
+	return getParentPid(pid)
+}
+
+// GetProcessOwner returns the owner of a process
+func (p SystemProci) GetProcessOwner(pid uint32) (Owner, error) {
+	return getProcessOwner(pid)
+}
+
+// GetProcessCounts returns the number of file descriptors and threads of a
+// process
+func (p SystemProci) GetProcessCounts(pid uint32) (ProcessCounts, error) {
+	return getProcessCounts(pid)
+}
+
+// GetProcessIO returns the I/O counters of a process
+func (p SystemProci) GetProcessIO(pid uint32) (ProcessIO, error) {
+	return getProcessIO(pid)
+}
+
+// GetSystemMemory returns the breakdown of the system memory
+func (p SystemProci) GetSystemMemory() (SystemMemory, error) {
+	return getSystemMemory()
+}
@@ -0,0 +1,38 @@
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// readStat returns the fields of /proc/<pid>/stat after the command name,
+// i.e. starting with the state
+func readStat(pid uint32) ([]string, error) {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+	// The format is "pid (comm) state ppid ...", where comm might
+	// include spaces and parentheses
+	end := strings.LastIndex(string(stat), ")")
+	if end < 0 {
+		return nil, fmt.Errorf("Invalid stat of process %d", pid)
+	}
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("Invalid stat of process %d", pid)
+	}
+	return fields, nil
+}
+
+// getParentPid reads the parent PID from /proc/<pid>/stat
+func getParentPid(pid uint32) (uint32, error) {
+	fields, err := readStat(pid)
+	if err != nil {
+		return 0, err
+	}
+	parentPid, err := strconv.ParseUint(fields[1], 10, 32)
+	return uint32(parentPid), err
+}
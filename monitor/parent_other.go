@@ -0,0 +1,11 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package monitor
+
+import "fmt"
+
+// getParentPid is not supported on this platform
+func getParentPid(pid uint32) (uint32, error) {
+	return 0, fmt.Errorf("Parent process not supported on this platform")
+}
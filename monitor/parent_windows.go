@@ -0,0 +1,24 @@
+package monitor
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// getParentPid finds the parent PID in a snapshot of all processes
+func getParentPid(pid uint32) (uint32, error) {
+	snapshot, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer syscall.CloseHandle(snapshot)
+	var entry syscall.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	for err = syscall.Process32First(snapshot, &entry); err == nil; err = syscall.Process32Next(snapshot, &entry) {
+		if entry.ProcessID == pid {
+			return entry.ParentProcessID, nil
+		}
+	}
+	return 0, fmt.Errorf("Process %d not found", pid)
+}
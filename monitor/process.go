@@ -0,0 +1,338 @@
+package monitor
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/midstar/proci"
+)
+
+// Process represent one unique process
+type Process struct {
+	UID            int        // Unique ID
+	Pid            uint32     // Process PID
+	ParentPid      uint32     // PID of the parent process (0 if unknown)
+	IsAlive        bool       // Is process alive?
+	Path           string     // The process path (and name)
+	Name           string     // Name of the process (last part of Path)
+	CommandLine    string     // The process command line
+	Owner                     // Who is running the process
+	MaxMemoryEver  uint32     // Maximum memory ever measured (KB)
+	MinMemoryEver  uint32     // Minimum memory ever measured (KB)
+	LastMemory     uint32     // Last memory measured (KB)
+	LastFDs        uint32     // Last number of file descriptors (handles on Windows) measured
+	MaxFDsEver     uint32     // Maximum number of file descriptors ever measured
+	LastThreads    uint32     // Last number of threads measured
+	MaxThreadsEver uint32     // Maximum number of threads ever measured
+	IO             *ProcessIO // Cumulative I/O counters at the last measurement (nil if not measured)
+	Created        time.Time  // When this process was created (or first seen)
+	Died           time.Time  // When this process died
+	Exit           Exit       // Why this process died, if known
+}
+
+// PhysicalMemory represents the physical RAM memory
+type PhysicalMemory struct {
+	TotalPhys        uint32    // Total memory installed (KB)
+	MaxPhysEver      uint32    // Maximum used physical memory ever measured (KB)
+	MinPhysEver      uint32    // Minimum used physical memory ever measured (KB)
+	LastPhys         uint32    // Last used physical memory measured (KB)
+	SystemMemory               // Last breakdown of the system memory measured
+	HasSystemMemory  bool      // True if SystemMemory was measured (depends on platform)
+	PageFaultRate    uint32    // Page faults per second at the last measurement
+	lastSystemUpdate time.Time // When SystemMemory was last measured
+}
+
+// ProcessMap has two internal maps. Both maps are pointing to the
+// same Process objects, but keyed on different identities.
+// The reason for this design is that the PID's might be reused by
+// the operating system.
+type ProcessMap struct {
+	nextUniqueID int                 // Increment for each created process
+	All          map[int]*Process    // A map with all processes, keyed on UID
+	Alive        map[uint32]*Process // A map with the living processes, keyd on PID
+	Phys         *PhysicalMemory     // Represents the physical memory
+	LastUpdate   time.Time           // Last time this map was updated
+	Pi           proci.Interface     // Interface for reading processes
+	Redactor     *Redactor           // Removes secrets from command lines (nil = no redaction)
+	Filter       *ProcessFilter      // Decides which processes are tracked (nil = all processes)
+	Untracked    uint32              // Memory used by the processes not tracked at the last update (KB)
+	CgroupRoot   string              // Where the cgroup file system is mounted. Empty means no cgroup accounting
+	Cgroups      map[string]*Cgroup  // Cgroups of the processes, keyed on path
+	OOMLog       *OOMLog             // Kernel log with OOM kills (nil = not used)
+	untracked    map[uint32]untrackedProcess
+	died         []*Process // Processes that died in the last update
+}
+
+// untrackedProcess is a process not tracked due to the filter
+type untrackedProcess struct {
+	path     string // Path of the process. The filter is checked again if the PID is reused
+	excluded bool   // Excluded by the patterns of the filter, i.e. not only due to the memory
+}
+
+// ParentReader is implemented by process interfaces that can read the
+// parent of a process. The parent is needed to find the descendants of a
+// process.
+type ParentReader interface {
+	GetProcessParentPid(pid uint32) (uint32, error)
+}
+
+// NewProcessMap creates a new process map
+func NewProcessMap(pi proci.Interface) *ProcessMap {
+	// set only specific field value with field key
+	return &ProcessMap{
+		nextUniqueID: 0,
+		All:          make(map[int]*Process),
+		Alive:        make(map[uint32]*Process),
+		Phys:         &PhysicalMemory{},
+		Cgroups:      make(map[string]*Cgroup),
+		Pi:           pi}
+}
+
+// CreateProcess creates a new process in the ProcessMap. It will assign it
+// a unique identity and put it in both the All and Alive maps. If another
+// process with the same PID exist in the All map, the old process will be
+// set to Alive = false and removed from the All list.
+func (processMap *ProcessMap) CreateProcess(pid uint32, fullPath string, commandLine string) *Process {
+	processMap.nextUniqueID++
+	uid := processMap.nextUniqueID
+	_, name := filepath.Split(fullPath)
+	process := Process{
+		UID:         uid,
+		Pid:         pid,
+		IsAlive:     true,
+		Path:        fullPath,
+		Name:        name,
+		CommandLine: commandLine,
+		Created:     time.Now()}
+	_, hasPid := processMap.Alive[pid]
+	if hasPid {
+		processMap.ProcessKilled(pid)
+	}
+	processMap.All[uid] = &process
+	processMap.Alive[pid] = &process
+	return &process
+}
+
+// AddProcess adds a copy of a process, for example a process measured on
+// another host, to the All map. The copy is assigned a new unique identity.
+func (processMap *ProcessMap) AddProcess(p Process) *Process {
+	processMap.nextUniqueID++
+	p.UID = processMap.nextUniqueID
+	processMap.All[p.UID] = &p
+	return &p
+}
+
+// ProcessKilled removed process from Alive
+func (processMap *ProcessMap) ProcessKilled(pid uint32) {
+	process := processMap.Alive[pid]
+	process.IsAlive = false
+	process.Died = time.Now()
+	delete(processMap.Alive, pid)
+	processMap.died = append(processMap.died, process)
+}
+
+// GetUIDs returns a slice with UIDs of processes that match the matcher
+// parameter in path, name OR commandLine, or the owner if the matcher
+// starts with for example user: (see Process.Matches). All processes,
+// including dead are searched.
+func (processMap *ProcessMap) GetUIDs(matcher string) []int {
+	result := make([]int, 0, len(processMap.All))
+	for uid, process := range processMap.All {
+		if process.Matches(matcher) {
+			result = append(result, uid)
+		}
+	}
+	return result
+}
+
+// GetDescendants returns the UIDs together with the UIDs of all their
+// descendants (children, grand children etc.). A process is a child if
+// its parent PID is the PID of the parent process and it was created while
+// the parent was alive, since PIDs are reused.
+func (processMap *ProcessMap) GetDescendants(uids []int) []int {
+	result := append([]int{}, uids...)
+	included := make(map[int]bool)
+	for _, uid := range uids {
+		included[uid] = true
+	}
+	for i := 0; i < len(result); i++ {
+		parent, hasElement := processMap.All[result[i]]
+		if !hasElement {
+			continue
+		}
+		for uid, process := range processMap.All {
+			if included[uid] || process.ParentPid != parent.Pid || process.Pid == parent.Pid ||
+				process.Created.Before(parent.Created) ||
+				(!parent.IsAlive && process.Created.After(parent.Died)) {
+				continue
+			}
+			included[uid] = true
+			result = append(result, uid)
+		}
+	}
+	return result
+}
+
+// Update starts with setting living processes to IsAlive = false, then it will
+// go through all processes reported by the operating system and update the
+// corresponding process in the dictionary. If if a new process is detected a
+// new entry in the process map is added.
+//
+// The Pid, Path, Name and CommandLine fields of the process are only
+//updated if the process is new.
+//
+// If the process is dead it will be removed from the Alive field in ProcessMap.
+func (processMap *ProcessMap) Update() {
+	// Processes found in the same update are created at the same time, so
+	// that a child found before its parent isn't created before it
+	now := time.Now()
+	processMap.died = nil
+
+	// Start with setting all processes to IsAlive = false
+	for _, process := range processMap.Alive {
+		process.IsAlive = false
+	}
+
+	// List and update or create all processes
+
+	untracked := make(map[uint32]untrackedProcess)
+	var untrackedMemory uint32
+	pids := processMap.Pi.GetProcessPids()
+	for i := 0; i < len(pids); i++ {
+		pid := pids[i]
+		process, hasPid := processMap.Alive[pid]
+		fullPath, patherr := processMap.Pi.GetProcessPath(pid)
+		if patherr != nil || fullPath == "" {
+			// This is probably a system process that we cannot access.
+			// Pointless to track this process
+			if hasPid {
+				// It was a valid process with pid this before. I must have
+				// died
+				processMap.ProcessKilled(pid)
+			}
+			continue
+		}
+		if hasPid && fullPath != process.Path {
+			// The fullPath has changed. It must be a new process that has replaced
+			// the old one.
+			processMap.ProcessKilled(pid)
+			hasPid = false
+		}
+		if !hasPid && processMap.Filter != nil {
+			memoryKB, track := processMap.filter(pid, fullPath, untracked)
+			if !track {
+				untrackedMemory += memoryKB
+				continue
+			}
+		}
+		if !hasPid {
+			// We have a new process
+			commandLine, cmderr := processMap.Pi.GetProcessCommandLine(pid)
+			if cmderr != nil {
+				// Expected for some system processes.
+				commandLine = ""
+			}
+			if processMap.Redactor != nil {
+				commandLine = processMap.Redactor.Redact(fullPath, commandLine)
+			}
+			process = processMap.CreateProcess(pid, fullPath, commandLine)
+			process.Created = now
+			process.Owner = processMap.readOwner(pid)
+			if parentReader, isParentReader := processMap.Pi.(ParentReader); isParentReader {
+				if parentPid, err := parentReader.GetProcessParentPid(pid); err == nil {
+					process.ParentPid = parentPid
+				}
+			}
+		}
+		process.IsAlive = true
+
+		memoryUsage, memerr := processMap.Pi.GetProcessMemoryUsage(pid)
+		if memerr != nil {
+			fmt.Println("GetProcessMemoryUsage for PID", pid, "returned error:", memerr)
+			process.LastMemory = 0
+		} else {
+			memoryUsageKB := uint32(memoryUsage / 1024) // Byte to KiloByte
+			if process.MinMemoryEver == 0 || memoryUsageKB < process.MinMemoryEver {
+				process.MinMemoryEver = memoryUsageKB
+			}
+			if memoryUsageKB > process.MaxMemoryEver {
+				process.MaxMemoryEver = memoryUsageKB
+			}
+			process.LastMemory = memoryUsageKB
+		}
+		processMap.updateCounts(process)
+		processMap.updateIO(process)
+	}
+
+	processMap.LastUpdate = time.Now()
+	processMap.untracked = untracked
+	processMap.Untracked = untrackedMemory
+
+	// Mark all processes not listed as killed
+	for pid, process := range processMap.Alive {
+		if process.IsAlive == false {
+			processMap.ProcessKilled(pid)
+		}
+	}
+
+	processMap.updatePhysicalMemory()
+	processMap.updateSystemMemory()
+	processMap.updateCgroups()
+	processMap.applyOOMLog()
+}
+
+// filter returns true if a process that isn't tracked yet shall be
+// tracked according to the filter. Otherwise the memory used by the process
+// (KB) is returned and the process is added to untracked.
+//
+// The patterns are only checked once per process, while processes that use
+// too little memory are checked again in each update.
+func (processMap *ProcessMap) filter(pid uint32, fullPath string, untracked map[uint32]untrackedProcess) (uint32, bool) {
+	process, isKnown := processMap.untracked[pid]
+	if !isKnown || process.path != fullPath {
+		var owner Owner
+		if processMap.Filter.NeedsOwner() {
+			owner = processMap.readOwner(pid)
+		}
+		process = untrackedProcess{path: fullPath, excluded: !processMap.Filter.Matches(fullPath, owner)}
+	}
+	var memoryKB uint32
+	if memoryUsage, memerr := processMap.Pi.GetProcessMemoryUsage(pid); memerr == nil {
+		memoryKB = uint32(memoryUsage / 1024) // Byte to KiloByte
+	}
+	if !process.excluded && memoryKB >= processMap.Filter.MinMemory {
+		return 0, true
+	}
+	untracked[pid] = process
+	return memoryKB, false
+}
+
+// readOwner returns the owner of a process. Empty if the process interface
+// cannot read the owner.
+func (processMap *ProcessMap) readOwner(pid uint32) Owner {
+	if ownerReader, isOwnerReader := processMap.Pi.(OwnerReader); isOwnerReader {
+		if owner, err := ownerReader.GetProcessOwner(pid); err == nil {
+			return owner
+		}
+	}
+	return Owner{}
+}
+
+func (processMap *ProcessMap) updatePhysicalMemory() {
+	// Update the overall (physical memory)
+	memoryStatus, memstaterr := processMap.Pi.GetMemoryStatus()
+	if memstaterr != nil {
+		fmt.Println("GetMemoryStatus returned error:", memstaterr)
+		processMap.Phys.LastPhys = 0
+	} else {
+		processMap.Phys.TotalPhys = uint32(memoryStatus.TotalPhys / 1024)                          // Byte to KiloByte
+		processMap.Phys.LastPhys = processMap.Phys.TotalPhys - uint32(memoryStatus.AvailPhys/1024) // Byte to KiloByte
+		if processMap.Phys.LastPhys > processMap.Phys.MaxPhysEver {
+			processMap.Phys.MaxPhysEver = processMap.Phys.LastPhys
+		}
+		if processMap.Phys.MinPhysEver == 0 || processMap.Phys.LastPhys < processMap.Phys.MinPhysEver {
+			processMap.Phys.MinPhysEver = processMap.Phys.LastPhys
+		}
+	}
+}
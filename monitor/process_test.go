@@ -1,10 +1,11 @@
 // process unit tests
-package main
+package monitor
 
 import (
 	"fmt"
 	"runtime/debug"
 	"testing"
+	"time"
 
 	"github.com/midstar/proci"
 )
@@ -181,6 +182,22 @@ func TestProcessUpdate(t *testing.T) {
 
 }
 
+func TestProcessUpdateRedact(t *testing.T) {
+	pMock := proci.GenerateMock(3)
+	pMock.Processes[1].CommandLine = "app --password=secret"
+	pMock.Processes[2].Path = "c/path/to/hidden.exe"
+	pMap := NewProcessMap(pMock)
+	redactor, err := NewRedactor(nil, true, []string{"hidden.exe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pMap.Redactor = redactor
+	pMap.Update()
+	assertEqualsStr(t, "Process 1 command line", "app --password=****", pMap.Alive[1].CommandLine)
+	assertEqualsStr(t, "Process 2 command line", HiddenCommandLine, pMap.Alive[2].CommandLine)
+	assertEqualsStr(t, "Process 3 command line", "command_line_3", pMap.Alive[3].CommandLine)
+}
+
 func TestGetUIDs(t *testing.T) {
 	p1 := Process{
 		Pid:         1,
@@ -232,3 +249,43 @@ func contains(t *testing.T, returnedUids []int, expectedUids ...int) {
 		}
 	}
 }
+
+// parentMock is a mock that also can read the parent of processes
+type parentMock struct {
+	*proci.Mock
+	parents map[uint32]uint32 // Parent PIDs keyed on PID
+}
+
+func (m parentMock) GetProcessParentPid(pid uint32) (uint32, error) {
+	return m.parents[pid], nil
+}
+
+func TestGetDescendants(t *testing.T) {
+	pMock := parentMock{Mock: proci.GenerateMock(5), parents: map[uint32]uint32{2: 1, 3: 2, 4: 1, 5: 9}}
+	pMap := NewProcessMap(pMock)
+	pMap.Update()
+	assertEqualsInt(t, "Parent of 3", 2, int(pMap.Alive[3].ParentPid))
+	uid1 := pMap.Alive[1].UID
+
+	// PID 2 dies and is reused by a process which isn't a child of 1
+	delete(pMock.Processes, 2)
+	pMap.Update()
+	time.Sleep(time.Millisecond)
+	pMock.Processes[2] = &proci.ProcessMock{Pid: 2, Path: "path_2b", CommandLine: "command_line_2b", MemoryUsage: 1024}
+	pMock.Processes[6] = &proci.ProcessMock{Pid: 6, Path: "path_6", CommandLine: "command_line_6", MemoryUsage: 1024}
+	pMock.parents[2] = 7
+	pMock.parents[6] = 2
+	pMap.Update()
+
+	result := pMap.GetDescendants([]int{uid1})
+	uids := make([]int, 0)
+	for _, uid := range pMap.GetUIDs("path_") {
+		pid := pMap.All[uid].Pid
+		if pid <= 4 && pMap.All[uid].Path != "path_2b" {
+			uids = append(uids, uid)
+		}
+	}
+	contains(t, result, uids...)
+	contains(t, pMap.GetDescendants([]int{pMap.Alive[2].UID}), pMap.Alive[2].UID, pMap.Alive[6].UID)
+	contains(t, pMap.GetDescendants([]int{}))
+}
@@ -0,0 +1,95 @@
+package monitor
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/midstar/proci"
+)
+
+// PidSelector is a process interface that only reports selected processes,
+// and optionally their descendants, of another process interface. It is
+// used to measure a few processes without logging all processes of the
+// system:
+//
+//	selector := monitor.NewPidSelector(monitor.SystemProci{}, true, pid)
+//	m := monitor.CreateMeasurement(1000, 1000, 100, 10, selector)
+//
+// Descendants are only found if the other process interface implements
+// ParentReader.
+type PidSelector struct {
+	proci.Interface
+	Descendants bool // Also select the descendants of the selected processes
+	mutex       *sync.Mutex
+	selected    map[uint32]bool
+}
+
+// NewPidSelector creates a selector of the processes with the provided
+// PIDs. More processes can be selected with Add.
+func NewPidSelector(pi proci.Interface, descendants bool, pids ...uint32) *PidSelector {
+	selector := &PidSelector{
+		Interface:   pi,
+		Descendants: descendants,
+		mutex:       &sync.Mutex{},
+		selected:    make(map[uint32]bool)}
+	for _, pid := range pids {
+		selector.selected[pid] = true
+	}
+	return selector
+}
+
+// Add selects a process
+func (s *PidSelector) Add(pid uint32) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.selected[pid] = true
+}
+
+// GetProcessPids returns the PIDs of the selected processes that are
+// alive. Processes that have died are unselected, since PIDs are reused.
+func (s *PidSelector) GetProcessPids() []uint32 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	pids := s.Interface.GetProcessPids()
+	alive := make(map[uint32]bool, len(pids))
+	for _, pid := range pids {
+		alive[pid] = true
+	}
+	for pid := range s.selected {
+		if !alive[pid] {
+			delete(s.selected, pid)
+		}
+	}
+	if parentReader, isParentReader := s.Interface.(ParentReader); isParentReader && s.Descendants {
+		// Repeat until no more descendants are found, since children
+		// might be listed before their parents
+		for found := true; found; {
+			found = false
+			for _, pid := range pids {
+				if s.selected[pid] {
+					continue
+				}
+				if parentPid, err := parentReader.GetProcessParentPid(pid); err == nil && s.selected[parentPid] && parentPid != pid {
+					s.selected[pid] = true
+					found = true
+				}
+			}
+		}
+	}
+	result := make([]uint32, 0, len(s.selected))
+	for _, pid := range pids {
+		if s.selected[pid] {
+			result = append(result, pid)
+		}
+	}
+	return result
+}
+
+// GetProcessParentPid returns the PID of the parent of a process, if
+// supported by the other process interface
+func (s *PidSelector) GetProcessParentPid(pid uint32) (uint32, error) {
+	if parentReader, isParentReader := s.Interface.(ParentReader); isParentReader {
+		return parentReader.GetProcessParentPid(pid)
+	}
+	return 0, fmt.Errorf("Parent process not supported by the process interface")
+}
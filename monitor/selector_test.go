@@ -0,0 +1,60 @@
+package monitor
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/midstar/proci"
+)
+
+// selectedPids returns the selected PIDs sorted
+func selectedPids(selector *PidSelector) []uint32 {
+	pids := selector.GetProcessPids()
+	sort.Slice(pids, func(i, j int) bool { return pids[i] < pids[j] })
+	return pids
+}
+
+func TestPidSelector(t *testing.T) {
+	pMock := parentMock{Mock: proci.GenerateMock(6), parents: map[uint32]uint32{2: 1, 3: 5, 4: 1, 5: 2, 6: 9}}
+	selector := NewPidSelector(pMock, true, 2)
+	assertEqualsSlice(t, "Selected with descendants", []uint32{2, 3, 5}, selectedPids(selector))
+
+	selector.Add(6)
+	assertEqualsSlice(t, "Added", []uint32{2, 3, 5, 6}, selectedPids(selector))
+
+	// Died processes are unselected, since PIDs are reused
+	delete(pMock.Processes, 6)
+	selector.GetProcessPids()
+	pMock.Processes[6] = &proci.ProcessMock{Pid: 6, Path: "path_6b", CommandLine: "command_line_6b", MemoryUsage: 1024}
+	assertEqualsSlice(t, "Died", []uint32{2, 3, 5}, selectedPids(selector))
+
+	selector = NewPidSelector(pMock, false, 2)
+	assertEqualsSlice(t, "Without descendants", []uint32{2}, selectedPids(selector))
+
+	// Descendants are not found without parents
+	selector = NewPidSelector(proci.GenerateMock(6), true, 2)
+	assertEqualsSlice(t, "No parent reader", []uint32{2}, selectedPids(selector))
+	_, err := selector.GetProcessParentPid(2)
+	assertTrue(t, "Parent not supported", err != nil)
+}
+
+func TestMeasurePidSelector(t *testing.T) {
+	pMock := parentMock{Mock: proci.GenerateMock(6), parents: map[uint32]uint32{2: 1, 3: 2}}
+	m := CreateMeasurement(10, 10, 3, 6, NewPidSelector(pMock, true, 2))
+	m.MeasureAndLog(false)
+	time.Sleep(2 * time.Millisecond) // To make time differ
+	pMock.Processes[3].MemoryUsage = 10 * 1024
+	m.MeasureAndLog(false)
+
+	result := m.GetMinMaxMem(m.PM.GetUIDs("path_"), time.Time{}, time.Time{})
+	assertEqualsInt(t, "Processes", 2, len(result))
+	if result[0].Pid == 3 {
+		result[0], result[1] = result[1], result[0]
+	}
+	assertEqualsInt(t, "PID", 2, int(result[0].Pid))
+	assertEqualsInt(t, "Child PID", 3, int(result[1].Pid))
+	assertEqualsInt(t, "Parent", 2, int(result[1].ParentPid))
+	assertEqualsInt(t, "Max", 10, int(result[1].MaxMemoryInPeriod))
+	assertEqualsInt(t, "Min", 4, int(result[1].MinMemoryInPeriod))
+}
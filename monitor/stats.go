@@ -0,0 +1,98 @@
+package monitor
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Stats is a statistical summary of the memory of a process during a
+// specific time. Only measurements where the process was alive are
+// included. All values are 0 if there are no such measurements.
+type Stats struct {
+	Count   int     // Number of measurements
+	Min     uint32  // KB
+	Max     uint32  // KB
+	Mean    float64 // KB
+	Median  float64 // KB
+	P90     float64 // 90th percentile (KB)
+	P95     float64 // 95th percentile (KB)
+	P99     float64 // 99th percentile (KB)
+	StdDev  float64 // Standard deviation (KB)
+	KBHours float64 // Memory integrated over time, i.e. the area under the curve (KB·hours)
+}
+
+// ProcessStats is a process with a statistical summary of its memory
+// during a specific time
+type ProcessStats struct {
+	Process
+	Stats Stats
+}
+
+// GetStats returns statistical summaries of the memory of the provided
+// processes between from and to, sorted on UID. Zero values of from and/or
+// to means no restriction.
+func (m *Measurement) GetStats(uids []int, from time.Time, to time.Time) []ProcessStats {
+	measurements := m.GetProcessMeasurementsBetween(uids, from, to) // Thread safe
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	result := make([]ProcessStats, 0, len(measurements.Memory))
+	for uid := range measurements.Memory {
+		process, hasElement := m.PM.All[uid]
+		if hasElement {
+			times, values := measurements.Measured(uid)
+			result = append(result, ProcessStats{Process: *process, Stats: CalculateStats(times, values)})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].UID < result[j].UID })
+	return result
+}
+
+// CalculateStats calculates a statistical summary of memory measured at
+// the provided times. Values of 0, when the process was not alive, are
+// ignored. The area under the curve is calculated with the trapezoidal
+// rule between consecutive measurements where the process was alive.
+func CalculateStats(times []time.Time, values []uint32) Stats {
+	var stats Stats
+	sorted := make([]uint32, 0, len(values))
+	var sum float64
+	for i, value := range values {
+		if value == 0 {
+			continue
+		}
+		sorted = append(sorted, value)
+		sum += float64(value)
+		if i > 0 && values[i-1] != 0 {
+			hours := times[i].Sub(times[i-1]).Hours()
+			stats.KBHours += (float64(values[i-1]) + float64(value)) / 2 * hours
+		}
+	}
+	if len(sorted) == 0 {
+		return stats
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	stats.Count = len(sorted)
+	stats.Min = sorted[0]
+	stats.Max = sorted[len(sorted)-1]
+	stats.Mean = sum / float64(len(sorted))
+	stats.Median = percentile(sorted, 50)
+	stats.P90 = percentile(sorted, 90)
+	stats.P95 = percentile(sorted, 95)
+	stats.P99 = percentile(sorted, 99)
+	var squares float64
+	for _, value := range sorted {
+		squares += (float64(value) - stats.Mean) * (float64(value) - stats.Mean)
+	}
+	stats.StdDev = math.Sqrt(squares / float64(len(sorted)))
+	return stats
+}
+
+// percentile returns the p:th percentile of sorted values, interpolated
+// linearly between the closest ranks
+func percentile(sorted []uint32, p float64) float64 {
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	fraction := rank - float64(lower)
+	return float64(sorted[lower]) + fraction*(float64(sorted[upper])-float64(sorted[lower]))
+}
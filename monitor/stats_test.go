@@ -0,0 +1,49 @@
+package monitor
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/midstar/proci"
+)
+
+func TestCalculateStats(t *testing.T) {
+	start := time.Now()
+	times := make([]time.Time, 0, 12)
+	values := make([]uint32, 0, 12)
+	for i := 0; i < 12; i++ {
+		times = append(times, start.Add(time.Duration(i)*30*time.Minute))
+	}
+	// Not alive in the first and last measurement
+	values = append(values, 0, 100, 100, 100, 100, 100, 100, 100, 100, 100, 1000, 0)
+	stats := CalculateStats(times, values)
+	assertEqualsInt(t, "Count", 10, stats.Count)
+	assertEqualsInt(t, "Min", 100, int(stats.Min))
+	assertEqualsInt(t, "Max", 1000, int(stats.Max))
+	assertEqualsInt(t, "Mean", 190, int(stats.Mean))
+	assertEqualsInt(t, "Median", 100, int(stats.Median))
+	assertEqualsInt(t, "P90", 190, int(math.Round(stats.P90)))
+	assertEqualsInt(t, "P95", 595, int(math.Round(stats.P95)))
+	assertEqualsInt(t, "P99", 919, int(math.Round(stats.P99)))
+	assertEqualsInt(t, "Standard deviation", 270, int(stats.StdDev))
+	// 8 half hours at 100 KB and one half hour from 100 to 1000 KB
+	assertEqualsInt(t, "KB hours", 400+275, int(math.Round(stats.KBHours)))
+
+	empty := CalculateStats(times[:2], []uint32{0, 0})
+	assertEqualsInt(t, "Empty count", 0, empty.Count)
+	assertEqualsInt(t, "Empty max", 0, int(empty.Max))
+}
+
+func TestGetStats(t *testing.T) {
+	m := CreateMeasurement(10, 10, 1000, 1, proci.GenerateMock(3))
+	m.MeasureAndLog(false)
+	time.Sleep(time.Millisecond)
+	m.MeasureAndLog(false)
+	stats := m.GetStats([]int{3, 1, 1234}, time.Time{}, time.Time{})
+	assertEqualsInt(t, "Processes", 2, len(stats))
+	assertEqualsInt(t, "First UID", 1, stats[0].UID)
+	assertEqualsInt(t, "Count", 2, stats[0].Stats.Count)
+	assertEqualsInt(t, "Median", int(m.PM.All[1].LastMemory), int(stats[0].Stats.Median))
+	assertTrue(t, "KB hours", stats[0].Stats.KBHours > 0)
+}
@@ -0,0 +1,147 @@
+package monitor
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SystemMemory is a breakdown of the memory of the system, beyond the used
+// and total physical memory of proci.MemoryStatus. Values that cannot be
+// read on the platform are 0.
+type SystemMemory struct {
+	Cached      uint32 // Page cache, excluding Buffers (KB)
+	Buffers     uint32 // Buffers of block devices (KB)
+	SwapTotal   uint32 // Total swap or page file (KB)
+	SwapUsed    uint32 // Used swap or page file (KB)
+	CommitTotal uint32 // Commit charge, i.e. memory promised to processes (KB)
+	CommitLimit uint32 // Maximum commit charge (KB)
+	PageFaults  uint64 // Number of page faults since the system was started
+}
+
+// SystemMemoryReader is implemented by process interfaces that can read the
+// breakdown of the system memory.
+type SystemMemoryReader interface {
+	GetSystemMemory() (SystemMemory, error)
+}
+
+// LogSystemMemory represents one measurement of the memory of the system
+type LogSystemMemory struct {
+	Cached      uint32 // KB
+	Buffers     uint32 // KB
+	SwapUsed    uint32 // KB
+	CommitTotal uint32 // KB
+	PageFaults  uint32 // Page faults per second since the previous measurement
+}
+
+// updateSystemMemory reads the breakdown of the system memory, if the
+// process interface can read it, and calculates the page fault rate.
+func (processMap *ProcessMap) updateSystemMemory() {
+	reader, isReader := processMap.Pi.(SystemMemoryReader)
+	if !isReader {
+		return
+	}
+	sys, err := reader.GetSystemMemory()
+	if err != nil {
+		processMap.Phys.HasSystemMemory = false
+		return
+	}
+	phys := processMap.Phys
+	phys.PageFaultRate = 0
+	if phys.HasSystemMemory && sys.PageFaults >= phys.PageFaults && !phys.lastSystemUpdate.IsZero() {
+		if seconds := processMap.LastUpdate.Sub(phys.lastSystemUpdate).Seconds(); seconds > 0 {
+			phys.PageFaultRate = uint32(float64(sys.PageFaults-phys.PageFaults) / seconds)
+		}
+	}
+	phys.SystemMemory = sys
+	phys.HasSystemMemory = true
+	phys.lastSystemUpdate = processMap.LastUpdate
+}
+
+// logSystemMemory returns the memory of the system measured in the last
+// update. nil if not measured.
+func (processMap *ProcessMap) logSystemMemory() *LogSystemMemory {
+	phys := processMap.Phys
+	if !phys.HasSystemMemory {
+		return nil
+	}
+	return &LogSystemMemory{
+		Cached:      phys.Cached,
+		Buffers:     phys.Buffers,
+		SwapUsed:    phys.SwapUsed,
+		CommitTotal: phys.CommitTotal,
+		PageFaults:  phys.PageFaultRate}
+}
+
+// SystemMeasurements are the measurements of the memory of the system.
+// Lengths of all arrays are the same. The breakdown values are 0 if they
+// were not measured.
+type SystemMeasurements struct {
+	Times       []time.Time
+	Used        []uint32 // Used physical memory (KB)
+	Cached      []uint32 // KB
+	Buffers     []uint32 // KB
+	SwapUsed    []uint32 // KB
+	CommitTotal []uint32 // KB
+	PageFaults  []uint32 // Page faults per second
+}
+
+// GetSystemMeasurementsBetween returns the memory of the system between
+// from and to. Zero values of from and/or to means no restriction.
+func (m *Measurement) GetSystemMeasurementsBetween(from time.Time, to time.Time) *SystemMeasurements {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	sm := &SystemMeasurements{Times: make([]time.Time, 0), Used: make([]uint32, 0), Cached: make([]uint32, 0),
+		Buffers: make([]uint32, 0), SwapUsed: make([]uint32, 0), CommitTotal: make([]uint32, 0), PageFaults: make([]uint32, 0)}
+	m.forEachRowBetween(from, to, func(row *LogRow) {
+		sys := row.System
+		if sys == nil {
+			sys = &LogSystemMemory{}
+		}
+		sm.Times = append(sm.Times, row.Time)
+		sm.Used = append(sm.Used, row.MemUsed)
+		sm.Cached = append(sm.Cached, sys.Cached)
+		sm.Buffers = append(sm.Buffers, sys.Buffers)
+		sm.SwapUsed = append(sm.SwapUsed, sys.SwapUsed)
+		sm.CommitTotal = append(sm.CommitTotal, sys.CommitTotal)
+		sm.PageFaults = append(sm.PageFaults, sys.PageFaults)
+	})
+	return sm
+}
+
+// parseMeminfo parses the content of /proc/meminfo (Linux)
+func parseMeminfo(content string) SystemMemory {
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if value, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[strings.TrimSuffix(fields[0], ":")] = value // kB
+		}
+	}
+	var sys SystemMemory
+	sys.Cached = uint32(values["Cached"])
+	sys.Buffers = uint32(values["Buffers"])
+	sys.SwapTotal = uint32(values["SwapTotal"])
+	if values["SwapFree"] <= values["SwapTotal"] {
+		sys.SwapUsed = uint32(values["SwapTotal"] - values["SwapFree"])
+	}
+	sys.CommitTotal = uint32(values["Committed_AS"])
+	sys.CommitLimit = uint32(values["CommitLimit"])
+	return sys
+}
+
+// parseVmstatPageFaults returns the number of page faults in the content
+// of /proc/vmstat (Linux)
+func parseVmstatPageFaults(content string) uint64 {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "pgfault" {
+			value, _ := strconv.ParseUint(fields[1], 10, 64)
+			return value
+		}
+	}
+	return 0
+}
@@ -0,0 +1,18 @@
+package monitor
+
+import (
+	"io/ioutil"
+)
+
+// getSystemMemory reads /proc/meminfo and /proc/vmstat
+func getSystemMemory() (SystemMemory, error) {
+	meminfo, err := ioutil.ReadFile("/proc/meminfo")
+	if err != nil {
+		return SystemMemory{}, err
+	}
+	sys := parseMeminfo(string(meminfo))
+	if vmstat, err := ioutil.ReadFile("/proc/vmstat"); err == nil {
+		sys.PageFaults = parseVmstatPageFaults(string(vmstat))
+	}
+	return sys, nil
+}
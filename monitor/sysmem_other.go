@@ -0,0 +1,11 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package monitor
+
+import "fmt"
+
+// getSystemMemory is not supported on this platform
+func getSystemMemory() (SystemMemory, error) {
+	return SystemMemory{}, fmt.Errorf("System memory breakdown not supported on this platform")
+}
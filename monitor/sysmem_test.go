@@ -0,0 +1,69 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/midstar/proci"
+)
+
+// sysMock is a mock that also can read the breakdown of the system memory
+type sysMock struct {
+	*proci.Mock
+	sys *SystemMemory
+}
+
+func (m sysMock) GetSystemMemory() (SystemMemory, error) {
+	return *m.sys, nil
+}
+
+func TestParseMeminfo(t *testing.T) {
+	sys := parseMeminfo(`MemTotal:       16303648 kB
+MemFree:         1204520 kB
+MemAvailable:    9870512 kB
+Buffers:          402284 kB
+Cached:          7839404 kB
+SwapTotal:       2097148 kB
+SwapFree:        1048576 kB
+CommitLimit:    10249972 kB
+Committed_AS:   12345678 kB
+HugePages_Total:       0
+`)
+	assertEqualsInt(t, "Cached", 7839404, int(sys.Cached))
+	assertEqualsInt(t, "Buffers", 402284, int(sys.Buffers))
+	assertEqualsInt(t, "Swap total", 2097148, int(sys.SwapTotal))
+	assertEqualsInt(t, "Swap used", 2097148-1048576, int(sys.SwapUsed))
+	assertEqualsInt(t, "Commit total", 12345678, int(sys.CommitTotal))
+	assertEqualsInt(t, "Commit limit", 10249972, int(sys.CommitLimit))
+
+	assertEqualsInt(t, "Page faults", 123456, int(parseVmstatPageFaults("pgfree 99\npgfault 123456\npgmajfault 12\n")))
+	assertEqualsInt(t, "No page faults", 0, int(parseVmstatPageFaults("pgfree 99\n")))
+}
+
+func TestMeasureSystemMemory(t *testing.T) {
+	sMock := sysMock{Mock: proci.GenerateMock(2), sys: &SystemMemory{Cached: 1000, SwapUsed: 10, PageFaults: 5000}}
+	m := CreateMeasurement(10, 10, 1000, 1, sMock)
+	m.MeasureAndLog(false)
+	assertTrue(t, "Measured", m.PM.Phys.HasSystemMemory)
+	assertEqualsInt(t, "No rate at first measurement", 0, int(m.PM.Phys.PageFaultRate))
+	time.Sleep(100 * time.Millisecond)
+	sMock.sys.Cached = 3000
+	sMock.sys.PageFaults = 6000
+	m.MeasureAndLog(false)
+	assertTrue(t, "Page fault rate", m.PM.Phys.PageFaultRate > 0 && m.PM.Phys.PageFaultRate <= 10000)
+	assertEqualsInt(t, "Cached", 3000, int(m.PM.Phys.Cached))
+
+	sm := m.GetSystemMeasurementsBetween(time.Time{}, time.Time{})
+	assertEqualsInt(t, "Times", 2, len(sm.Times))
+	assertEqualsInt(t, "Used", 2<<20, int(sm.Used[0]))
+	assertEqualsInt(t, "First cached", 1000, int(sm.Cached[0]))
+	assertEqualsInt(t, "Second cached", 3000, int(sm.Cached[1]))
+	assertEqualsInt(t, "Swap", 10, int(sm.SwapUsed[1]))
+
+	// Without breakdown only the used memory is measured
+	m = CreateMeasurement(10, 10, 1000, 1, proci.GenerateMock(2))
+	m.MeasureAndLog(false)
+	assertTrue(t, "Not measured", !m.PM.Phys.HasSystemMemory && m.FastLogger.LogRows[0].System == nil)
+	sm = m.GetSystemMeasurementsBetween(time.Time{}, time.Time{})
+	assertEqualsInt(t, "Cached not measured", 0, int(sm.Cached[0]))
+}
@@ -0,0 +1,46 @@
+package monitor
+
+import (
+	"unsafe"
+)
+
+var procGetPerformanceInfo = kernel32.NewProc("K32GetPerformanceInfo")
+
+// performanceInformation is PERFORMANCE_INFORMATION of the Windows API. The
+// sizes are in pages.
+type performanceInformation struct {
+	cb                uint32
+	CommitTotal       uintptr
+	CommitLimit       uintptr
+	CommitPeak        uintptr
+	PhysicalTotal     uintptr
+	PhysicalAvailable uintptr
+	SystemCache       uintptr
+	KernelTotal       uintptr
+	KernelPaged       uintptr
+	KernelNonpaged    uintptr
+	PageSize          uintptr
+	HandleCount       uint32
+	ProcessCount      uint32
+	ThreadCount       uint32
+}
+
+// getSystemMemory reads the commit charge and system cache with
+// GetPerformanceInfo. The page file is the part of the commit limit that is
+// not physical memory. Its usage and the page faults are not read.
+func getSystemMemory() (SystemMemory, error) {
+	var info performanceInformation
+	info.cb = uint32(unsafe.Sizeof(info))
+	if r, _, err := procGetPerformanceInfo.Call(uintptr(unsafe.Pointer(&info)), uintptr(info.cb)); r == 0 {
+		return SystemMemory{}, err
+	}
+	pageKB := uint64(info.PageSize) / 1024
+	sys := SystemMemory{
+		Cached:      uint32(uint64(info.SystemCache) * pageKB),
+		CommitTotal: uint32(uint64(info.CommitTotal) * pageKB),
+		CommitLimit: uint32(uint64(info.CommitLimit) * pageKB)}
+	if info.CommitLimit > info.PhysicalTotal {
+		sys.SwapTotal = uint32(uint64(info.CommitLimit-info.PhysicalTotal) * pageKB)
+	}
+	return sys, nil
+}
@@ -0,0 +1,261 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Limits of watches
+const (
+	MinWatchInterval = 10 * time.Millisecond // Shortest time between samples
+	MaxWatchDuration = 24 * time.Hour        // Longest time a watch is active
+	MaxWatchRows     = 100000                // Largest buffer of a watch (samples)
+	MaxWatches       = 10                    // Highest number of active watches
+)
+
+// Watch samples selected processes more often than the measurement loop.
+// The samples are stored in a separate buffer, and are included in the
+// result of GetProcessMeasurementsBetween (and the functions using it).
+//
+// A watch is active until it expires or is stopped. The buffer is kept
+// until it only contains samples older than the fast log.
+type Watch struct {
+	ID         int
+	Match      []string  // Watch processes matching any of these (see Process.Matches), including processes started later
+	UIDs       []int     // Watch these processes
+	IntervalMs int       // Time between samples
+	Created    time.Time // When the watch was created
+	Expires    time.Time // When the watch stops sampling
+	Active     bool      // Sampling. False if expired or stopped
+	NbrSamples int       // Number of samples taken
+	logger     *Logger   // The samples. LogRow.MemUsed is not used
+	halt       chan bool // Closed to stop the watch
+}
+
+// AddWatch starts sampling the processes with the provided UIDs, and the
+// processes matching any of match, every interval during duration.
+// Returns a copy of the watch.
+func (m *Measurement) AddWatch(uids []int, match []string, interval time.Duration, duration time.Duration) (Watch, error) {
+	if len(uids) == 0 && len(match) == 0 {
+		return Watch{}, fmt.Errorf("No processes to watch")
+	}
+	if interval < MinWatchInterval {
+		return Watch{}, fmt.Errorf("Interval %s is shorter than the minimum %s", interval, MinWatchInterval)
+	}
+	if duration <= 0 || duration > MaxWatchDuration {
+		return Watch{}, fmt.Errorf("Duration %s shall be positive and at most %s", duration, MaxWatchDuration)
+	}
+	rows := int(duration/interval) + 1
+	if rows > MaxWatchRows {
+		rows = MaxWatchRows
+	}
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	active := 0
+	for _, w := range m.watches {
+		if w.Active {
+			active++
+		}
+	}
+	if active >= MaxWatches {
+		return Watch{}, fmt.Errorf("Maximum %d watches can be active", MaxWatches)
+	}
+	m.nextWatchID++
+	now := time.Now()
+	w := &Watch{
+		ID:         m.nextWatchID,
+		Match:      append([]string{}, match...),
+		UIDs:       append([]int{}, uids...),
+		IntervalMs: int(interval / time.Millisecond),
+		Created:    now,
+		Expires:    now.Add(duration),
+		Active:     true,
+		logger:     CreateLogger(rows),
+		halt:       make(chan bool)}
+	if m.watches == nil {
+		m.watches = make(map[int]*Watch)
+	}
+	m.watches[w.ID] = w
+	go m.watchLoop(w, interval)
+	return w.copy(), nil
+}
+
+// copy returns a copy of the watch without the samples
+func (w *Watch) copy() Watch {
+	c := *w
+	c.logger = nil
+	c.halt = nil
+	return c
+}
+
+// GetWatches returns copies of all watches, sorted on ID
+func (m *Measurement) GetWatches() []Watch {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	watches := make([]Watch, 0, len(m.watches))
+	for _, w := range m.watches {
+		watches = append(watches, w.copy())
+	}
+	sort.Slice(watches, func(i, j int) bool { return watches[i].ID < watches[j].ID })
+	return watches
+}
+
+// GetWatch returns a copy of a watch
+func (m *Measurement) GetWatch(id int) (Watch, bool) {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	w, hasWatch := m.watches[id]
+	if !hasWatch {
+		return Watch{}, false
+	}
+	return w.copy(), true
+}
+
+// StopWatch stops a watch. Its samples are kept. Returns false if there is
+// no such watch.
+func (m *Measurement) StopWatch(id int) bool {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	w, hasWatch := m.watches[id]
+	if hasWatch && w.Active {
+		w.Active = false
+		close(w.halt)
+	}
+	return hasWatch
+}
+
+// RemoveOldWatches removes watches that are not active and only have
+// samples older than the fast log
+func (m *Measurement) RemoveOldWatches() {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	oldestTime := m.FastLogger.OldestDate()
+	for id, w := range m.watches {
+		if w.Active {
+			continue
+		}
+		if w.logger.NbrRows == 0 || w.logger.LogRows[w.newestIndex()].Time.Before(oldestTime) {
+			delete(m.watches, id)
+		}
+	}
+}
+
+// newestIndex returns the index of the newest sample. Only valid if there
+// are samples.
+func (w *Watch) newestIndex() int {
+	if w.logger.Index == 0 {
+		return w.logger.MaxRows - 1
+	}
+	return w.logger.Index - 1
+}
+
+// watchedPids returns the PIDs of the processes watched, keyed on UID.
+// Mutex shall be locked by the caller.
+func (m *Measurement) watchedPids(w *Watch) map[int]uint32 {
+	pids := make(map[int]uint32)
+	for _, uid := range w.UIDs {
+		if process, hasElement := m.PM.All[uid]; hasElement && process.IsAlive {
+			pids[uid] = process.Pid
+		}
+	}
+	if len(w.Match) > 0 {
+		for _, process := range m.PM.Alive {
+			for _, match := range w.Match {
+				if process.Matches(match) {
+					pids[process.UID] = process.Pid
+					break
+				}
+			}
+		}
+	}
+	return pids
+}
+
+// watchLoop samples the processes of the watch until it expires or is
+// stopped. Supposed to be runned as a goroutine.
+func (m *Measurement) watchLoop(w *Watch, interval time.Duration) {
+	expired := time.After(time.Until(w.Expires))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.halt:
+			return
+		case <-expired:
+			m.Mutex.Lock()
+			w.Active = false
+			m.Mutex.Unlock()
+			return
+		case <-ticker.C:
+			m.sample(w)
+		}
+	}
+}
+
+// sample measures the memory of the processes of the watch. The maximum and
+// minimum memory ever of the processes are updated, since the samples might
+// catch spikes the measurement loop misses.
+func (m *Measurement) sample(w *Watch) {
+	m.Mutex.Lock()
+	pids := m.watchedPids(w)
+	pi := m.PM.Pi
+	m.Mutex.Unlock()
+
+	// Read the memory without the lock, since it might be slow
+	memory := make(map[int]uint32, len(pids))
+	for uid, pid := range pids {
+		memoryUsage, err := pi.GetProcessMemoryUsage(pid)
+		if err == nil {
+			memory[uid] = uint32(memoryUsage / 1024) // Byte to KiloByte
+		} else {
+			memory[uid] = 0 // Probably died
+		}
+	}
+	row := &LogRow{Time: time.Now(), LogProcesses: make([]*LogProcess, 0, len(memory))}
+	for uid, memUsed := range memory {
+		row.LogProcesses = append(row.LogProcesses, &LogProcess{UID: uid, MemUsed: memUsed})
+	}
+
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	if !w.Active {
+		return
+	}
+	w.logger.AddRow(row)
+	w.NbrSamples++
+	for _, logProcess := range row.LogProcesses {
+		process, hasElement := m.PM.All[logProcess.UID]
+		if !hasElement || logProcess.MemUsed == 0 {
+			continue
+		}
+		if logProcess.MemUsed > process.MaxMemoryEver {
+			process.MaxMemoryEver = logProcess.MemUsed
+		}
+		if process.MinMemoryEver == 0 || logProcess.MemUsed < process.MinMemoryEver {
+			process.MinMemoryEver = logProcess.MemUsed
+		}
+	}
+}
+
+// watchRowsBetween returns the samples of all watches between from and to
+// (zero values means no restriction), oldest first. Mutex shall be locked
+// by the caller.
+func (m *Measurement) watchRowsBetween(from time.Time, to time.Time) []*LogRow {
+	var rows []*LogRow
+	for _, w := range m.watches {
+		index := w.logger.OldestIndex()
+		for handledRows := 0; handledRows < w.logger.NbrRows; handledRows++ {
+			row := w.logger.LogRows[index]
+			if (from.IsZero() || !row.Time.Before(from)) && (to.IsZero() || !row.Time.After(to)) {
+				rows = append(rows, row)
+			}
+			index++
+			if index == w.logger.MaxRows {
+				index = 0 // Wrap of log
+			}
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Time.Before(rows[j].Time) })
+	return rows
+}
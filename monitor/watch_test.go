@@ -0,0 +1,148 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/midstar/proci"
+)
+
+func TestWatch(t *testing.T) {
+	pMock := proci.GenerateMock(3)
+	m := CreateMeasurement(3, 6, 3, 6, pMock)
+	m.MeasureAndLog(false)
+	uid1, uid2 := m.PM.Alive[1].UID, m.PM.Alive[2].UID
+	uids := []int{uid1, uid2}
+
+	// Invalid watches
+	_, err := m.AddWatch(nil, nil, time.Second, time.Hour)
+	assertTrue(t, "No processes", err != nil)
+	_, err = m.AddWatch(uids, nil, time.Millisecond, time.Hour)
+	assertTrue(t, "Too short interval", err != nil)
+	_, err = m.AddWatch(uids, nil, time.Second, 48*time.Hour)
+	assertTrue(t, "Too long duration", err != nil)
+
+	// The interval is long, so that only the samples below are taken
+	watch, err := m.AddWatch([]int{uid1}, nil, time.Hour, time.Hour)
+	assertTrue(t, "Watch added", err == nil)
+	assertEqualsInt(t, "Interval", 3600000, watch.IntervalMs)
+	w := m.watches[watch.ID]
+
+	// A spike between the measurements is only seen by the watch
+	time.Sleep(2 * time.Millisecond) // To make time differ
+	pMock.Processes[1].MemoryUsage = 50 * 1024
+	pMock.Processes[2].MemoryUsage = 60 * 1024
+	m.sample(w)
+	time.Sleep(2 * time.Millisecond)
+	pMock.Processes[1].MemoryUsage = 5 * 1024
+	pMock.Processes[2].MemoryUsage = 6 * 1024
+	m.MeasureAndLog(false)
+
+	pm := m.GetProcessMeasurements(uids)
+	assertEqualsInt(t, "Times", 3, len(pm.Times))
+	assertEqualsSlice(t, "Watched", []uint32{2, 50, 5}, pm.Memory[uid1])
+	assertEqualsSlice(t, "Not watched keeps previous value", []uint32{3, 3, 6}, pm.Memory[uid2])
+	minMax := m.GetMinMaxMem([]int{uid1}, time.Time{}, time.Time{})
+	assertEqualsInt(t, "Spike", 50, int(minMax[0].MaxMemoryInPeriod))
+	assertEqualsInt(t, "Max memory ever", 50, int(m.PM.All[uid1].MaxMemoryEver))
+
+	// Period restriction
+	pm = m.GetProcessMeasurementsBetween(uids, w.logger.LogRows[0].Time, time.Time{})
+	assertEqualsSlice(t, "From the spike", []uint32{50, 5}, pm.Memory[uid1])
+
+	// Match, including processes started later
+	matchWatch, err := m.AddWatch(nil, []string{"command_line_3", "command_line_4"}, time.Hour, time.Hour)
+	assertTrue(t, "Watch added", err == nil)
+	pMock.Processes[4] = &proci.ProcessMock{Pid: 4, Path: "path_4", CommandLine: "command_line_4", MemoryUsage: 1024}
+	m.MeasureAndLog(false)
+	m.Mutex.Lock()
+	pids := m.watchedPids(m.watches[matchWatch.ID])
+	m.Mutex.Unlock()
+	assertEqualsInt(t, "Matching processes", 2, len(pids))
+
+	// Stopped watches keep their samples until they are older than the
+	// fast log
+	assertTrue(t, "Stopped", m.StopWatch(watch.ID))
+	assertTrue(t, "No such watch", !m.StopWatch(99))
+	stopped, _ := m.GetWatch(watch.ID)
+	assertTrue(t, "Not active", !stopped.Active)
+	assertEqualsInt(t, "Samples", 1, stopped.NbrSamples)
+	m.RemoveOldWatches()
+	assertEqualsInt(t, "Watches", 2, len(m.GetWatches()))
+	for i := 0; i < 3; i++ {
+		time.Sleep(2 * time.Millisecond)
+		m.MeasureAndLog(false)
+	}
+	m.RemoveOldWatches()
+	assertEqualsInt(t, "Watches", 1, len(m.GetWatches()))
+	m.StopWatch(matchWatch.ID)
+}
+
+func TestWatchExpires(t *testing.T) {
+	pMock := proci.GenerateMock(3)
+	m := CreateMeasurement(3, 6, 3, 6, pMock)
+	m.MeasureAndLog(false)
+	watch, err := m.AddWatch([]int{m.PM.Alive[1].UID}, nil, 10*time.Millisecond, 100*time.Millisecond)
+	assertTrue(t, "Watch added", err == nil)
+	time.Sleep(300 * time.Millisecond)
+	watch, _ = m.GetWatch(watch.ID)
+	assertTrue(t, "Expired", !watch.Active)
+	assertTrue(t, "Sampled", watch.NbrSamples >= 3 && watch.NbrSamples <= 11)
+
+	for i := 0; i < MaxWatches; i++ {
+		_, err = m.AddWatch([]int{1}, nil, time.Hour, time.Hour)
+		assertTrue(t, "Watch added", err == nil)
+	}
+	_, err = m.AddWatch([]int{1}, nil, time.Hour, time.Hour)
+	assertTrue(t, "Too many watches", err != nil)
+	for _, w := range m.GetWatches() {
+		m.StopWatch(w.ID)
+	}
+}
+
+func TestWatchStats(t *testing.T) {
+	pMock := proci.GenerateMock(2)
+	m := CreateMeasurement(20, 40, 3, 6, pMock)
+	m.MeasureAndLog(false)
+	uid1, uid2 := m.PM.Alive[1].UID, m.PM.Alive[2].UID
+	uids := []int{uid1, uid2}
+
+	// Only the first process is watched, while both are measured. The
+	// interval is long, so that only the samples below are taken.
+	watch, err := m.AddWatch([]int{uid1}, nil, time.Second, time.Hour)
+	assertTrue(t, "Watch added", err == nil)
+	w := m.watches[watch.ID]
+	for i := 0; i < 10; i++ {
+		time.Sleep(2 * time.Millisecond) // To make time differ
+		m.sample(w)
+	}
+	time.Sleep(2 * time.Millisecond)
+	pMock.Processes[2].MemoryUsage = 5 * 1024
+	m.MeasureAndLog(false)
+	m.StopWatch(watch.ID)
+
+	pm := m.GetProcessMeasurements(uids)
+	assertEqualsInt(t, "Times", 12, len(pm.Times))
+	assertEqualsInt(t, "Filled", 10, len(pm.Filled[uid2]))
+	times, values := pm.Measured(uid2)
+	assertEqualsInt(t, "Measured times", 2, len(times))
+	assertEqualsSlice(t, "Measured", []uint32{3, 5}, values)
+	assertEqualsInt(t, "Rows without filled values", 2, len(pm.WithoutFilled().Times))
+
+	// The samples are not merged if none of the processes was watched
+	pm = m.GetProcessMeasurements([]int{uid2})
+	assertEqualsInt(t, "Times not watched", 2, len(pm.Times))
+	assertEqualsInt(t, "Not filled", 0, len(pm.Filled[uid2]))
+
+	// The values copied from the previous value are not counted
+	stats := m.GetStats(uids, time.Time{}, time.Time{})
+	assertEqualsInt(t, "Stats", 2, len(stats))
+	for _, s := range stats {
+		if s.UID == uid2 {
+			assertEqualsInt(t, "Count not watched", 2, s.Stats.Count)
+			assertEqualsInt(t, "Mean not watched", 4, int(s.Stats.Mean))
+		} else {
+			assertEqualsInt(t, "Count watched", 12, s.Stats.Count)
+		}
+	}
+}
@@ -6,22 +6,24 @@ import (
 	"os"
 	"path/filepath"
 
-	"github.com/midstar/proci"
+	"github.com/midstar/plm/monitor"
 )
 
 // PLM the PLM context
 type PLM struct {
 	Config      *Configuration
 	httpServer  *HTTPServer
-	measurement *Measurement
+	measurement *monitor.Measurement
+	pusher      *Pusher // nil if not pushing to a collector
 }
 
 // CreatePLM loads the configuration and creates the HTTP server and
 // measurement.
 //
 // basePath is the location where to store log files, read config files and
-// templates
-func CreatePLM(basePath string) *PLM {
+// templates. flags are configuration values given on the command line (see
+// RegisterFlags) and might be nil.
+func CreatePLM(basePath string, flags map[string]string) (*PLM, error) {
 
 	logFile, err := os.OpenFile(filepath.Join(basePath, "plm.log"), os.O_CREATE|os.O_APPEND|os.O_RDWR, 0666)
 	if err != nil {
@@ -32,19 +34,54 @@ func CreatePLM(basePath string) *PLM {
 
 	// Rest of configuration
 	log.Print("Startup of PLM")
-	configuration := LoadConfiguration(filepath.Join(basePath, DefaultConfigFile))
-	log.Print("Listening to port: ", configuration.Port)
-	m := CreateMeasurement(configuration.FastLogSize, configuration.SlowLogSize,
-		configuration.FastLogTimeMs, configuration.SlowLogSize, proci.Proci{})
-	s := CreateHTTPServer(basePath, configuration.Port, m)
+	configuration, err := LoadConfiguration(filepath.Join(basePath, DefaultConfigFile), flags)
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+	log.Print("Configuration:\n", configuration.Describe())
+	log.Printf("Listening to address: %s port: %d", configuration.BindAddress, configuration.Port)
+	m := monitor.CreateMeasurement(configuration.FastLogSize, configuration.SlowLogSize,
+		configuration.FastLogTimeMs, configuration.SlowLogFactor, monitor.SystemProci{})
+	m.PM.Redactor, err = monitor.NewRedactor(configuration.RedactPatterns,
+		configuration.RedactDefaults, configuration.HideCommandLine)
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+	m.PM.Filter, err = monitor.NewProcessFilter(configuration.IncludeProcesses,
+		configuration.ExcludeProcesses, configuration.MinProcessMemory)
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+	m.PM.CgroupRoot = configuration.CgroupRoot
+	if configuration.OOMLog != "" {
+		// Not fatal, since the log might require other permissions
+		if m.PM.OOMLog, err = monitor.OpenOOMLog(configuration.OOMLog); err != nil {
+			log.Printf("Unable to read OOM kills from %s: %s", configuration.OOMLog, err)
+		}
+	}
+	var p *Pusher
+	if configuration.Collector != "" {
+		log.Printf("Pushing measurements to collector: %s", configuration.Collector)
+		p = CreatePusher(configuration.Collector, configuration.CollectorToken, configuration.HostName,
+			filepath.Join(basePath, PushBufferFile), configuration.PushBufferSize)
+		m.OnRow = p.Collect
+	}
+	s := CreateHTTPServer(basePath, configuration, m)
 	return &PLM{
 		Config:      configuration,
 		httpServer:  s,
-		measurement: m}
+		measurement: m,
+		pusher:      p}, nil
 }
 
 // Start starts the measurements and HTTP server.
 func (plm *PLM) Start() {
+	if plm.pusher != nil {
+		plm.pusher.Start()
+	}
 	plm.measurement.Start()
 	plm.httpServer.Start()
 }
@@ -53,4 +90,10 @@ func (plm *PLM) Start() {
 func (plm *PLM) Stop() {
 	plm.httpServer.Stop()
 	plm.measurement.Stop()
+	if plm.measurement.PM.OOMLog != nil {
+		plm.measurement.PM.OOMLog.Close()
+	}
+	if plm.pusher != nil {
+		plm.pusher.Stop()
+	}
 }
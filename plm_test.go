@@ -1,13 +1,30 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"runtime/debug"
 	"testing"
 	"time"
 )
 
+func assertTrue(t *testing.T, message string, check bool) {
+	if !check {
+		debug.PrintStack()
+		t.Fatal(message)
+	}
+}
+
+func assertEqualsInt(t *testing.T, message string, expected int, actual int) {
+	assertTrue(t, fmt.Sprintf("%s\nExpected: %d, Actual: %d", message, expected, actual), expected == actual)
+}
+
+func assertEqualsStr(t *testing.T, message string, expected string, actual string) {
+	assertTrue(t, fmt.Sprintf("%s\nExpected: %s, Actual: %s", message, expected, actual), expected == actual)
+}
+
 func plmPath(t *testing.T) string {
 	gopath := os.Getenv("GOPATH")
 	if gopath == "" {
@@ -21,7 +38,10 @@ func TestPLM(t *testing.T) {
 	// more than once. We do run it serveral times in the unit tests.
 	http.DefaultServeMux = new(http.ServeMux)
 
-	plm := CreatePLM(plmPath(t))
+	plm, err := CreatePLM(plmPath(t), nil)
+	if err != nil {
+		t.Fatal("Unable to create PLM. Reason: ", err)
+	}
 	plm.Start()
 	time.Sleep(3 * time.Second) // Allow some measurements to be done
 
@@ -35,3 +55,10 @@ func TestPLM(t *testing.T) {
 
 	plm.Stop()
 }
+
+func TestPLMInvalidConfig(t *testing.T) {
+	_, err := CreatePLM(plmPath(t), map[string]string{"slowLogFactor": "0"})
+	if err == nil {
+		t.Fatal("Expected an error on invalid configuration")
+	}
+}
@@ -1,49 +1,59 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"net/http"
-	"net/url"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/midstar/plm/client"
+	"github.com/midstar/plm/monitor"
 )
 
-func getQueryParams() string {
-	queryParams := url.Values{}
+// plm is used for all requests to the PLM server. Created from the flags
+// in main.
+var plm *client.Client
+
+// getFilter returns the processes and period selected by the -m, -u,
+// -from, -to, -run and -host flags
+func getFilter() (client.Filter, error) {
+	f := client.Filter{FromTag: FromTag, ToTag: ToTag, Run: Run}
 	if Matcher != "" {
-		queryParams.Add("match", Matcher)
+		f.Match = []string{Matcher}
 	}
 	if UIDs != "" {
-		queryParams.Add("uids", UIDs)
-	}
-	if FromTag != "" {
-		queryParams.Add("fromTag", FromTag)
-	}
-	if ToTag != "" {
-		queryParams.Add("toTag", ToTag)
+		for _, uid := range strings.Split(UIDs, ",") {
+			value, err := strconv.Atoi(strings.TrimSpace(uid))
+			if err != nil {
+				return f, fmt.Errorf("Invalid UID %s. Shall be an integer", uid)
+			}
+			f.UIDs = append(f.UIDs, value)
+		}
 	}
-	if len(queryParams) == 0 {
-		return ""
+	if Host != "" {
+		f.Aggregate = true
+		if Host != "all" {
+			f.Hosts = strings.Split(Host, ",")
+		}
 	}
-	return fmt.Sprintf("?%s", queryParams.Encode())
+	return f, nil
 }
 
-// CmdPlot get plot for one or more processes
-func CmdPlot(filename string) error {
-	resp, err := http.Get(fmt.Sprintf("%s/plot%s", PLMUrl, getQueryParams()))
+// CmdPlot get plot of a metric for one or more processes
+func CmdPlot(filename string, metric string) error {
+	f, err := getFilter()
 	if err != nil {
 		return err
 	}
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Unexpected status code from plm server: %d", resp.StatusCode)
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	f.Metric = metric
+	plot, err := plm.Plot(context.Background(), f)
 	if err != nil {
 		return err
 	}
-	err = ioutil.WriteFile(filename, body, 0644)
+	err = ioutil.WriteFile(filename, plot, 0644)
 	if err != nil {
 		return err
 	}
@@ -51,67 +61,60 @@ func CmdPlot(filename string) error {
 	return nil
 }
 
-// Process represent one unique process
-type Process struct {
-	UID           int       // Unique ID
-	Pid           uint32    // Process PID
-	IsAlive       bool      // Is process alive?
-	Path          string    // The process path (and name)
-	Name          string    // Name of the process (last part of Path)
-	CommandLine   string    // The process command line
-	MaxMemoryEver uint32    // Maximum memory ever measured (KB)
-	MinMemoryEver uint32    // Minimum memory ever measured (KB)
-	LastMemory    uint32    // Last memory measured (KB)
-	Created       time.Time // When this process was created (or first seen)
-	Died          time.Time // When this process died
-}
-
-// ProcessMinMaxMem represents results from the GET minmaxmem service
-type ProcessMinMaxMem struct {
-	Process
-	MaxMemoryInPeriod uint32 // Maximum memory during period (KB)
-	MinMemoryInPeriod uint32 // Minimum memory during period(KB)
-}
-
 // CmdInfo list info about for one or more processes
 func CmdInfo() error {
-	resp, err := http.Get(fmt.Sprintf("%s/processes%s", PLMUrl, getQueryParams()))
-	if err != nil {
-		return err
-	}
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Unexpected status code from plm server: %d", resp.StatusCode)
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	f, err := getFilter()
 	if err != nil {
 		return err
 	}
-	var processes map[int]*Process
-	err = json.Unmarshal(body, &processes)
+	processes, err := plm.ListProcesses(context.Background(), f)
 	if err != nil {
 		return err
 	}
+	printProcesses(processes)
+	return nil
+}
+
+func printProcesses(processes []client.Process) {
 	fmt.Println("Number of processes: ", len(processes))
 	fmt.Println("")
 	for _, process := range processes {
 		fmt.Println("-----------------------------------------------")
+		if process.Host != "" {
+			fmt.Println("Host:            ", process.Host)
+		}
 		fmt.Println("PID:             ", process.Pid)
 		fmt.Println("UID:             ", process.UID)
 		fmt.Println("Name:            ", process.Name)
 		fmt.Println("Path:            ", process.Path)
 		fmt.Println("Command line:    ", process.CommandLine)
+		if process.User != "" {
+			fmt.Printf("User:             %s (%s)\n", process.User, process.UserID)
+			fmt.Println("Session:         ", process.Session)
+		}
+		if process.Cgroup != "" {
+			fmt.Println("Cgroup:          ", process.Cgroup)
+		}
+		if process.ContainerID != "" {
+			fmt.Println("Container:       ", process.ContainerID)
+		}
 		fmt.Println("Max memory ever: ", process.MaxMemoryEver, "KB")
 		fmt.Println("Min memory ever: ", process.MinMemoryEver, "KB")
 		fmt.Println("Last memory:     ", process.LastMemory, "KB")
+		if process.MaxThreadsEver > 0 {
+			fmt.Printf("Last FDs:         %d (max %d)\n", process.LastFDs, process.MaxFDsEver)
+			fmt.Printf("Last threads:     %d (max %d)\n", process.LastThreads, process.MaxThreadsEver)
+		}
 		fmt.Println("First seen:      ", process.Created)
 		fmt.Println("Is alive:        ", process.IsAlive)
 		if !process.IsAlive {
 			fmt.Println("Died:            ", process.Died)
 		}
+		if process.Exit.Reason != "" {
+			fmt.Printf("Exit:             %s (%s)\n", process.Exit.Reason, process.Exit.Detail)
+		}
 		fmt.Println("")
 	}
-	return nil
 }
 
 // CmdMax list max memory used for one or more processes
@@ -154,21 +157,231 @@ func CmdMin() error {
 	return nil
 }
 
-func getMinMax() ([]ProcessMinMaxMem, error) {
-	resp, err := http.Get(fmt.Sprintf("%s/minmaxmem%s", PLMUrl, getQueryParams()))
+// CmdMaxFDs displays the max number of open file descriptors (handles on
+// Windows) of one or more processes
+func CmdMaxFDs() error {
+	f, err := getFilter()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	f.Metric = monitor.MetricFDs
+	measurements, err := plm.Measurements(context.Background(), f)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if len(measurements.Series) < 1 {
+		return fmt.Errorf("no process found")
+	}
+	if len(measurements.Series) > 1 {
+		fmt.Printf("WARNING! More than one process found that match query (%d)\n", len(measurements.Series))
+	}
+	var maxFDs uint32
+	for _, series := range measurements.Series {
+		for _, value := range series.Values {
+			if value > maxFDs {
+				maxFDs = value
+			}
+		}
+	}
+	fmt.Println(maxFDs, "FDs")
+	if FailLimit != -1 && maxFDs > uint32(FailLimit) {
+		return fmt.Errorf("fail: %d FDs exceeds %d FDs", maxFDs, FailLimit)
+	}
+	return nil
+}
+
+// leakGrowth returns how much a metric grew during the period, i.e. the
+// mean of the last third of the values minus the mean of the first third.
+// Values of 0, when the process wasn't alive or not measured, are ignored.
+// Returns false if there are too few values.
+func leakGrowth(values []uint32) (float64, bool) {
+	measured := make([]uint32, 0, len(values))
+	for _, value := range values {
+		if value != 0 {
+			measured = append(measured, value)
+		}
+	}
+	third := len(measured) / 3
+	if third == 0 {
+		return 0, false
+	}
+	mean := func(values []uint32) float64 {
+		var sum float64
+		for _, value := range values {
+			sum += float64(value)
+		}
+		return sum / float64(len(values))
+	}
+	return mean(measured[len(measured)-third:]) - mean(measured[:third]), true
+}
+
+// CmdLeakCheck displays how much a metric of each process grew during the
+// period. Fails if the growth of any process is above the -f limit.
+func CmdLeakCheck(metric string) error {
+	f, err := getFilter()
+	if err != nil {
+		return err
+	}
+	processes, err := plm.ListProcesses(context.Background(), f)
+	if err != nil {
+		return err
+	}
+	names := make(map[int]string)
+	for _, process := range processes {
+		names[process.UID] = process.Name
+	}
+	f.Metric = metric
+	measurements, err := plm.Measurements(context.Background(), f)
+	if err != nil {
+		return err
+	}
+	if len(measurements.Series) < 1 {
+		return fmt.Errorf("no process found")
+	}
+	failed := 0
+	fmt.Printf("%-8s %-30s %12s %12s\n", "UID", "Name", "Samples", "Growth")
+	for _, series := range measurements.Series {
+		growth, hasGrowth := leakGrowth(series.Values)
+		if !hasGrowth {
+			fmt.Printf("%-8d %-30s %12d %12s\n", series.UID, names[series.UID], len(series.Values), "-")
+			continue
+		}
+		fmt.Printf("%-8d %-30s %12d %12.1f\n", series.UID, names[series.UID], len(series.Values), growth)
+		if FailLimit != -1 && growth > float64(FailLimit) {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("fail: %s of %d process(es) grew more than %d", metric, failed, FailLimit)
+	}
+	return nil
+}
+
+// StatsLimits are the fail limits of the stats command (KB). -1 means no
+// limit.
+type StatsLimits struct {
+	Mean   int64
+	Median int64
+	P90    int64
+	P95    int64
+	P99    int64
+}
+
+// CmdStats displays statistical summaries of the memory of one or more
+// processes. Fails if any of the statistics of any process is above its
+// limit.
+func CmdStats(limits StatsLimits) error {
+	f, err := getFilter()
+	if err != nil {
+		return err
+	}
+	processes, err := plm.Stats(context.Background(), f)
+	if err != nil {
+		return err
+	}
+	if len(processes) < 1 {
+		return fmt.Errorf("no process found")
+	}
+	fmt.Printf("%-8s %-30s %7s %10s %10s %10s %10s %10s %10s %10s %10s %12s\n", "UID", "Name", "Count", "Min (KB)",
+		"Max (KB)", "Mean", "Median", "P90", "P95", "P99", "Std dev", "KB hours")
+	var failures []string
+	for _, process := range processes {
+		s := process.Stats
+		fmt.Printf("%-8d %-30s %7d %10d %10d %10.0f %10.0f %10.0f %10.0f %10.0f %10.0f %12.1f\n", process.UID, process.Name,
+			s.Count, s.Min, s.Max, s.Mean, s.Median, s.P90, s.P95, s.P99, s.StdDev, s.KBHours)
+		for _, check := range []struct {
+			name  string
+			value float64
+			limit int64
+		}{{"mean", s.Mean, limits.Mean}, {"median", s.Median, limits.Median},
+			{"p90", s.P90, limits.P90}, {"p95", s.P95, limits.P95}, {"p99", s.P99, limits.P99}} {
+			if check.limit != -1 && check.value > float64(check.limit) {
+				failures = append(failures, fmt.Sprintf("%s (UID %d) %s %.0f KB exceeds %d KB",
+					process.Name, process.UID, check.name, check.value, check.limit))
+			}
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("fail: %s", strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+// CmdIO displays the I/O done by one or more processes during the period,
+// and the total of all processes. Fails if the total of the metric is above
+// the -f limit.
+func CmdIO(metric string) error {
+	f, err := getFilter()
+	if err != nil {
+		return err
+	}
+	processes, err := plm.IO(context.Background(), f)
+	if err != nil {
+		return err
+	}
+	if len(processes) < 1 {
+		return fmt.Errorf("no process found")
+	}
+	var total monitor.ProcessIO
+	fmt.Printf("%-8s %-30s %14s %14s %14s %14s %10s %10s\n", "UID", "Name", "Read (B)", "Written (B)",
+		"Disk read (B)", "Disk wr. (B)", "Read ops", "Write ops")
+	printIO := func(uid string, name string, pio monitor.ProcessIO) {
+		fmt.Printf("%-8s %-30s %14d %14d %14d %14d %10d %10d\n", uid, name, pio.ReadBytes, pio.WriteBytes,
+			pio.DiskReadBytes, pio.DiskWriteBytes, pio.ReadOps, pio.WriteOps)
+	}
+	for _, process := range processes {
+		pio := process.IOInPeriod
+		printIO(strconv.Itoa(process.UID), process.Name, pio)
+		total.ReadBytes += pio.ReadBytes
+		total.WriteBytes += pio.WriteBytes
+		total.DiskReadBytes += pio.DiskReadBytes
+		total.DiskWriteBytes += pio.DiskWriteBytes
+		total.ReadOps += pio.ReadOps
+		total.WriteOps += pio.WriteOps
+	}
+	printIO("", "Total", total)
+	totals := map[string]uint64{
+		monitor.MetricReadBytes:      total.ReadBytes,
+		monitor.MetricWriteBytes:     total.WriteBytes,
+		monitor.MetricDiskReadBytes:  total.DiskReadBytes,
+		monitor.MetricDiskWriteBytes: total.DiskWriteBytes,
+		monitor.MetricReadOps:        total.ReadOps,
+		monitor.MetricWriteOps:       total.WriteOps}
+	if FailLimit != -1 && totals[metric] > uint64(FailLimit) {
+		return fmt.Errorf("fail: %s %d exceeds %d", metric, totals[metric], FailLimit)
+	}
+	return nil
+}
+
+// CmdCheckOOM fails if any process selected by the filter, and alive
+// during the period of the filter, was killed by the OOM killer
+// (-fail-on-oom). The processes are checked rather than the events, since
+// the server detects the death after the end of the period.
+func CmdCheckOOM(f client.Filter) error {
+	processes, err := plm.MinMax(context.Background(), f)
+	if err != nil {
+		return err
+	}
+	killed := 0
+	for _, process := range processes {
+		if process.MaxMemoryInPeriod > 0 && process.Exit.Reason == monitor.ExitOOMKilled {
+			fmt.Printf("OOM killed: %s (PID %d, UID %d) at %s. %s\n", process.Name, process.Pid, process.UID,
+				process.Died.Format(time.RFC3339), process.Exit.Detail)
+			killed++
+		}
+	}
+	if killed > 0 {
+		return fmt.Errorf("fail: %d process(es) killed by the OOM killer", killed)
 	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Unexpected status code from plm server: %d\n%s", resp.StatusCode, body)
+	return nil
+}
+
+func getMinMax() ([]client.ProcessMinMaxMem, error) {
+	f, err := getFilter()
+	if err != nil {
+		return nil, err
 	}
-	var processes []ProcessMinMaxMem
-	err = json.Unmarshal(body, &processes)
+	processes, err := plm.MinMax(context.Background(), f)
 	if err != nil {
 		return nil, err
 	}
@@ -177,70 +390,364 @@ func getMinMax() ([]ProcessMinMaxMem, error) {
 	}
 	if len(processes) > 1 {
 		fmt.Printf("WARNING! More than one process found that match query (%d)\n", len(processes))
+		if Host != "" {
+			for _, process := range processes {
+				fmt.Printf("  %s: %s (PID %d) max %d KB, min %d KB\n", process.Host, process.Name,
+					process.Pid, process.MaxMemoryInPeriod, process.MinMemoryInPeriod)
+			}
+		}
 	}
 	return processes, nil
 }
 
-// CmdTagSet creates a tag
-func CmdTagSet(tagName string) error {
-	resp, err := http.Post(fmt.Sprintf("%s/tag/%s", PLMUrl, tagName), "", nil)
+// CmdCgroupMinMax displays the max or min memory used by the cgroups whose
+// path contain cgroup
+func CmdCgroupMinMax(cgroup string, max bool) error {
+	f, err := getFilter()
 	if err != nil {
 		return err
 	}
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Unexpected status code from plm server: %d", resp.StatusCode)
+	cgroups, err := plm.Cgroups(context.Background(), f, cgroup)
+	if err != nil {
+		return err
+	}
+	if len(cgroups) < 1 {
+		return fmt.Errorf("no cgroup found")
+	}
+	if len(cgroups) > 1 {
+		fmt.Printf("WARNING! More than one cgroup found that match query (%d)\n", len(cgroups))
+		for _, c := range cgroups {
+			fmt.Printf("  %s: max %d KB, min %d KB\n", c.Path, c.MaxMemoryInPeriod, c.MinMemoryInPeriod)
+		}
+	}
+	memory := cgroups[0].MaxMemoryInPeriod
+	if !max {
+		memory = cgroups[0].MinMemoryInPeriod
+	}
+	for _, c := range cgroups[1:] {
+		if max && c.MaxMemoryInPeriod > memory {
+			memory = c.MaxMemoryInPeriod
+		}
+		if !max && c.MinMemoryInPeriod < memory {
+			memory = c.MinMemoryInPeriod
+		}
+	}
+	fmt.Println(memory, "KB")
+	if FailLimit != -1 && max && memory > uint32(FailLimit) {
+		return fmt.Errorf("fail: %d KB exceeds %d KB", memory, FailLimit)
+	}
+	if FailLimit != -1 && !max && memory < uint32(FailLimit) {
+		return fmt.Errorf("fail: %d KB is less than %d KB", memory, FailLimit)
 	}
 	return nil
 }
 
+// CmdCgroups lists the cgroups whose path contain cgroup
+func CmdCgroups(cgroup string) error {
+	f, err := getFilter()
+	if err != nil {
+		return err
+	}
+	cgroups, err := plm.Cgroups(context.Background(), f, cgroup)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%-50s %12s %12s %12s %9s %9s\n", "Cgroup", "Last (KB)", "Max (KB)", "Limit (KB)", "OOM kills", "Processes")
+	for _, c := range cgroups {
+		limit := "-"
+		if c.Limit > 0 {
+			limit = strconv.FormatUint(uint64(c.Limit), 10)
+		}
+		fmt.Printf("%-50s %12d %12d %12s %9d %9d\n", c.Path, c.LastMemory, c.MaxMemoryInPeriod, limit, c.OOMKills, len(c.UIDs))
+	}
+	return nil
+}
+
+// CmdTagSet creates a tag
+func CmdTagSet(tagName string) error {
+	_, err := plm.SetTag(context.Background(), tagName)
+	return err
+}
+
 // CmdTagGet gets a tag
 func CmdTagGet(tagName string) error {
-	resp, err := http.Get(fmt.Sprintf("%s/tag/%s", PLMUrl, tagName))
+	t, err := plm.GetTag(context.Background(), tagName)
+	if client.IsNotFound(err) {
+		return fmt.Errorf("Tag %s has never been created", tagName)
+	}
 	if err != nil {
 		return err
 	}
-	if resp.StatusCode == http.StatusNotFound {
-		return fmt.Errorf("Tag %s has never been created", tagName)
+	fmt.Println(t)
+	return nil
+}
+
+// CmdTags list all tags
+func CmdTags() error {
+	tags, err := plm.Tags(context.Background())
+	if err != nil {
+		return err
 	}
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Unexpected status code from plm server: %d", resp.StatusCode)
+	for _, tag := range tags {
+		fmt.Printf("%v: %v\n", tag.Name, tag.Time)
+	}
+	return nil
+}
+
+func printRun(run *client.Run) {
+	fmt.Println("Name:            ", run.Name)
+	for key, value := range run.Labels {
+		fmt.Printf("Label:            %s=%s\n", key, value)
+	}
+	fmt.Println("Start:           ", run.Start)
+	if run.Running {
+		fmt.Println("Running:          yes")
+	} else {
+		fmt.Println("End:             ", run.End)
+		fmt.Println("Duration:        ", run.End.Sub(run.Start).Round(time.Second))
+	}
+	fmt.Println("Processes:       ", run.NbrProcesses)
+	fmt.Println("Peak memory:     ", run.MaxPhys, "KB")
+	for i, p := range run.Processes {
+		if i == 0 {
+			fmt.Println("")
+			fmt.Printf("%-8s %-8s %-30s %12s %12s %12s\n", "UID", "PID", "Name", "Max (KB)", "Avg (KB)", "Min (KB)")
+		}
+		fmt.Printf("%-8d %-8d %-30s %12d %12d %12d\n", p.UID, p.Pid, p.Name, p.MaxMemory, p.AvgMemory, p.MinMemory)
+	}
+}
+
+// CmdRunStart starts a run
+func CmdRunStart(name string, labels map[string]string) error {
+	run, err := plm.StartRun(context.Background(), name, labels)
+	if err != nil {
+		return err
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	fmt.Println("Run", run.Name, "started", run.Start)
+	return nil
+}
+
+// CmdRunStop stops a run and prints its summary
+func CmdRunStop(name string) error {
+	run, err := plm.StopRun(context.Background(), name)
 	if err != nil {
 		return err
 	}
-	var t time.Time
-	err = json.Unmarshal(body, &t)
+	printRun(run)
+	return nil
+}
+
+// CmdRunInfo prints the summary of a run
+func CmdRunInfo(name string) error {
+	run, err := plm.GetRun(context.Background(), name)
 	if err != nil {
 		return err
 	}
-	fmt.Println(t)
+	printRun(run)
 	return nil
 }
 
-// CmdTags list all tags
-func CmdTags() error {
-	resp, err := http.Get(fmt.Sprintf("%s/tags", PLMUrl))
+// CmdRunList lists all runs
+func CmdRunList() error {
+	runs, err := plm.ListRuns(context.Background())
 	if err != nil {
 		return err
 	}
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Unexpected status code from plm server: %d", resp.StatusCode)
+	for _, run := range runs {
+		state := "running"
+		if !run.Running {
+			state = run.End.Sub(run.Start).Round(time.Second).String()
+		}
+		fmt.Printf("%-30s %s  %-10s %4d processes  %d KB\n", run.Name, run.Start.Format("2006-01-02 15:04:05"),
+			state, run.NbrProcesses, run.MaxPhys)
+	}
+	return nil
+}
+
+// printComparison prints the comparison and returns an error if there is a
+// regression
+func printComparison(c *client.Comparison, base string, head string) error {
+	fmt.Printf("%-10s %12s %12s %12s %10s\n", "", "Base (KB)", "Head (KB)", "Delta (KB)", "Delta (%)")
+	for _, row := range []struct {
+		name  string
+		delta client.Delta
+	}{{"Peak", c.Peak}, {"Average", c.Avg}, {"Growth", c.Growth}} {
+		exceeded := ""
+		if row.delta.Exceeded {
+			exceeded = " (exceeds tolerance)"
+		}
+		fmt.Printf("%-10s %12d %12d %+12d %+10.1f%s\n", row.name, row.delta.Base, row.delta.Head,
+			row.delta.Diff, row.delta.Percent, exceeded)
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	if c.Regression {
+		return fmt.Errorf("Regression from %s to %s", base, head)
+	}
+	return nil
+}
+
+// CmdCompare compares two runs. A report is written to output if not
+// empty. Fails if there is a regression above the tolerance.
+func CmdCompare(base string, head string, tolerance client.Tolerance, output string) error {
+	var match []string
+	if Matcher != "" {
+		match = []string{Matcher}
+	}
+	ctx := context.Background()
+	c, err := plm.Compare(ctx, base, head, match, tolerance)
 	if err != nil {
 		return err
 	}
-	tags := make(map[string]time.Time)
-	err = json.Unmarshal(body, &tags)
+
+	if output != "" {
+		var report []byte
+		if strings.HasSuffix(strings.ToLower(output), ".json") {
+			report, err = json.Marshal(c)
+		} else {
+			report, err = plm.CompareReport(ctx, base, head, match, tolerance)
+		}
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(output, report, 0644)
+		if err != nil {
+			return err
+		}
+		fmt.Println(output, " written")
+	}
+	return printComparison(c, base, head)
+}
+
+// CmdSnapshotSave saves a snapshot of the processes and period selected
+// by the -m, -u, -from, -to and -run flags to filename
+func CmdSnapshotSave(filename string) error {
+	f, err := getFilter()
 	if err != nil {
 		return err
 	}
-	for tag, t := range tags {
-		fmt.Printf("%v: %v\n", tag, t)
+	snapshot, err := plm.GetSnapshot(context.Background(), f)
+	if err != nil {
+		return err
 	}
+	js, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filename, js, 0644)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s written. %d processes, %d measurements, peak %d KB\n", filename,
+		len(snapshot.Processes), len(snapshot.Series.Memory), snapshot.Series.Peak)
+	return nil
+}
+
+// CmdSnapshotDiff compares the snapshot in filename (base) with the live
+// data (head) selected by the -m, -from, -to and -run flags. Fails if
+// there is a regression above the tolerance.
+func CmdSnapshotDiff(filename string, tolerance client.Tolerance) error {
+	js, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var snapshot client.Snapshot
+	if err = json.Unmarshal(js, &snapshot); err != nil {
+		return fmt.Errorf("Invalid snapshot %s. Reason: %s", filename, err)
+	}
+	f, err := getFilter()
+	if err != nil {
+		return err
+	}
+	c, err := plm.DiffSnapshot(context.Background(), &snapshot, f, tolerance)
+	if err != nil {
+		return err
+	}
+	return printComparison(c, filename, "live data")
+}
+
+// printWatch prints a watch on one line
+func printWatch(watch *monitor.Watch) {
+	processes := strings.Join(watch.Match, ",")
+	if processes == "" {
+		uids := make([]string, 0, len(watch.UIDs))
+		for _, uid := range watch.UIDs {
+			uids = append(uids, strconv.Itoa(uid))
+		}
+		processes = "UIDs " + strings.Join(uids, ",")
+	}
+	state := "expires " + watch.Expires.Format("2006-01-02 15:04:05")
+	if !watch.Active {
+		state = "stopped"
+	}
+	fmt.Printf("%-4d %-30s %6d ms  %-28s %d samples\n", watch.ID, processes, watch.IntervalMs, state, watch.NbrSamples)
+}
+
+// CmdWatchStart starts sampling the processes selected by the -m or -u
+// flags every interval during duration
+func CmdWatchStart(interval time.Duration, duration time.Duration) error {
+	f, err := getFilter()
+	if err != nil {
+		return err
+	}
+	watch, err := plm.StartWatch(context.Background(), f, interval, duration)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Watch %d started. Expires %s\n", watch.ID, watch.Expires.Format("2006-01-02 15:04:05"))
+	return nil
+}
+
+// CmdWatchList lists all watches
+func CmdWatchList() error {
+	watches, err := plm.ListWatches(context.Background())
+	if err != nil {
+		return err
+	}
+	for i := range watches {
+		printWatch(&watches[i])
+	}
+	return nil
+}
+
+// CmdWatchStop stops a watch
+func CmdWatchStop(id int) error {
+	watch, err := plm.StopWatch(context.Background(), id)
+	if err != nil {
+		return err
+	}
+	printWatch(watch)
+	return nil
+}
+
+// CmdConfig lists the PLM server configuration. If settings on the format
+// <key>=<value> are provided, the configuration is changed first.
+func CmdConfig(settings []string) error {
+	var config *client.Configuration
+	var err error
+	if len(settings) == 0 {
+		config, err = plm.Config(context.Background())
+	} else {
+		newConfig := make(map[string]int)
+		for _, setting := range settings {
+			parts := strings.SplitN(setting, "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("Invalid setting %s. Expected <key>=<value>", setting)
+			}
+			value, valueerr := strconv.Atoi(parts[1])
+			if valueerr != nil {
+				return fmt.Errorf("Invalid setting %s. Value is not a valid integer", setting)
+			}
+			newConfig[parts[0]] = value
+		}
+		config, err = plm.SetConfig(context.Background(), newConfig)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("port:         ", config.Port)
+	fmt.Println("fastLogTimeMs:", config.FastLogTimeMs)
+	fmt.Println("slowLogFactor:", config.SlowLogFactor)
+	fmt.Println("fastLogSize:  ", config.FastLogSize)
+	fmt.Println("slowLogSize:  ", config.SlowLogSize)
 	return nil
 }
 
@@ -254,28 +761,10 @@ func CmdVersion() error {
 	fmt.Printf("\n")
 
 	// Try to list plm version
-	resp, err := http.Get(fmt.Sprintf("%s/version", PLMUrl))
+	ver, err := plm.Version(context.Background())
 	if err != nil {
 		return fmt.Errorf("Cannot detect plm server version: %s. ", err)
 	}
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Unexpected status code from plm server: %d. ", resp.StatusCode)
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-	type version struct {
-		Version   string
-		BuildTime string
-		GitHash   string
-	}
-	ver := version{}
-	err = json.Unmarshal(body, &ver)
-	if err != nil {
-		return err
-	}
 	fmt.Printf("Server Version:    %s\n", ver.Version)
 	fmt.Printf("Server Build Time: %s\n", ver.BuildTime)
 	fmt.Printf("Server GIT Hash:   %s\n", ver.GitHash)
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/midstar/plm/client"
+	"github.com/midstar/plm/monitor"
+)
+
+// CmdExec starts a command and measures its memory, including the memory
+// of its descendants, using the PLM server. The start and end of the
+// command are tagged with <tag>_START and <tag>_END. A plot is written to
+// plotFile (a file in the temporary directory if empty).
+//
+// How the command exited is stored on the PLM server. Returns the exit
+// code of the command. An error is returned if the total memory was above
+// limit (not checked if negative) or, with -fail-on-oom, if the command or
+// any of its descendants was killed by the OOM killer.
+func CmdExec(args []string, limit int64, plotFile string, tag string) (int, error) {
+	if tag == "" {
+		tag = "EXEC_" + time.Now().Format("20060102_150405")
+	}
+	if plotFile == "" {
+		plotFile = filepath.Join(os.TempDir(), tag+".html")
+	}
+	startTag, endTag := tag+"_START", tag+"_END"
+	interval := getMeasurementInterval()
+
+	if err := CmdTagSet(startTag); err != nil {
+		return 0, err
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Start()
+	if err != nil {
+		return 0, err
+	}
+	pid := cmd.Process.Pid
+
+	// Interrupts are also received by the command. Wait for it to exit.
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	started := time.Now()
+	err = cmd.Wait()
+	duration := time.Since(started)
+	exitCode := 0
+	if exitErr, isExitErr := err.(*exec.ExitError); isExitErr {
+		exitCode = getExitCode(exitErr.ProcessState)
+	} else if err != nil {
+		return 0, err
+	}
+	if err = CmdTagSet(endTag); err != nil {
+		return exitCode, err
+	}
+	exit := getExit(cmd.ProcessState)
+	if err = reportExit(uint32(pid), exit, startTag, endTag); err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING! Unable to store the exit of PID %d: %s\n", pid, err)
+	}
+
+	f := client.Filter{Pid: uint32(pid), Descendants: true, FromTag: startTag, ToTag: endTag}
+	result, err := plm.GetSnapshot(context.Background(), f)
+	if err != nil {
+		return exitCode, err
+	}
+
+	printExit(pid, exit, exitCode, duration)
+	if len(result.Series.Memory) == 0 {
+		fmt.Printf("No measurements. The command ran shorter than the measurement interval (%s)\n", interval)
+		return exitCode, checkOOM(f, interval)
+	}
+	printExecMemory(result)
+	fmt.Printf("Tags:             %s, %s\n", startTag, endTag)
+
+	plot, err := plm.Plot(context.Background(), f)
+	if err != nil {
+		return exitCode, err
+	}
+	if err = ioutil.WriteFile(plotFile, plot, 0644); err != nil {
+		return exitCode, err
+	}
+	fmt.Printf("Plot:             %s\n", plotFile)
+
+	if err = checkLimit(result.Series.Peak, limit); err != nil {
+		return exitCode, err
+	}
+	return exitCode, checkOOM(f, interval)
+}
+
+// printExit prints how the command exited
+func printExit(pid int, exit monitor.Exit, exitCode int, duration time.Duration) {
+	fmt.Println("")
+	if exit.Reason == monitor.ExitSignaled {
+		fmt.Printf("PID %d was terminated (%s) after %s\n", pid, exit.Detail, duration.Round(time.Millisecond))
+	} else {
+		fmt.Printf("PID %d exited with code %d after %s\n", pid, exitCode, duration.Round(time.Millisecond))
+	}
+}
+
+// printExecMemory prints the memory of the processes and the total memory
+// of the command
+func printExecMemory(result *client.Snapshot) {
+	if len(result.Processes) > 0 {
+		fmt.Printf("%-8s %-30s %12s %12s %12s\n", "PID", "Name", "Max (KB)", "Avg (KB)", "Min (KB)")
+		for _, p := range result.Processes {
+			fmt.Printf("%-8d %-30s %12d %12d %12d\n", p.Pid, p.Name, p.MaxMemory, p.AvgMemory, p.MinMemory)
+		}
+	}
+	var min uint32
+	for _, value := range result.Series.Memory {
+		if value != 0 && (min == 0 || value < min) {
+			min = value
+		}
+	}
+	fmt.Printf("Total max memory: %d KB\n", result.Series.Peak)
+	fmt.Printf("Total avg memory: %d KB\n", result.Series.Avg)
+	fmt.Printf("Total min memory: %d KB\n", min)
+}
+
+// checkLimit returns an error if the total max memory is above limit (not
+// checked if negative)
+func checkLimit(peak uint32, limit int64) error {
+	if limit >= 0 && int64(peak) > limit {
+		return fmt.Errorf("Max memory %d KB is above the limit %d KB", peak, limit)
+	}
+	return nil
+}
+
+// checkOOM returns an error, with -fail-on-oom, if the command or any of
+// its descendants was killed by the OOM killer
+func checkOOM(f client.Filter, interval time.Duration) error {
+	if !FailOnOOM {
+		return nil
+	}
+	// Allow the server to detect that the processes died
+	time.Sleep(interval)
+	return CmdCheckOOM(f)
+}
+
+// getExitCode returns the exit code of a command, or 128 + the signal
+// number if it was terminated by a signal (as shells do)
+func getExitCode(state *os.ProcessState) int {
+	if status, isWaitStatus := state.Sys().(syscall.WaitStatus); isWaitStatus && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return state.ExitCode()
+}
+
+// getExit returns how a command exited
+func getExit(state *os.ProcessState) monitor.Exit {
+	if status, isWaitStatus := state.Sys().(syscall.WaitStatus); isWaitStatus && status.Signaled() {
+		return monitor.Exit{Reason: monitor.ExitSignaled, Detail: "signal: " + status.Signal().String()}
+	}
+	if state.ExitCode() == 0 {
+		return monitor.Exit{Reason: monitor.ExitNormal, Detail: "exit code 0"}
+	}
+	return monitor.Exit{Reason: monitor.ExitFailed, Detail: fmt.Sprintf("exit code %d", state.ExitCode())}
+}
+
+// reportExit stores how the command with the provided PID exited on the
+// PLM server. Nothing is stored if the command was not measured.
+func reportExit(pid uint32, exit monitor.Exit, startTag string, endTag string) error {
+	processes, err := plm.ListProcesses(context.Background(), client.Filter{Pid: pid, FromTag: startTag, ToTag: endTag})
+	if err != nil {
+		return err
+	}
+	for _, process := range processes {
+		if process.Pid == pid {
+			_, err = plm.SetExit(context.Background(), process.UID, exit)
+			return err
+		}
+	}
+	return nil
+}
+
+// getMeasurementInterval returns the time between measurements of the PLM
+// server, or zero if unknown
+func getMeasurementInterval() time.Duration {
+	config, err := plm.Config(context.Background())
+	if err != nil {
+		return 0
+	}
+	return time.Duration(config.FastLogTimeMs) * time.Millisecond
+}
@@ -4,6 +4,12 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/midstar/plm/client"
+	"github.com/midstar/plm/monitor"
 )
 
 // PLMUrl to PLM server (daemon)
@@ -15,30 +21,69 @@ var Matcher string
 // UIDs uid -u flag
 var UIDs string
 
-// FromTag -from flag
+// FromTag -from flag. A tag or another time expression resolved by the
+// server, such as START_TEST+30s or -15m
 var FromTag string
 
-// ToTag -to flag
+// ToTag -to flag. Same format as FromTag
 var ToTag string
 
+// Last -last flag
+var Last time.Duration
+
+// Run -run flag
+var Run string
+
 // FailLimit memory fail limit -f flag
 var FailLimit int64
 
+// Host -host flag. Comma separated host names or "all"
+var Host string
+
+// FailOnOOM -fail-on-oom flag
+var FailOnOOM bool
+
+// Token -token flag (or PLM_TOKEN environment variable)
+var Token string
+
 func printUsage() {
 	fmt.Printf("usage: plmc [options] <command> [<args>]\n\n")
 	fmt.Printf(" General options:\n")
 	fmt.Printf("  -h   Help (overview)\n")
 	fmt.Printf("  -v   Display version\n")
 	fmt.Printf("  -a   PLM server (daemon) URL address. Default http://localhost:12124\n")
+	fmt.Printf("       Use https:// if the PLM server is configured with TLS\n")
+	fmt.Printf("  -token <string>   Token for authentication. Default is the value\n")
+	fmt.Printf("                    of the PLM_TOKEN environment variable\n")
+	fmt.Printf("  -cacert <file>    CA certificate (PEM) to verify the PLM server\n")
+	fmt.Printf("                    with. Default is the value of PLM_CACERT\n")
+	fmt.Printf("  -insecure         Don't verify the PLM server certificate\n")
+	fmt.Printf("  -host <hosts>     Use the hosts of a PLM aggregator. Comma\n")
+	fmt.Printf("                    separated host names or all. Applies to\n")
+	fmt.Printf("                    info, maxmem and minmem\n")
+	fmt.Printf("  -fail-on-oom      Fail (return code 1) if any of the processes\n")
+	fmt.Printf("                    was killed by the OOM killer. Applies to\n")
+	fmt.Printf("                    maxmem, minmem and exec\n")
 	fmt.Printf("\n Commands:\n")
 	fmt.Printf("  help   Help for a command\n")
 	fmt.Printf("  plot   Download plot for one or more processes\n")
 	fmt.Printf("  info   List info about one or more processes\n")
 	fmt.Printf("  maxmem Display max memory used by process\n")
 	fmt.Printf("  minmem Display min memory used by process\n")
+	fmt.Printf("  maxfds Display max number of open file descriptors of process\n")
+	fmt.Printf("  leakcheck Check if the memory, FDs or threads of processes grow\n")
+	fmt.Printf("  io     Display the disk and network I/O of processes\n")
+	fmt.Printf("  stats  Display statistics, such as percentiles, of the memory of processes\n")
 	fmt.Printf("  tagset Create a tag\n")
 	fmt.Printf("  tagget Get a tag\n")
 	fmt.Printf("  tags   List all tags\n")
+	fmt.Printf("  config List or change the PLM server configuration\n")
+	fmt.Printf("  run    Start, stop or list runs\n")
+	fmt.Printf("  compare Compare the memory of processes in two runs\n")
+	fmt.Printf("  snapshot Save a snapshot to file or compare with a snapshot\n")
+	fmt.Printf("  exec   Start a command and measure its memory\n")
+	fmt.Printf("  watch  Sample processes more often than the server\n")
+	fmt.Printf("  cgroups List the memory of cgroups (Linux)\n")
 }
 
 func printUsageCommand(command string) {
@@ -50,10 +95,12 @@ func printUsageCommand(command string) {
 		fmt.Printf("Plot memory usage of processes.\n")
 		fmt.Printf("By default all processes are plotted. Can be resttricted\n")
 		fmt.Printf("with options described below\n\n")
-		fmt.Printf("Usage: plmc [options] plot <filename>\n\n")
+		fmt.Printf("Usage: plmc [options] plot [-metric <metric>] <filename>\n\n")
 		fmt.Printf(" Options:\n")
 		printProcessFilterFlags()
 		printFromToFlags()
+		fmt.Printf("  -metric <metric> Metric to plot. Default memory. One of\n")
+		fmt.Printf("                  %s\n", strings.Join(monitor.Metrics, ", "))
 	case "info":
 		fmt.Printf("List process info.\n")
 		fmt.Printf("By default all processes are listed. Can be resttricted\n")
@@ -65,7 +112,7 @@ func printUsageCommand(command string) {
 		fmt.Printf("Display max memory used by process.\n")
 		fmt.Printf("By default all processes are listed. Can be resttricted\n")
 		fmt.Printf("with options described below\n\n")
-		fmt.Printf("Usage: plmc [options] maxmem\n\n")
+		fmt.Printf("Usage: plmc [options] maxmem [-cgroup <path>]\n\n")
 		fmt.Printf(" Options:\n")
 		printProcessFilterFlags()
 		printFromToFlags()
@@ -73,11 +120,15 @@ func printUsageCommand(command string) {
 		fmt.Printf("                  specified value in KB. If more than one\n")
 		fmt.Printf("                  process match the command will fail if any\n")
 		fmt.Printf("                  of the processes max memory is over the limit\n")
+		fmt.Printf("  -cgroup <path>  Display the max memory of the cgroups (Linux)\n")
+		fmt.Printf("                  whose path contain <path> instead of processes\n")
+		fmt.Printf("  -fail-on-oom    Fail (return code 1) if any of the processes\n")
+		fmt.Printf("                  was killed by the OOM killer\n")
 	case "minmem":
 		fmt.Printf("Display min memory used by process.\n")
 		fmt.Printf("By default all processes are listed. Can be resttricted\n")
 		fmt.Printf("with options described below\n\n")
-		fmt.Printf("Usage: plmc [options] minmem\n\n")
+		fmt.Printf("Usage: plmc [options] minmem [-cgroup <path>]\n\n")
 		fmt.Printf(" Options:\n")
 		printProcessFilterFlags()
 		printFromToFlags()
@@ -85,6 +136,73 @@ func printUsageCommand(command string) {
 		fmt.Printf("                  specified value in KB. If more than one\n")
 		fmt.Printf("                  process match the command will fail if any\n")
 		fmt.Printf("                  of the processes min memory is below the limit\n")
+		fmt.Printf("  -cgroup <path>  Display the min memory of the cgroups (Linux)\n")
+		fmt.Printf("                  whose path contain <path> instead of processes\n")
+		fmt.Printf("  -fail-on-oom    Fail (return code 1) if any of the processes\n")
+		fmt.Printf("                  was killed by the OOM killer\n")
+	case "maxfds":
+		fmt.Printf("Display max number of open file descriptors (handles on\n")
+		fmt.Printf("Windows) of process. By default all processes are\n")
+		fmt.Printf("included. Can be resttricted with options described below\n\n")
+		fmt.Printf("Usage: plmc [options] maxfds\n\n")
+		fmt.Printf(" Options:\n")
+		printProcessFilterFlags()
+		printFromToFlags()
+		fmt.Printf("  -f <int>        Fail (return code 1) if the number of file\n")
+		fmt.Printf("                  descriptors of any process is above the\n")
+		fmt.Printf("                  specified value\n")
+	case "leakcheck":
+		fmt.Printf("Check if a metric of processes grows during the period,\n")
+		fmt.Printf("which indicates a leak. The growth is the mean of the last\n")
+		fmt.Printf("third of the measurements minus the mean of the first third.\n\n")
+		fmt.Printf("Usage: plmc [options] leakcheck [-metric <metric>]\n\n")
+		fmt.Printf(" Options:\n")
+		printProcessFilterFlags()
+		printFromToFlags()
+		fmt.Printf("  -f <int>        Fail (return code 1) if the growth of any\n")
+		fmt.Printf("                  process is above the specified value\n")
+		fmt.Printf("  -metric <metric> memory (KB), fds or threads. Default memory\n\n")
+		fmt.Printf("Example: plmc -m myapp -from START -to END -f 10 leakcheck -metric threads\n")
+	case "stats":
+		fmt.Printf("Display statistics of the memory used by processes during\n")
+		fmt.Printf("the period: number of measurements, min, max, mean, median,\n")
+		fmt.Printf("90th, 95th and 99th percentiles, standard deviation and the\n")
+		fmt.Printf("memory integrated over time (KB hours). Use the percentiles\n")
+		fmt.Printf("as limits to fail on sustained usage but not on a single\n")
+		fmt.Printf("spike.\n\n")
+		fmt.Printf("Usage: plmc [options] stats [<limits>]\n\n")
+		fmt.Printf(" Options:\n")
+		printProcessFilterFlags()
+		printFromToFlags()
+		fmt.Printf("\n Limits (fail with return code 1 if any process is above):\n")
+		fmt.Printf("  -mean <int>     Mean memory in KB\n")
+		fmt.Printf("  -median <int>   Median memory in KB\n")
+		fmt.Printf("  -p90 <int>      90th percentile of the memory in KB\n")
+		fmt.Printf("  -p95 <int>      95th percentile of the memory in KB\n")
+		fmt.Printf("  -p99 <int>      99th percentile of the memory in KB\n\n")
+		fmt.Printf("Example: plmc -m myapp.exe -from START -to END stats -p95 400000\n")
+	case "io":
+		fmt.Printf("Display the bytes and operations read and written by\n")
+		fmt.Printf("processes during the period, and the total of all processes.\n")
+		fmt.Printf("The bytes include network and pipes, while the disk bytes\n")
+		fmt.Printf("are the bytes read from and written to storage (Linux).\n\n")
+		fmt.Printf("Usage: plmc [options] io [-metric <metric>]\n\n")
+		fmt.Printf(" Options:\n")
+		printProcessFilterFlags()
+		printFromToFlags()
+		fmt.Printf("  -f <int>        Fail (return code 1) if the total of the\n")
+		fmt.Printf("                  metric is above the specified value\n")
+		fmt.Printf("  -metric <metric> Metric that -f applies to. readBytes,\n")
+		fmt.Printf("                  writeBytes, diskReadBytes, diskWriteBytes,\n")
+		fmt.Printf("                  readOps or writeOps. Default writeBytes\n\n")
+		fmt.Printf("Example: plmc -m myapp.exe -from START -to END -f 1000000000 io\n")
+	case "cgroups":
+		fmt.Printf("List the cgroups (Linux) of the processes with their memory,\n")
+		fmt.Printf("limit and number of processes killed due to out of memory.\n\n")
+		fmt.Printf("Usage: plmc [options] cgroups [<path>]\n\n")
+		fmt.Printf("Only cgroups whose path contain <path> are listed if given.\n\n")
+		fmt.Printf(" Options:\n")
+		printFromToFlags()
 	case "tagset":
 		fmt.Printf("Create a tag (i.e. a named timestamp).\n\n")
 		fmt.Printf("Usage: plmc tagset <tagname>\n")
@@ -94,6 +212,101 @@ func printUsageCommand(command string) {
 	case "tags":
 		fmt.Printf("List all tags.\n\n")
 		fmt.Printf("Usage: plmc tags\n\n")
+	case "run":
+		fmt.Printf("Start, stop or list runs. A run is a named period, for\n")
+		fmt.Printf("example a test run, with labels. Use -run <name> instead\n")
+		fmt.Printf("of -from and -to to restrict other commands to a run.\n\n")
+		fmt.Printf("Usage: plmc run start <name> [-label <key>=<value> ...]\n")
+		fmt.Printf("       plmc run stop <name>\n")
+		fmt.Printf("       plmc run list\n")
+		fmt.Printf("       plmc run info <name>\n\n")
+		fmt.Printf("The labels may also be given before the name.\n\n")
+		fmt.Printf("Example: plmc run start TEST_1234 -label build=1234 -label branch=master\n")
+	case "compare":
+		fmt.Printf("Compare the memory of processes in two runs, for example\n")
+		fmt.Printf("a baseline run and the current run. The total memory of the\n")
+		fmt.Printf("processes is compared, aligned on the time since the start\n")
+		fmt.Printf("of each run.\n\n")
+		fmt.Printf("Usage: plmc compare -base <run> -head <run> [options]\n\n")
+		fmt.Printf(" Options:\n")
+		fmt.Printf("  -m <string>     Compare processes matching the string. Default\n")
+		fmt.Printf("                  is all processes of the runs\n")
+		printToleranceFlags()
+		fmt.Printf("  -o <file>       Write report to <file>. JSON if <file> ends\n")
+		fmt.Printf("                  with .json, otherwise HTML\n\n")
+		fmt.Printf("Example: plmc compare -base MASTER_1200 -head PR_1234 -m myapp.exe -threshold 10\n")
+	case "snapshot":
+		fmt.Printf("Save the memory of processes during a period to a file, or\n")
+		fmt.Printf("compare live data with such a file. Use it to compare with a\n")
+		fmt.Printf("baseline recorded on another host or by a restarted server.\n")
+		fmt.Printf("The file format is described in README.md.\n\n")
+		fmt.Printf("Usage: plmc snapshot save [options] <file>\n")
+		fmt.Printf("       plmc snapshot diff <file> [options]\n\n")
+		fmt.Printf(" Options:\n")
+		printProcessFilterFlags()
+		printFromToFlags()
+		fmt.Printf("  (-u is not accepted by diff, since UIDs differ between hosts.\n")
+		fmt.Printf("  diff uses the -m of the snapshot if -m is not given)\n")
+		fmt.Printf("\n Options (diff only):\n")
+		printToleranceFlags()
+		fmt.Printf("\nExample: plmc snapshot save -m app.exe -from A -to B baseline.json\n")
+		fmt.Printf("         plmc snapshot diff baseline.json -from C -to D -threshold 10\n")
+	case "exec":
+		fmt.Printf("Start a command and measure its memory, including the\n")
+		fmt.Printf("memory of the processes it starts, using the PLM server.\n")
+		fmt.Printf("The start and end are tagged with <tag>_START and <tag>_END.\n")
+		fmt.Printf("When the command exits the max, average and min memory and\n")
+		fmt.Printf("the path to a plot are printed. The exit code is the exit\n")
+		fmt.Printf("code of the command (128 + the signal number if it was\n")
+		fmt.Printf("terminated by a signal), or 1 if it succeeded but the limit\n")
+		fmt.Printf("was exceeded or, with -fail-on-oom, the command or any of\n")
+		fmt.Printf("its processes was killed by the OOM killer. How the command\n")
+		fmt.Printf("exited, for example due to a signal, is stored on the server.\n\n")
+		fmt.Printf("With -standalone no PLM server is used. plmc measures the\n")
+		fmt.Printf("processes itself and writes a snapshot (see snapshot diff)\n")
+		fmt.Printf("instead of a plot.\n\n")
+		fmt.Printf("Usage: plmc exec [options] -- <command> [<args>]\n\n")
+		fmt.Printf(" Options:\n")
+		fmt.Printf("  -limit <int>    Fail if the total max memory is above the\n")
+		fmt.Printf("                  specified value in KB\n")
+		fmt.Printf("  -plot <file>    Write the plot to <file>. Default is a file\n")
+		fmt.Printf("                  in the temporary directory\n")
+		fmt.Printf("  -tag <name>     Tag prefix. Default EXEC_<date>_<time>\n")
+		fmt.Printf("  -standalone     Measure without a PLM server\n")
+		fmt.Printf("  -interval <ms>  Time between measurements with -standalone.\n")
+		fmt.Printf("                  Default %d\n", DefaultStandaloneInterval/time.Millisecond)
+		fmt.Printf("  -snapshot <file>\n")
+		fmt.Printf("                  Write the snapshot of -standalone to <file>.\n")
+		fmt.Printf("                  Default is a file in the temporary directory\n\n")
+		fmt.Printf("Example: plmc exec -limit 512000 -- myapp --args\n")
+		fmt.Printf("         plmc exec -standalone -limit 512000 -- myapp --args\n")
+	case "watch":
+		fmt.Printf("Sample processes more often than the measurement interval\n")
+		fmt.Printf("of the PLM server (fastLogTimeMs), to catch short memory\n")
+		fmt.Printf("spikes. The samples are included by the other commands,\n")
+		fmt.Printf("for example maxmem. The watch expires after the duration.\n")
+		fmt.Printf("Processes matching -m are watched even if started later.\n\n")
+		fmt.Printf("Usage: plmc watch [options]\n")
+		fmt.Printf("       plmc watch list\n")
+		fmt.Printf("       plmc watch stop <id>\n\n")
+		fmt.Printf(" Options:\n")
+		printProcessFilterFlags()
+		fmt.Printf("  -interval <duration> Time between samples. Default 100ms\n")
+		fmt.Printf("  -duration <duration> Time until the watch expires. Default 10m\n\n")
+		fmt.Printf("Example: plmc watch -m myapp.exe -interval 100ms -duration 30m\n")
+	case "config":
+		fmt.Printf("List or change the PLM server (daemon) configuration.\n")
+		fmt.Printf("The configuration is changed without restarting the\n")
+		fmt.Printf("server and is written back to plm.config. Measured\n")
+		fmt.Printf("values are preserved.\n\n")
+		fmt.Printf("Usage: plmc config [<key>=<value> ...]\n\n")
+		fmt.Printf(" Keys:\n")
+		fmt.Printf("  fastLogTimeMs   Time between each measurement in ms\n")
+		fmt.Printf("  slowLogFactor   How often measurements are added to the\n")
+		fmt.Printf("                  slow log in relation to the fast log\n")
+		fmt.Printf("  fastLogSize     Number of measurements in fast log\n")
+		fmt.Printf("  slowLogSize     Number of measurements in slow log\n\n")
+		fmt.Printf("Example: plmc config fastLogTimeMs=1000 fastLogSize=3600\n")
 	default:
 		fmt.Fprintf(os.Stderr, "No such command %s\n\n", command)
 		printUsage()
@@ -104,41 +317,381 @@ func printProcessFilterFlags() {
 	fmt.Printf("  -m <string>     List all processes matching the string. To insert\n")
 	fmt.Printf("                  space surround your match with \". For example\n")
 	fmt.Printf("                  -m \"myprocess.exe -param 3\"\n")
+	fmt.Printf("                  Use user:<name>, session:<id>, cgroup:<string>\n")
+	fmt.Printf("                  or container:<id> to match the owner, for\n")
+	fmt.Printf("                  example -m user:jenkins-7\n")
 	fmt.Printf("  -u <int>        List process with matching UID. More than\n")
 	fmt.Printf("                  one UID can be entered in a comma separated\n")
 	fmt.Printf("                  list. For example -u 3,6,7\n")
 }
 
 func printFromToFlags() {
-	fmt.Printf("  -from <tagname> Use start time defined by <tagname>\n")
-	fmt.Printf("  -to <tagname>   Use end time defined by <tagname>\n")
+	fmt.Printf("  -from <time>    Start time. A tag, an RFC3339 time, now or an\n")
+	fmt.Printf("                  offset from now such as -15m. A tag or a time\n")
+	fmt.Printf("                  can be followed by an offset, for example\n")
+	fmt.Printf("                  START_TEST+30s\n")
+	fmt.Printf("  -to <time>      End time, same format as -from\n")
+	fmt.Printf("  -last <duration> Use the period from <duration> ago, for\n")
+	fmt.Printf("                  example 1h. Same as -from -1h\n")
+	fmt.Printf("  -run <name>     Use start and end time of run <name>. Only\n")
+	fmt.Printf("                  processes alive during the run are used\n")
+}
+
+func printToleranceFlags() {
+	fmt.Printf("  -threshold <percent> Fail (return code 1) if the peak, average\n")
+	fmt.Printf("                  or growth of head is more than <percent> above\n")
+	fmt.Printf("                  base. Growth is in percent of the base peak\n")
+	fmt.Printf("  -peak <percent> As -threshold but only for the peak\n")
+	fmt.Printf("  -avg <percent>  As -threshold but only for the average\n")
+	fmt.Printf("  -growth <percent> As -threshold but only for the growth\n")
 }
 
 func invalidUsage(why string) {
-	fmt.Fprintf(os.Stderr, why)
+	fmt.Fprint(os.Stderr, why)
 	fmt.Fprintf(os.Stderr, "\n\n")
 	printUsage()
 	os.Exit(1)
 }
 
 func invalidUsageCommand(why string, command string) {
-	fmt.Fprintf(os.Stderr, why)
+	fmt.Fprint(os.Stderr, why)
 	fmt.Fprintf(os.Stderr, "\n\n")
 	printUsageCommand(command)
 	os.Exit(1)
 }
 
+// cmdRun parses the arguments of the run command
+func cmdRun(args []string) error {
+	if len(args) < 1 {
+		invalidUsageCommand("run needs a sub command!", "run")
+	}
+	switch args[0] {
+	case "start":
+		var labels labelFlags
+		runFlags := flag.NewFlagSet("run start", flag.ExitOnError)
+		runFlags.Var(&labels, "label", "Label")
+		runFlags.Usage = func() { printUsageCommand("run") }
+
+		// Allow flags both before and after the run name
+		var names []string
+		for rest := args[1:]; len(rest) > 0; rest = runFlags.Args()[1:] {
+			runFlags.Parse(rest)
+			if runFlags.NArg() == 0 {
+				break
+			}
+			names = append(names, runFlags.Arg(0))
+		}
+		if len(names) != 1 {
+			invalidUsageCommand("run start takes the run name as argument!", "run")
+		}
+		return CmdRunStart(names[0], labels)
+	case "stop", "info":
+		if len(args) != 2 {
+			invalidUsageCommand(fmt.Sprintf("run %s takes the run name as argument!", args[0]), "run")
+		}
+		if args[0] == "stop" {
+			return CmdRunStop(args[1])
+		}
+		return CmdRunInfo(args[1])
+	case "list":
+		return CmdRunList()
+	}
+	invalidUsageCommand(fmt.Sprintf("Invalid run sub command '%s'!", args[0]), "run")
+	return nil
+}
+
+// cmdCompare parses the arguments of the compare command
+func cmdCompare(args []string) error {
+	compareFlags := flag.NewFlagSet("compare", flag.ExitOnError)
+	base := compareFlags.String("base", "", "Base run")
+	head := compareFlags.String("head", "", "Head run")
+	compareFlags.StringVar(&Matcher, "m", Matcher, "Matcher")
+	tolerance := toleranceFlags(compareFlags)
+	output := compareFlags.String("o", "", "Report file")
+	compareFlags.Usage = func() { printUsageCommand("compare") }
+	compareFlags.Parse(args)
+	if compareFlags.NArg() != 0 {
+		invalidUsageCommand(fmt.Sprintf("compare takes no argument but %d given!", compareFlags.NArg()), "compare")
+	}
+	if *base == "" || *head == "" {
+		invalidUsageCommand("compare needs both -base and -head!", "compare")
+	}
+	return CmdCompare(*base, *head, *tolerance, *output)
+}
+
+// cmdSnapshot parses the arguments of the snapshot command
+func cmdSnapshot(args []string) error {
+	if len(args) < 1 || (args[0] != "save" && args[0] != "diff") {
+		invalidUsageCommand("snapshot needs the sub command save or diff!", "snapshot")
+	}
+	snapshotFlags := flag.NewFlagSet("snapshot "+args[0], flag.ExitOnError)
+	snapshotFlags.StringVar(&Matcher, "m", Matcher, "Matcher")
+	snapshotFlags.StringVar(&FromTag, "from", FromTag, "From tag")
+	snapshotFlags.StringVar(&ToTag, "to", ToTag, "To tag")
+	snapshotFlags.StringVar(&Run, "run", Run, "Run")
+	var tolerance *client.Tolerance
+	if args[0] == "save" {
+		snapshotFlags.StringVar(&UIDs, "u", UIDs, "UID(s)")
+	} else {
+		tolerance = toleranceFlags(snapshotFlags)
+	}
+	snapshotFlags.Usage = func() { printUsageCommand("snapshot") }
+
+	// Allow flags both before and after the file name
+	var files []string
+	for rest := args[1:]; len(rest) > 0; rest = snapshotFlags.Args()[1:] {
+		snapshotFlags.Parse(rest)
+		if snapshotFlags.NArg() == 0 {
+			break
+		}
+		files = append(files, snapshotFlags.Arg(0))
+	}
+	if len(files) != 1 {
+		invalidUsageCommand(fmt.Sprintf("snapshot %s takes the file name as argument!", args[0]), "snapshot")
+	}
+	if Run != "" && (FromTag != "" || ToTag != "") {
+		invalidUsageCommand("-run cannot be combined with -from or -to!", "snapshot")
+	}
+	if args[0] == "save" {
+		return CmdSnapshotSave(files[0])
+	}
+	return CmdSnapshotDiff(files[0], *tolerance)
+}
+
+// toleranceFlags adds the tolerance flags to flags
+func toleranceFlags(flags *flag.FlagSet) *client.Tolerance {
+	tolerance := client.NoTolerance
+	flags.Var(allTolerances{&tolerance}, "threshold", "All tolerances")
+	flags.Float64Var(&tolerance.Peak, "peak", -1, "Peak tolerance")
+	flags.Float64Var(&tolerance.Avg, "avg", -1, "Average tolerance")
+	flags.Float64Var(&tolerance.Growth, "growth", -1, "Growth tolerance")
+	return &tolerance
+}
+
+// allTolerances sets all tolerances with one flag
+type allTolerances struct {
+	*client.Tolerance
+}
+
+func (a allTolerances) Set(s string) error {
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	a.Peak, a.Avg, a.Growth = value, value, value
+	return nil
+}
+
+func (a allTolerances) String() string {
+	return ""
+}
+
+// cmdExec parses the arguments of the exec command. Returns the exit code
+// of the command.
+func cmdExec(args []string) (int, error) {
+	execFlags := flag.NewFlagSet("exec", flag.ExitOnError)
+	limit := execFlags.Int64("limit", -1, "Limit")
+	plotFile := execFlags.String("plot", "", "Plot file")
+	tag := execFlags.String("tag", "", "Tag prefix")
+	standalone := execFlags.Bool("standalone", false, "Without server")
+	interval := execFlags.Int("interval", int(DefaultStandaloneInterval/time.Millisecond), "Interval (ms)")
+	snapshotFile := execFlags.String("snapshot", "", "Snapshot file")
+	execFlags.Usage = func() { printUsageCommand("exec") }
+	execFlags.Parse(args)
+	if execFlags.NArg() == 0 {
+		invalidUsageCommand("exec needs a command!", "exec")
+	}
+	if !*standalone {
+		return CmdExec(execFlags.Args(), *limit, *plotFile, *tag)
+	}
+	if *plotFile != "" || *tag != "" {
+		invalidUsageCommand("-plot and -tag cannot be combined with -standalone!", "exec")
+	}
+	if FailOnOOM {
+		invalidUsageCommand("-fail-on-oom cannot be combined with -standalone!", "exec")
+	}
+	if *interval < 1 {
+		invalidUsageCommand(fmt.Sprintf("-interval must be at least 1, got %d!", *interval), "exec")
+	}
+	return CmdExecStandalone(execFlags.Args(), *limit, *snapshotFile, time.Duration(*interval)*time.Millisecond)
+}
+
+// cmdMinMax parses the arguments of the maxmem and minmem commands
+func cmdMinMax(command string, args []string) error {
+	minMaxFlags := flag.NewFlagSet(command, flag.ExitOnError)
+	cgroup := minMaxFlags.String("cgroup", "", "Cgroup")
+	minMaxFlags.Usage = func() { printUsageCommand(command) }
+	minMaxFlags.Parse(args)
+	if minMaxFlags.NArg() != 0 {
+		invalidUsageCommand(fmt.Sprintf("%s takes no argument but %d given!", command, minMaxFlags.NArg()), command)
+	}
+	var err error
+	switch {
+	case *cgroup != "":
+		err = CmdCgroupMinMax(*cgroup, command == "maxmem")
+	case command == "maxmem":
+		err = CmdMax()
+	default:
+		err = CmdMin()
+	}
+	if err != nil || !FailOnOOM {
+		return err
+	}
+	f, err := getFilter()
+	if err != nil {
+		return err
+	}
+	if *cgroup != "" {
+		f.Match, f.UIDs = []string{monitor.CgroupPrefix + *cgroup}, nil
+	}
+	return CmdCheckOOM(f)
+}
+
+// cmdPlot parses the arguments of the plot command
+func cmdPlot(args []string) error {
+	plotFlags := flag.NewFlagSet("plot", flag.ExitOnError)
+	metric := plotFlags.String("metric", monitor.MetricMemory, "Metric")
+	plotFlags.Usage = func() { printUsageCommand("plot") }
+	plotFlags.Parse(args)
+	if plotFlags.NArg() != 1 {
+		invalidUsageCommand(fmt.Sprintf("plot takes 1 argument but %d given!", plotFlags.NArg()), "plot")
+	}
+	if err := monitor.CheckMetric(*metric); err != nil {
+		invalidUsageCommand(err.Error()+"!", "plot")
+	}
+	return CmdPlot(plotFlags.Arg(0), *metric)
+}
+
+// cmdStats parses the arguments of the stats command
+func cmdStats(args []string) error {
+	statsFlags := flag.NewFlagSet("stats", flag.ExitOnError)
+	var limits StatsLimits
+	statsFlags.Int64Var(&limits.Mean, "mean", -1, "Mean limit")
+	statsFlags.Int64Var(&limits.Median, "median", -1, "Median limit")
+	statsFlags.Int64Var(&limits.P90, "p90", -1, "90th percentile limit")
+	statsFlags.Int64Var(&limits.P95, "p95", -1, "95th percentile limit")
+	statsFlags.Int64Var(&limits.P99, "p99", -1, "99th percentile limit")
+	statsFlags.Usage = func() { printUsageCommand("stats") }
+	statsFlags.Parse(args)
+	if statsFlags.NArg() != 0 {
+		invalidUsageCommand(fmt.Sprintf("stats takes no argument but %d given!", statsFlags.NArg()), "stats")
+	}
+	return CmdStats(limits)
+}
+
+// cmdIO parses the arguments of the io command
+func cmdIO(args []string) error {
+	ioFlags := flag.NewFlagSet("io", flag.ExitOnError)
+	metric := ioFlags.String("metric", monitor.MetricWriteBytes, "Metric")
+	ioFlags.Usage = func() { printUsageCommand("io") }
+	ioFlags.Parse(args)
+	if ioFlags.NArg() != 0 {
+		invalidUsageCommand(fmt.Sprintf("io takes no argument but %d given!", ioFlags.NArg()), "io")
+	}
+	switch *metric {
+	case monitor.MetricReadBytes, monitor.MetricWriteBytes, monitor.MetricDiskReadBytes,
+		monitor.MetricDiskWriteBytes, monitor.MetricReadOps, monitor.MetricWriteOps:
+	default:
+		invalidUsageCommand(fmt.Sprintf("Invalid I/O metric %s!", *metric), "io")
+	}
+	return CmdIO(*metric)
+}
+
+// cmdLeakCheck parses the arguments of the leakcheck command
+func cmdLeakCheck(args []string) error {
+	leakFlags := flag.NewFlagSet("leakcheck", flag.ExitOnError)
+	metric := leakFlags.String("metric", monitor.MetricMemory, "Metric")
+	leakFlags.Usage = func() { printUsageCommand("leakcheck") }
+	leakFlags.Parse(args)
+	if leakFlags.NArg() != 0 {
+		invalidUsageCommand(fmt.Sprintf("leakcheck takes no argument but %d given!", leakFlags.NArg()), "leakcheck")
+	}
+	switch *metric {
+	case monitor.MetricMemory, monitor.MetricFDs, monitor.MetricThreads:
+	default:
+		invalidUsageCommand(fmt.Sprintf("Invalid metric %s. Shall be memory, fds or threads!", *metric), "leakcheck")
+	}
+	return CmdLeakCheck(*metric)
+}
+
+// cmdWatch parses the arguments of the watch command
+func cmdWatch(args []string) error {
+	if len(args) > 0 && args[0] == "list" {
+		if len(args) != 1 {
+			invalidUsageCommand("watch list takes no argument!", "watch")
+		}
+		return CmdWatchList()
+	}
+	if len(args) > 0 && args[0] == "stop" {
+		if len(args) != 2 {
+			invalidUsageCommand("watch stop takes the watch ID as argument!", "watch")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			invalidUsageCommand(fmt.Sprintf("Invalid watch ID %s!", args[1]), "watch")
+		}
+		return CmdWatchStop(id)
+	}
+	watchFlags := flag.NewFlagSet("watch", flag.ExitOnError)
+	watchFlags.StringVar(&Matcher, "m", Matcher, "Matcher")
+	watchFlags.StringVar(&UIDs, "u", UIDs, "UID(s)")
+	interval := watchFlags.Duration("interval", 100*time.Millisecond, "Interval")
+	duration := watchFlags.Duration("duration", 10*time.Minute, "Duration")
+	watchFlags.Usage = func() { printUsageCommand("watch") }
+	watchFlags.Parse(args)
+	if watchFlags.NArg() != 0 {
+		invalidUsageCommand(fmt.Sprintf("watch takes no argument but %d given!", watchFlags.NArg()), "watch")
+	}
+	if Matcher == "" && UIDs == "" {
+		invalidUsageCommand("watch needs -m or -u!", "watch")
+	}
+	return CmdWatchStart(*interval, *duration)
+}
+
+// labelFlags collects -label <key>=<value> flags
+type labelFlags map[string]string
+
+func (l *labelFlags) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("label %s shall be on the format <key>=<value>", s)
+	}
+	if *l == nil {
+		*l = make(labelFlags)
+	}
+	(*l)[parts[0]] = parts[1]
+	return nil
+}
+
+func (l *labelFlags) String() string {
+	return fmt.Sprint(map[string]string(*l))
+}
+
 func main() {
 	var version = flag.Bool("v", false, "Display version")
 	flag.StringVar(&PLMUrl, "a", "http://localhost:12124", "PLM server address")
 	flag.StringVar(&Matcher, "m", "", "Matcher(s)")
 	flag.StringVar(&UIDs, "u", "", "UID(s)")
-	flag.StringVar(&FromTag, "from", "", "UID(s)")
-	flag.StringVar(&ToTag, "to", "", "UID(s)")
+	flag.StringVar(&FromTag, "from", "", "From time")
+	flag.StringVar(&ToTag, "to", "", "To time")
+	flag.DurationVar(&Last, "last", 0, "Last duration")
+	flag.StringVar(&Run, "run", "", "Run")
 	flag.Int64Var(&FailLimit, "f", -1, "Fail limit")
+	flag.StringVar(&Host, "host", "", "Aggregator host(s)")
+	flag.BoolVar(&FailOnOOM, "fail-on-oom", false, "Fail if OOM killed")
+	flag.StringVar(&Token, "token", os.Getenv("PLM_TOKEN"), "Token")
+	var caCert = flag.String("cacert", os.Getenv("PLM_CACERT"), "CA certificate")
+	var insecure = flag.Bool("insecure", false, "Don't verify server certificate")
 	flag.Usage = printUsage
 	flag.Parse()
 
+	plm = client.New(PLMUrl)
+	plm.Token = Token
+	if err := plm.SetTLS(*caCert, *insecure); err != nil {
+		fmt.Fprint(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	if *version {
 		err := CmdVersion()
 		if err != nil {
@@ -152,8 +705,24 @@ func main() {
 		invalidUsage("You need to provide a command!")
 	}
 
+	if Run != "" && (FromTag != "" || ToTag != "") {
+		invalidUsage("-run cannot be combined with -from or -to!")
+	}
+
+	if Last != 0 {
+		if Last < 0 || FromTag != "" || ToTag != "" || Run != "" {
+			invalidUsage("-last shall be positive and cannot be combined with -from, -to or -run!")
+		}
+		FromTag = "-" + Last.String()
+	}
+
+	if FailOnOOM && Host != "" {
+		invalidUsage("-fail-on-oom cannot be combined with -host!")
+	}
+
 	command := flag.Arg(0)
 	var err error
+	exitCode := 0 // Of the exec command
 	switch command {
 	case "help":
 		if flag.NArg() != 2 {
@@ -161,25 +730,30 @@ func main() {
 		}
 		printUsageCommand(flag.Arg(1))
 	case "plot":
-		if flag.NArg() != 2 {
-			invalidUsageCommand(fmt.Sprintf("plot takes 1 argument but %d given!", flag.NArg()-1), command)
-		}
-		err = CmdPlot(flag.Arg(1))
+		err = cmdPlot(flag.Args()[1:])
 	case "info":
 		if flag.NArg() != 1 {
 			invalidUsageCommand(fmt.Sprintf("info takes no argument but %d given!", flag.NArg()-1), command)
 		}
 		err = CmdInfo()
-	case "maxmem":
+	case "maxmem", "minmem":
+		err = cmdMinMax(command, flag.Args()[1:])
+	case "maxfds":
 		if flag.NArg() != 1 {
-			invalidUsageCommand(fmt.Sprintf("maxmem takes no argument but %d given!", flag.NArg()-1), command)
+			invalidUsageCommand(fmt.Sprintf("maxfds takes no argument but %d given!", flag.NArg()-1), command)
 		}
-		err = CmdMax()
-	case "minmem":
-		if flag.NArg() != 1 {
-			invalidUsageCommand(fmt.Sprintf("minmem takes no argument but %d given!", flag.NArg()-1), command)
+		err = CmdMaxFDs()
+	case "leakcheck":
+		err = cmdLeakCheck(flag.Args()[1:])
+	case "io":
+		err = cmdIO(flag.Args()[1:])
+	case "stats":
+		err = cmdStats(flag.Args()[1:])
+	case "cgroups":
+		if flag.NArg() > 2 {
+			invalidUsageCommand(fmt.Sprintf("cgroups takes at most 1 argument but %d given!", flag.NArg()-1), command)
 		}
-		err = CmdMin()
+		err = CmdCgroups(flag.Arg(1))
 	case "tagget":
 		if flag.NArg() != 2 {
 			invalidUsageCommand(fmt.Sprintf("tagget takes 1 argument but %d given!", flag.NArg()-1), command)
@@ -195,14 +769,28 @@ func main() {
 			invalidUsageCommand(fmt.Sprintf("tags takes no argument but %d given!", flag.NArg()-1), command)
 		}
 		err = CmdTags()
+	case "config":
+		err = CmdConfig(flag.Args()[1:])
+	case "run":
+		err = cmdRun(flag.Args()[1:])
+	case "compare":
+		err = cmdCompare(flag.Args()[1:])
+	case "snapshot":
+		err = cmdSnapshot(flag.Args()[1:])
+	case "exec":
+		exitCode, err = cmdExec(flag.Args()[1:])
+	case "watch":
+		err = cmdWatch(flag.Args()[1:])
 	default:
 		invalidUsage(fmt.Sprintf("Invalid command '%s'!", command))
 	}
 
 	if err != nil {
 		fmt.Fprint(os.Stderr, err)
-		os.Exit(1)
+		if exitCode == 0 {
+			exitCode = 1
+		}
 	}
 
-	os.Exit(0)
+	os.Exit(exitCode)
 }
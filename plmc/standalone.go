@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/midstar/plm/client"
+	"github.com/midstar/plm/monitor"
+)
+
+// StandaloneLogSize is the highest number of measurements of a command
+// measured without a PLM server. The oldest measurements are dropped if
+// the command runs longer than StandaloneLogSize times the interval.
+const StandaloneLogSize = 100000
+
+// DefaultStandaloneInterval is the default time between the measurements
+// of a command measured without a PLM server
+const DefaultStandaloneInterval = 100 * time.Millisecond
+
+// CmdExecStandalone starts a command and measures its memory, including
+// the memory of its descendants, without a PLM server. plmc measures the
+// processes itself every interval until the command exits. A snapshot of
+// the measurements (see CmdSnapshotDiff) is written to snapshotFile (a file
+// in the temporary directory if empty), since there is no server to plot
+// them.
+//
+// Returns the exit code of the command. An error is returned if the total
+// memory was above limit (not checked if negative).
+func CmdExecStandalone(args []string, limit int64, snapshotFile string, interval time.Duration) (int, error) {
+	if snapshotFile == "" {
+		snapshotFile = filepath.Join(os.TempDir(), "EXEC_"+time.Now().Format("20060102_150405")+".json")
+	}
+	// Only the fast log is used. Dead processes are never removed, since
+	// RemoveOldProcesses is not called.
+	m := monitor.CreateMeasurement(StandaloneLogSize, 1, int(interval/time.Millisecond), 1, monitor.SystemProci{})
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Start()
+	if err != nil {
+		return 0, err
+	}
+	pid := cmd.Process.Pid
+
+	// Interrupts are also received by the command. Wait for it to exit.
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	started := time.Now()
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	for running := true; running; {
+		m.MeasureAndLog(false)
+		select {
+		case err = <-exited:
+			running = false
+		case <-time.After(interval):
+		}
+	}
+	duration := time.Since(started)
+	exitCode := 0
+	if exitErr, isExitErr := err.(*exec.ExitError); isExitErr {
+		exitCode = getExitCode(exitErr.ProcessState)
+	} else if err != nil {
+		return 0, err
+	}
+
+	result := getStandaloneSnapshot(m, uint32(pid))
+	printExit(pid, getExit(cmd.ProcessState), exitCode, duration)
+	if len(result.Series.Memory) == 0 {
+		fmt.Printf("No measurements. The command exited before it was measured\n")
+		return exitCode, nil
+	}
+	printExecMemory(result)
+
+	js, err := json.Marshal(result)
+	if err != nil {
+		return exitCode, err
+	}
+	if err = ioutil.WriteFile(snapshotFile, js, 0644); err != nil {
+		return exitCode, err
+	}
+	fmt.Printf("Snapshot:         %s\n", snapshotFile)
+	return exitCode, checkLimit(result.Series.Peak, limit)
+}
+
+// getStandaloneSnapshot returns a snapshot of the process with the
+// provided PID and its descendants, in the same format as the snapshots of
+// the PLM server
+func getStandaloneSnapshot(m *monitor.Measurement, pid uint32) *client.Snapshot {
+	host, _ := os.Hostname()
+	snapshot := &client.Snapshot{FormatVersion: 1, PLMVersion: applicationVersion, Host: host,
+		Created: time.Now(), Processes: make([]client.RunProcess, 0)}
+
+	m.Mutex.Lock()
+	var root *monitor.Process
+	for _, process := range m.PM.All {
+		if process.Pid == pid && (root == nil || process.Created.After(root.Created)) {
+			root = process
+		}
+	}
+	var uids []int
+	if root != nil {
+		uids = m.PM.GetDescendants([]int{root.UID})
+	}
+	processes := make(map[int]monitor.Process)
+	for _, uid := range uids {
+		processes[uid] = *m.PM.All[uid]
+	}
+	m.Mutex.Unlock()
+	if len(uids) == 0 {
+		return snapshot
+	}
+
+	measurements := m.GetProcessMeasurements(uids)
+	if len(measurements.Times) == 0 {
+		return snapshot
+	}
+	snapshot.From = measurements.Times[0]
+	snapshot.To = measurements.Times[len(measurements.Times)-1]
+	series := &snapshot.Series
+	series.Offsets = make([]float64, len(measurements.Times))
+	series.Memory = make([]uint32, len(measurements.Times))
+	for i, t := range measurements.Times {
+		series.Offsets[i] = t.Sub(snapshot.From).Seconds()
+		for _, memory := range measurements.Memory {
+			series.Memory[i] += memory[i]
+		}
+	}
+	var sum uint64
+	for _, memory := range series.Memory {
+		if memory > series.Peak {
+			series.Peak = memory
+		}
+		sum += uint64(memory)
+	}
+	series.Avg = uint32(sum / uint64(len(series.Memory)))
+	series.Growth = int64(series.Memory[len(series.Memory)-1]) - int64(series.Memory[0])
+
+	for uid, values := range measurements.Memory {
+		process := processes[uid]
+		p := client.RunProcess{UID: uid, Pid: process.Pid, Path: process.Path, Name: process.Name,
+			CommandLine: process.CommandLine, User: process.User}
+		var sum, n uint64
+		for _, value := range values {
+			if value == 0 {
+				continue // Not alive
+			}
+			if value > p.MaxMemory {
+				p.MaxMemory = value
+			}
+			if p.MinMemory == 0 || value < p.MinMemory {
+				p.MinMemory = value
+			}
+			sum += uint64(value)
+			n++
+		}
+		if n > 0 {
+			p.AvgMemory = uint32(sum / n)
+		}
+		snapshot.Processes = append(snapshot.Processes, p)
+	}
+	sort.Slice(snapshot.Processes, func(i, j int) bool {
+		return snapshot.Processes[i].MaxMemory > snapshot.Processes[j].MaxMemory
+	})
+	return snapshot
+}
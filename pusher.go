@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/midstar/plm/monitor"
+)
+
+// PushBufferFile is the file, in the PLM base path, where batches are
+// stored while the collector cannot be reached
+const PushBufferFile = "plm.push"
+
+// PushChunkSize is the maximum number of batches sent in one request
+const PushChunkSize = 100
+
+// PushBatch is the data of one measurement pushed from an agent to a
+// collector
+type PushBatch struct {
+	Host      string            // Name of the agent host
+	Version   string            // PLM version of the agent
+	Session   time.Time         // When the agent started. UIDs are only unique within a session
+	Sequence  uint64            // Increased by one for each batch within a session
+	Processes []monitor.Process // Processes that are new or have died since the previous batch
+	TotalPhys uint32            // Total memory installed (KB)
+	Row       monitor.LogRow    // The measurement
+	Slow      bool              // The row was also added to the slow log
+}
+
+// Pusher pushes all measurements to a collector. Batches that cannot be
+// delivered are stored in a buffer file and are sent when the collector
+// can be reached again.
+type Pusher struct {
+	url        string // Push URL of the collector
+	token      string
+	host       string
+	session    time.Time
+	sequence   uint64
+	sent       map[int]bool // Alive state of the processes sent, keyed on UID
+	bufferFile string
+	bufferSize int // Maximum number of batches in bufferFile
+	client     *http.Client
+	pending    []*PushBatch // Use mutex for read/write
+	mutex      sync.Mutex
+	sendMutex  sync.Mutex // Held while sending
+	wake       chan bool
+	halt       chan bool
+	wasFailing bool
+	resendAll  bool // Resend all processes in next batch. Use mutex for read/write
+	buffered   int  // Number of batches in bufferFile, -1 if unknown
+}
+
+// CreatePusher creates a pusher to the collector with base URL
+// collectorURL. hostName is the name of this host at the collector (empty
+// means the computer name). The collector is accessed using token (if not
+// empty). Batches are buffered in bufferFile, which holds at most
+// bufferSize batches.
+func CreatePusher(collectorURL string, token string, hostName string, bufferFile string, bufferSize int) *Pusher {
+	if hostName == "" {
+		hostName, _ = os.Hostname()
+	}
+	return &Pusher{
+		url:        strings.TrimRight(collectorURL, "/") + APIv1Prefix + "push",
+		token:      token,
+		host:       hostName,
+		session:    time.Now(),
+		sent:       make(map[int]bool),
+		bufferFile: bufferFile,
+		bufferSize: bufferSize,
+		buffered:   -1,
+		client:     &http.Client{Timeout: AgentTimeout},
+		wake:       make(chan bool, 1),
+		halt:       make(chan bool)}
+}
+
+// Collect creates a batch of a measurement. Supposed to be used as the
+// Measurement.OnRow function, i.e. it is called with the measurement mutex
+// locked.
+func (p *Pusher) Collect(pm *monitor.ProcessMap, row *monitor.LogRow, addedToSlowLog bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.resendAll {
+		p.sent = make(map[int]bool)
+		p.resendAll = false
+	}
+	p.sequence++
+	batch := &PushBatch{
+		Host:      p.host,
+		Version:   applicationVersion,
+		Session:   p.session,
+		Sequence:  p.sequence,
+		Processes: make([]monitor.Process, 0),
+		TotalPhys: pm.Phys.TotalPhys,
+		Row:       *row,
+		Slow:      addedToSlowLog}
+	for uid, process := range pm.All {
+		if alive, isSent := p.sent[uid]; !isSent || alive != process.IsAlive {
+			batch.Processes = append(batch.Processes, *process)
+			p.sent[uid] = process.IsAlive
+		}
+	}
+	for uid := range p.sent {
+		if _, hasElement := pm.All[uid]; !hasElement {
+			delete(p.sent, uid)
+		}
+	}
+	p.pending = append(p.pending, batch)
+	select {
+	case p.wake <- true:
+	default: // Already woken
+	}
+}
+
+// Start starts sending the collected batches as a separate goroutine.
+//
+// Stop it with Stop.
+func (p *Pusher) Start() {
+	go p.sendLoop()
+}
+
+// Stop stops sending. Batches that have not been sent are stored in the
+// buffer file.
+func (p *Pusher) Stop() {
+	p.halt <- true
+}
+
+func (p *Pusher) sendLoop() {
+	for {
+		select {
+		case <-p.halt:
+			p.sendMutex.Lock()
+			p.bufferPending()
+			p.sendMutex.Unlock()
+			return
+		case <-p.wake:
+			p.Flush()
+		}
+	}
+}
+
+// Flush sends the buffered and collected batches. Batches that cannot be
+// sent are stored in the buffer file.
+func (p *Pusher) Flush() {
+	p.sendMutex.Lock()
+	defer p.sendMutex.Unlock()
+	err := p.replayBuffer()
+	if err == nil {
+		p.mutex.Lock()
+		batches := p.pending
+		p.pending = nil
+		p.mutex.Unlock()
+		for len(batches) > 0 && err == nil {
+			n := len(batches)
+			if n > PushChunkSize {
+				n = PushChunkSize
+			}
+			err = p.send(batches[:n])
+			if err == nil {
+				batches = batches[n:]
+			}
+		}
+		if err != nil {
+			p.mutex.Lock()
+			p.pending = append(batches, p.pending...)
+			p.mutex.Unlock()
+		}
+	}
+	if err != nil {
+		if !p.wasFailing {
+			log.Printf("Unable to push to collector. Buffering in %s. Reason: %s", p.bufferFile, err)
+			p.wasFailing = true
+		}
+		p.bufferPending()
+		return
+	}
+	if p.wasFailing {
+		log.Printf("Pushing to collector again")
+		p.wasFailing = false
+	}
+}
+
+// send sends batches to the collector
+func (p *Pusher) send(batches []*PushBatch) error {
+	js, err := json.Marshal(batches)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(js))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiError APIError
+		if json.NewDecoder(resp.Body).Decode(&apiError) == nil && apiError.Error.Message != "" {
+			return fmt.Errorf("%s", apiError.Error.Message)
+		}
+		return fmt.Errorf("Unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// readBuffer reads all batches in the buffer file. Returns nil if there is
+// no buffer file.
+func (p *Pusher) readBuffer() ([]*PushBatch, error) {
+	file, err := os.Open(p.bufferFile)
+	if os.IsNotExist(err) {
+		p.buffered = 0
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	batches := make([]*PushBatch, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var batch PushBatch
+		if err := json.Unmarshal(scanner.Bytes(), &batch); err != nil {
+			// Probably a partly written line. Skip it.
+			continue
+		}
+		batches = append(batches, &batch)
+	}
+	p.buffered = len(batches)
+	return batches, scanner.Err()
+}
+
+// writeBuffer replaces the buffer file with batches. The file is removed
+// if there are no batches.
+func (p *Pusher) writeBuffer(batches []*PushBatch) error {
+	p.buffered = len(batches)
+	if len(batches) == 0 {
+		err := os.Remove(p.bufferFile)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	b, err := marshalLines(batches)
+	if err != nil {
+		return err
+	}
+	tmpFile := p.bufferFile + ".tmp"
+	err = ioutil.WriteFile(tmpFile, b, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, p.bufferFile)
+}
+
+// appendBuffer appends batches to the buffer file
+func (p *Pusher) appendBuffer(batches []*PushBatch) error {
+	b, err := marshalLines(batches)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(p.bufferFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(b)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		p.buffered += len(batches)
+	}
+	return err
+}
+
+// marshalLines encodes batches as JSON, one batch per line
+func marshalLines(batches []*PushBatch) ([]byte, error) {
+	var b bytes.Buffer
+	for _, batch := range batches {
+		js, err := json.Marshal(batch)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(js)
+		b.WriteString("\n")
+	}
+	return b.Bytes(), nil
+}
+
+// replayBuffer sends the batches in the buffer file, oldest first
+func (p *Pusher) replayBuffer() error {
+	batches, err := p.readBuffer()
+	if err != nil || batches == nil {
+		return err
+	}
+	for len(batches) > 0 {
+		n := len(batches)
+		if n > PushChunkSize {
+			n = PushChunkSize
+		}
+		err = p.send(batches[:n])
+		if err != nil {
+			return err
+		}
+		batches = batches[n:]
+		if err = p.writeBuffer(batches); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bufferPending moves the pending batches to the buffer file. If the
+// buffer file gets full the oldest batches are dropped, and all processes
+// are sent again in the next batch since their information might have
+// been dropped.
+func (p *Pusher) bufferPending() {
+	p.mutex.Lock()
+	pending := p.pending
+	p.pending = nil
+	p.mutex.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+	if p.buffered >= 0 && p.buffered+len(pending) <= p.bufferSize {
+		if err := p.appendBuffer(pending); err != nil {
+			log.Printf("Unable to write push buffer %s. Reason: %s", p.bufferFile, err)
+		}
+		return
+	}
+	batches, err := p.readBuffer()
+	if err != nil {
+		log.Printf("Unable to read push buffer %s. Reason: %s", p.bufferFile, err)
+	}
+	batches = append(batches, pending...)
+	if len(batches) > p.bufferSize {
+		log.Printf("Push buffer full. Dropping %d measurements", len(batches)-p.bufferSize)
+		batches = batches[len(batches)-p.bufferSize:]
+		p.mutex.Lock()
+		p.resendAll = true
+		p.mutex.Unlock()
+	}
+	if err = p.writeBuffer(batches); err != nil {
+		log.Printf("Unable to write push buffer %s. Reason: %s", p.bufferFile, err)
+	}
+}
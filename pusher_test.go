@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/midstar/plm/monitor"
+	"github.com/midstar/proci"
+)
+
+func TestPusher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plm")
+	if err != nil {
+		t.Fatal("Unable to create temp dir. Reason: ", err)
+	}
+	defer os.RemoveAll(dir)
+	bufferFile := filepath.Join(dir, PushBufferFile)
+
+	m := monitor.CreateMeasurement(10, 10, 3, 6, proci.GenerateMock(4))
+	p := CreatePusher("http://localhost:9097/", "", "agent", bufferFile, 3)
+	m.OnRow = p.Collect
+
+	// Collector is not running. Measurements are buffered.
+	m.MeasureAndLog(false)
+	p.Flush()
+	batches, err := p.readBuffer()
+	assertTrue(t, "Read buffer", err == nil)
+	assertEqualsInt(t, "Buffered", 1, len(batches))
+	assertEqualsInt(t, "Processes in first batch", 4, len(batches[0].Processes))
+
+	// The oldest measurements are dropped when the buffer is full
+	for i := 0; i < 3; i++ {
+		m.MeasureAndLog(false)
+		p.Flush()
+	}
+	batches, _ = p.readBuffer()
+	assertEqualsInt(t, "Buffered", 3, len(batches))
+	assertEqualsInt(t, "Oldest sequence", 2, int(batches[0].Sequence))
+
+	// Start the collector. The buffered measurements are replayed.
+	config := DefaultConfiguration()
+	config.Port = 9097
+	config.AcceptPush = true
+	collector := CreateHTTPServer("", config, monitor.CreateMeasurement(10, 10, 3, 6, proci.GenerateMock(1)))
+	collector.Start()
+	defer collector.Stop()
+	time.Sleep(100 * time.Millisecond) // Allow server to start
+
+	m.MeasureAndLog(true)
+	p.Flush()
+	_, err = os.Stat(bufferFile)
+	assertTrue(t, "Buffer file removed", os.IsNotExist(err))
+	measurements := collector.aggregator.Measurements(url.Values{"host": {"agent"}})
+	assertEqualsInt(t, "Number of errors", 0, len(measurements.Errors))
+	assertEqualsInt(t, "Number of hosts", 1, len(measurements.Hosts))
+	assertEqualsInt(t, "Number of measurements", 4, len(measurements.Hosts[0].Times))
+	processes, _ := collector.aggregator.Processes(url.Values{"host": {"agent"}})
+	assertEqualsInt(t, "Processes resent after drop", 4, len(processes))
+
+	// Push using the send loop
+	p.Start()
+	m.MeasureAndLog(false)
+	time.Sleep(100 * time.Millisecond)
+	p.Stop()
+	measurements = collector.aggregator.Measurements(url.Values{"host": {"agent"}})
+	assertEqualsInt(t, "Number of measurements", 5, len(measurements.Hosts[0].Times))
+}
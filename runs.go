@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/midstar/plm/monitor"
+)
+
+// Run is a named period, such as a test run, with labels. Queries can be
+// restricted to a run using the run query parameter.
+type Run struct {
+	Name         string
+	Labels       map[string]string
+	Start        time.Time
+	End          time.Time // Zero while the run is in progress
+	Running      bool
+	NbrProcesses int          // Number of processes observed during the run
+	MaxPhys      uint32       // Highest total memory used during the run (KB)
+	Processes    []RunProcess `json:",omitempty"` // Sorted on max memory, highest first
+}
+
+// RunProcess is a process observed during a run
+type RunProcess struct {
+	UID         int
+	Pid         uint32
+	Path        string
+	Name        string
+	CommandLine string
+	User        string // User running the process
+	MaxMemory   uint32 // Maximum memory during the run (KB)
+	MinMemory   uint32 // Minimum memory during the run (KB)
+	AvgMemory   uint32 // Average memory during the run (KB)
+}
+
+// isObserved returns true if the process was alive some time between from
+// and to (zero to means now)
+func isObserved(process *monitor.Process, from time.Time, to time.Time) bool {
+	return (to.IsZero() || !process.Created.After(to)) &&
+		(process.IsAlive || !process.Died.Before(from))
+}
+
+// getRun returns a copy of the run with the provided name
+func (s *HTTPServer) getRun(name string) (Run, bool) {
+	s.runsMutex.Lock()
+	defer s.runsMutex.Unlock()
+	run, hasRun := s.runs[name]
+	if !hasRun {
+		return Run{}, false
+	}
+	return *run, true
+}
+
+// startRun starts a new run. Returns an error if a run with the same name
+// exists.
+func (s *HTTPServer) startRun(name string, labels map[string]string) (Run, error) {
+	s.runsMutex.Lock()
+	defer s.runsMutex.Unlock()
+	if _, hasRun := s.runs[name]; hasRun {
+		return Run{}, newHTTPError(http.StatusConflict, ErrorCodeConflict, "Run %s already exists", name)
+	}
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	run := &Run{Name: name, Labels: labels, Start: time.Now(), Running: true}
+	s.runs[name] = run
+	return *run, nil
+}
+
+// stopRun stops a run. The summary of the run, including the processes
+// observed, is stored in the run.
+func (s *HTTPServer) stopRun(name string) (Run, error) {
+	s.runsMutex.Lock()
+	run, hasRun := s.runs[name]
+	if !hasRun {
+		s.runsMutex.Unlock()
+		return Run{}, newHTTPError(http.StatusNotFound, ErrorCodeNotFound, "Run %s not found", name)
+	}
+	if !run.Running {
+		s.runsMutex.Unlock()
+		return Run{}, newHTTPError(http.StatusConflict, ErrorCodeConflict, "Run %s is already stopped", name)
+	}
+	run.End = time.Now()
+	run.Running = false
+	stopped := *run
+	s.runsMutex.Unlock()
+
+	s.summarizeRun(&stopped)
+	s.runsMutex.Lock()
+	*run = stopped
+	s.runsMutex.Unlock()
+	return stopped, nil
+}
+
+// summarizeRun sets the summary fields of the run
+func (s *HTTPServer) summarizeRun(run *Run) {
+	from, to := run.Start, run.End
+	s.measurement.Mutex.Lock()
+	uids := make([]int, 0)
+	for uid, process := range s.measurement.PM.All {
+		if isObserved(process, from, to) {
+			uids = append(uids, uid)
+		}
+	}
+	s.measurement.Mutex.Unlock()
+
+	run.Processes = s.summarizeProcesses(uids, from, to)
+	run.NbrProcesses = len(run.Processes)
+
+	_, memUsed := s.measurement.GetMemUsedBetween(from, to) // Thread safe
+	run.MaxPhys = 0
+	for _, value := range memUsed {
+		if value > run.MaxPhys {
+			run.MaxPhys = value
+		}
+	}
+}
+
+// summarizeProcesses returns the highest, lowest and average memory of the
+// processes between from and to, sorted on max memory (highest first)
+func (s *HTTPServer) summarizeProcesses(uids []int, from time.Time, to time.Time) []RunProcess {
+	measurements := s.measurement.GetProcessMeasurementsBetween(uids, from, to) // Thread safe
+	s.measurement.Mutex.Lock()
+	processes := make(map[int]monitor.Process)
+	for uid := range measurements.Memory {
+		if process, hasElement := s.measurement.PM.All[uid]; hasElement {
+			processes[uid] = *process
+		}
+	}
+	s.measurement.Mutex.Unlock()
+
+	result := make([]RunProcess, 0, len(measurements.Memory))
+	for uid := range measurements.Memory {
+		_, values := measurements.Measured(uid)
+		process := processes[uid]
+		p := RunProcess{UID: uid, Pid: process.Pid, Path: process.Path, Name: process.Name,
+			CommandLine: process.CommandLine, User: process.User}
+		var sum uint64
+		var n uint64
+		for _, value := range values {
+			if value == 0 {
+				continue // Not alive
+			}
+			if value > p.MaxMemory {
+				p.MaxMemory = value
+			}
+			if p.MinMemory == 0 || value < p.MinMemory {
+				p.MinMemory = value
+			}
+			sum += uint64(value)
+			n++
+		}
+		if n > 0 {
+			p.AvgMemory = uint32(sum / n)
+		}
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].MaxMemory == result[j].MaxMemory {
+			return result[i].UID < result[j].UID
+		}
+		return result[i].MaxMemory > result[j].MaxMemory
+	})
+	return result
+}
+
+// getRunWithSummary returns the run with the provided name. The summary is
+// calculated if the run is in progress.
+func (s *HTTPServer) getRunWithSummary(name string) (Run, bool) {
+	run, hasRun := s.getRun(name)
+	if hasRun && run.Running {
+		s.summarizeRun(&run)
+	}
+	return run, hasRun
+}
+
+// getRuns returns all runs sorted on start time
+func (s *HTTPServer) getRuns() []Run {
+	s.runsMutex.Lock()
+	names := make([]string, 0, len(s.runs))
+	for name := range s.runs {
+		names = append(names, name)
+	}
+	s.runsMutex.Unlock()
+	runs := make([]Run, 0, len(names))
+	for _, name := range names {
+		if run, hasRun := s.getRunWithSummary(name); hasRun {
+			runs = append(runs, run)
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Start.Before(runs[j].Start) })
+	return runs
+}
+
+// getRunFromTo returns the period of the run given by the run query
+// parameter. hasRun is false if the parameter is not given.
+func (s *HTTPServer) getRunFromTo(values url.Values) (from time.Time, to time.Time, hasRun bool, err error) {
+	name := values.Get("run")
+	if name == "" {
+		return from, to, false, nil
+	}
+	for _, param := range []string{"from", "to", "fromTag", "toTag"} {
+		if _, hasElement := values[param]; hasElement {
+			return from, to, true, fmt.Errorf("Parameter run cannot be combined with %s", param)
+		}
+	}
+	run, found := s.getRun(name)
+	if !found {
+		return from, to, true, fmt.Errorf("Invalid run: %s", name)
+	}
+	return run.Start, run.End, true, nil
+}
+
+// resolveRun replaces the run query parameter with the from and to query
+// parameters. Used when the query is forwarded to hosts that don't know
+// the run.
+func (s *HTTPServer) resolveRun(values url.Values) (url.Values, error) {
+	from, to, hasRun, err := s.getRunFromTo(values)
+	if err != nil || !hasRun {
+		return values, err
+	}
+	resolved := url.Values{}
+	for key, value := range values {
+		if key != "run" {
+			resolved[key] = value
+		}
+	}
+	resolved.Set("from", from.Format(time.RFC3339Nano))
+	if !to.IsZero() {
+		resolved.Set("to", to.Format(time.RFC3339Nano))
+	}
+	return resolved, nil
+}
+
+// serveAPIRuns handles the runs resources:
+//   - GET runs
+//   - GET runs/{name}
+//   - DELETE runs/{name}
+//   - POST runs/{name}/start (body with optional Labels)
+//   - POST runs/{name}/stop
+func (s *HTTPServer) serveAPIRuns(w http.ResponseWriter, r *http.Request, name string, action string, values url.Values) {
+	switch {
+	case r.Method == http.MethodGet && name == "" && action == "":
+		offset, limit, err := parsePage(values)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+			return
+		}
+		runs := s.getRuns()
+		for i := range runs {
+			runs[i].Processes = nil // Only included when getting a specific run
+		}
+		writeJSON(w, r, http.StatusOK, newPage(len(runs), offset, limit,
+			func(start, end int) interface{} { return runs[start:end] }))
+	case r.Method == http.MethodGet && name != "" && action == "":
+		run, hasRun := s.getRunWithSummary(name)
+		if !hasRun {
+			writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, fmt.Sprintf("Run %s not found", name))
+			return
+		}
+		writeJSON(w, r, http.StatusOK, run)
+	case r.Method == http.MethodDelete && name != "" && action == "":
+		s.runsMutex.Lock()
+		_, hasRun := s.runs[name]
+		delete(s.runs, name)
+		s.runsMutex.Unlock()
+		if !hasRun {
+			writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, fmt.Sprintf("Run %s not found", name))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && name != "" && action == "start":
+		var body struct {
+			Labels map[string]string
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidBody, fmt.Sprintf("Invalid run. Reason: %s", err))
+				return
+			}
+		}
+		run, err := s.startRun(name, body.Labels)
+		if err != nil {
+			e := err.(*httpError)
+			writeError(w, r, e.status, e.code, e.message)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, run)
+	case r.Method == http.MethodPost && name != "" && action == "stop":
+		run, err := s.stopRun(name)
+		if err != nil {
+			e := err.(*httpError)
+			writeError(w, r, e.status, e.code, e.message)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, run)
+	case action != "" && action != "start" && action != "stop":
+		writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, fmt.Sprintf("No such resource %s", r.URL.Path))
+	default:
+		allowed := "GET"
+		if name != "" && action == "" {
+			allowed = "GET, DELETE"
+		} else if action != "" {
+			allowed = "POST"
+		}
+		w.Header().Set("Allow", allowed)
+		writeError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed,
+			fmt.Sprintf("Method %s not allowed on %s", r.Method, r.URL.Path))
+	}
+}
+
+func (s *HTTPServer) serveHTTPRuns(w http.ResponseWriter) {
+	templateFile := filepath.Join(s.basePath, "templates", "runs.gohtml")
+	t, err := template.New("").Funcs(*s.fm).ParseFiles(templateFile)
+	if err != nil {
+		http.Error(w, "Create template: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	type runWithTop struct {
+		Run
+		Duration string
+		Top      []RunProcess // Processes with highest max memory
+		TopUIDs  string       // UIDs of Top, comma separated
+	}
+	type data struct {
+		*version
+		Runs []runWithTop
+	}
+	d := data{version: &s.ver}
+	runs := s.getRuns()
+	for i := len(runs) - 1; i >= 0; i-- { // Newest first
+		top := runs[i].Processes
+		if len(top) > 5 {
+			top = top[:5]
+		}
+		end := runs[i].End
+		if runs[i].Running {
+			end = time.Now()
+		}
+		uids := make([]string, 0, len(top))
+		for _, p := range top {
+			uids = append(uids, strconv.Itoa(p.UID))
+		}
+		d.Runs = append(d.Runs, runWithTop{Run: runs[i], Top: top, TopUIDs: strings.Join(uids, ","),
+			Duration: end.Sub(runs[i].Start).Round(time.Second).String()})
+	}
+	err = t.ExecuteTemplate(w, "runs.gohtml", d)
+	if err != nil {
+		http.Error(w, "Execute template: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/midstar/plm/monitor"
+	"github.com/midstar/proci"
+)
+
+func TestRuns(t *testing.T) {
+	port := 9098
+	baseURL := fmt.Sprintf("http://localhost:%d/api/v1", port)
+	config := DefaultConfiguration()
+	config.Port = port
+	pMock := proci.GenerateMock(10)
+	m := monitor.CreateMeasurement(10, 20, 3, 6, pMock)
+	m.MeasureAndLog(false)
+	delete(pMock.Processes, 4) // Dies before the run
+	m.MeasureAndLog(false)
+	httpServer := CreateHTTPServer("", config, m)
+	httpServer.Start()
+	defer httpServer.Stop()
+	time.Sleep(100 * time.Millisecond) // Allow server to start
+
+	// Start a run with labels
+	var run Run
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "POST", baseURL+"/runs/TEST_1/start",
+		`{"Labels": {"build": "1234"}}`, &run))
+	assertEqualsStr(t, "Name", "TEST_1", run.Name)
+	assertEqualsStr(t, "Label", "1234", run.Labels["build"])
+	assertTrue(t, "Running", run.Running)
+	var apiError APIError
+	assertEqualsInt(t, "Status", http.StatusConflict, apiRequest(t, "POST", baseURL+"/runs/TEST_1/start", "", &apiError))
+	assertEqualsStr(t, "Error code", ErrorCodeConflict, apiError.Error.Code)
+
+	time.Sleep(10 * time.Millisecond) // To make time differ
+	m.MeasureAndLog(false)
+
+	// Summary while running
+	run = Run{}
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/runs/TEST_1", "", &run))
+	assertTrue(t, "Running", run.Running)
+	assertEqualsInt(t, "Processes", 9, run.NbrProcesses)
+
+	// Stop the run
+	run = Run{}
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "POST", baseURL+"/runs/TEST_1/stop", "", &run))
+	assertTrue(t, "Not running", !run.Running)
+	assertTrue(t, "End after start", run.End.After(run.Start))
+	assertEqualsInt(t, "Processes", 9, run.NbrProcesses)
+	assertEqualsInt(t, "Process list", 9, len(run.Processes))
+	assertEqualsInt(t, "Highest memory first", 11, int(run.Processes[0].MaxMemory)) // 1024+1024*10 bytes
+	assertEqualsInt(t, "Avg memory", int(run.Processes[0].MaxMemory), int(run.Processes[0].AvgMemory))
+	assertTrue(t, "Peak memory", run.MaxPhys > 0)
+	for _, p := range run.Processes {
+		assertTrue(t, "Process died before run", p.Pid != 4)
+	}
+	assertEqualsInt(t, "Status", http.StatusConflict, apiRequest(t, "POST", baseURL+"/runs/TEST_1/stop", "", nil))
+	assertEqualsInt(t, "Status", http.StatusNotFound, apiRequest(t, "POST", baseURL+"/runs/NOT_EXISTING/stop", "", nil))
+	assertEqualsInt(t, "Status", http.StatusNotFound, apiRequest(t, "POST", baseURL+"/runs/TEST_1/pause", "", nil))
+	assertEqualsInt(t, "Status", http.StatusMethodNotAllowed, apiRequest(t, "GET", baseURL+"/runs/TEST_1/stop", "", nil))
+
+	// Measurements after the run are not included in the run
+	m.MeasureAndLog(false)
+
+	// Run scoped queries
+	var page struct {
+		Items []monitor.ProcessMinMaxMem
+		Total int
+	}
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/minmaxmem?run=TEST_1", "", &page))
+	assertEqualsInt(t, "Processes during run", 9, page.Total)
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/minmaxmem", "", &page))
+	assertEqualsInt(t, "All processes", 10, page.Total)
+	var measurements Measurements
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/measurements?run=TEST_1", "", &measurements))
+	assertEqualsInt(t, "Measurements during run", 1, len(measurements.Times))
+	apiError = APIError{}
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "GET", baseURL+"/minmaxmem?run=TEST_1&fromTag=X", "", &apiError))
+	assertEqualsStr(t, "Error code", ErrorCodeInvalidParameter, apiError.Error.Code)
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "GET", baseURL+"/minmaxmem?run=NOT_EXISTING", "", nil))
+
+	// List runs
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "POST", baseURL+"/runs/TEST_2/start", "", nil))
+	var runs struct {
+		Items []Run
+		Total int
+	}
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/runs", "", &runs))
+	assertEqualsInt(t, "Total", 2, runs.Total)
+	assertEqualsStr(t, "Oldest first", "TEST_1", runs.Items[0].Name)
+	assertEqualsInt(t, "No process list", 0, len(runs.Items[0].Processes))
+	assertTrue(t, "Running", runs.Items[1].Running)
+
+	// Runs page
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/runs", port))
+	if err != nil {
+		t.Fatal("Unable to get runs page. Reason: ", err)
+	}
+	assertEqualsInt(t, "Status", http.StatusOK, resp.StatusCode)
+	body := respToString(resp.Body)
+	assertTrue(t, "TEST_1 on page", strings.Contains(body, "TEST_1"))
+	assertTrue(t, "Label on page", strings.Contains(body, "build=1234"))
+
+	// Delete
+	assertEqualsInt(t, "Status", http.StatusNoContent, apiRequest(t, "DELETE", baseURL+"/runs/TEST_1", "", nil))
+	assertEqualsInt(t, "Status", http.StatusNotFound, apiRequest(t, "GET", baseURL+"/runs/TEST_1", "", nil))
+	assertEqualsInt(t, "Status", http.StatusNotFound, apiRequest(t, "DELETE", baseURL+"/runs/TEST_1", "", nil))
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// SnapshotFormatVersion is the version of the snapshot file format. It is
+// increased if the format is changed in a way that older PLM versions
+// cannot read.
+const SnapshotFormatVersion = 1
+
+// Snapshot is the memory of a set of processes during a period, such as a
+// baseline run. Snapshots are stored in files (JSON) and can be compared
+// with live data at any PLM instance. The format is described in
+// README.md.
+type Snapshot struct {
+	FormatVersion int          // See SnapshotFormatVersion
+	PLMVersion    string       // PLM version that created the snapshot
+	Host          string       // Host where the snapshot was created
+	Created       time.Time    // When the snapshot was created
+	Match         []string     // Match query parameters used. Empty if all processes
+	From          time.Time    // Start of the period. Zero if the log start
+	To            time.Time    // End of the period. Zero if the log end
+	Series        RunSeries    // Total memory of the processes
+	Processes     []RunProcess // The processes, highest max memory first
+}
+
+// getSnapshot creates a snapshot of the processes and the period given by
+// the query parameters (see getUIDs and getFromTo)
+func (s *HTTPServer) getSnapshot(values url.Values) (*Snapshot, error) {
+	uids, err := s.getUIDs(values)
+	if err != nil {
+		return nil, err
+	}
+	from, to, err := s.getFromTo(values)
+	if err != nil {
+		return nil, err
+	}
+	series, err := s.getSeries(values)
+	if err != nil {
+		return nil, err
+	}
+	series.Run = values.Get("run")
+	snapshot := &Snapshot{
+		FormatVersion: SnapshotFormatVersion,
+		PLMVersion:    applicationVersion,
+		Host:          s.aggregator.Hosts()[0].Name(),
+		Created:       time.Now(),
+		Match:         values["match"],
+		From:          from,
+		To:            to,
+		Series:        series,
+		Processes:     s.summarizeProcesses(uids, from, to)}
+	if snapshot.Match == nil {
+		snapshot.Match = []string{}
+	}
+	return snapshot, nil
+}
+
+// diffSnapshot compares the snapshot (base) with the live data (head) of
+// the period given by the query parameters. The processes are selected
+// with the match query parameters, or the matches of the snapshot if not
+// given.
+func (s *HTTPServer) diffSnapshot(snapshot *Snapshot, values url.Values) (*Comparison, error) {
+	tolerance, err := parseTolerance(values)
+	if err != nil {
+		return nil, err
+	}
+	if _, hasElement := values["uids"]; hasElement {
+		return nil, fmt.Errorf("Parameter uids cannot be used, since UIDs differ between hosts")
+	}
+	if _, hasElement := values["match"]; !hasElement && len(snapshot.Match) > 0 {
+		values["match"] = snapshot.Match
+	}
+	head, err := s.getSeries(values)
+	if err != nil {
+		return nil, err
+	}
+	head.Run = values.Get("run")
+	return compareSeries(snapshot.Series, head, values["match"], tolerance), nil
+}
+
+// checkSnapshot returns an error if the snapshot cannot be used
+func checkSnapshot(snapshot *Snapshot) error {
+	if snapshot.FormatVersion < 1 {
+		return fmt.Errorf("Not a snapshot. FormatVersion missing")
+	}
+	if snapshot.FormatVersion > SnapshotFormatVersion {
+		return fmt.Errorf("Snapshot format version %d not supported (newer than %d). Upgrade PLM",
+			snapshot.FormatVersion, SnapshotFormatVersion)
+	}
+	if len(snapshot.Series.Offsets) != len(snapshot.Series.Memory) {
+		return fmt.Errorf("Invalid snapshot. Series Offsets and Memory differ in length")
+	}
+	return nil
+}
+
+// serveAPISnapshot handles:
+//   - GET snapshot
+//   - POST snapshot/diff (body is the base snapshot)
+func (s *HTTPServer) serveAPISnapshot(w http.ResponseWriter, r *http.Request, action string, values url.Values) {
+	switch {
+	case r.Method == http.MethodGet && action == "":
+		snapshot, err := s.getSnapshot(values)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+			return
+		}
+		writeJSON(w, r, http.StatusOK, snapshot)
+	case r.Method == http.MethodPost && action == "diff":
+		var snapshot Snapshot
+		err := json.NewDecoder(r.Body).Decode(&snapshot)
+		if err == nil {
+			err = checkSnapshot(&snapshot)
+		}
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidBody, fmt.Sprintf("Invalid snapshot. Reason: %s", err))
+			return
+		}
+		c, err := s.diffSnapshot(&snapshot, values)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+			return
+		}
+		writeJSON(w, r, http.StatusOK, c)
+	case action != "" && action != "diff":
+		writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, fmt.Sprintf("No such resource %s", r.URL.Path))
+	default:
+		allowed := "GET"
+		if action != "" {
+			allowed = "POST"
+		}
+		w.Header().Set("Allow", allowed)
+		writeError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed,
+			fmt.Sprintf("Method %s not allowed on %s", r.Method, r.URL.Path))
+	}
+}
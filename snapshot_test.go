@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/midstar/plm/monitor"
+	"github.com/midstar/proci"
+)
+
+func TestSnapshot(t *testing.T) {
+	port := 9101
+	baseURL := fmt.Sprintf("http://localhost:%d/api/v1", port)
+	config := DefaultConfiguration()
+	config.Port = port
+	pMock := proci.GenerateMock(10)
+	m := monitor.CreateMeasurement(20, 40, 3, 6, pMock)
+	httpServer := CreateHTTPServer("", config, m)
+	httpServer.Start()
+	defer httpServer.Stop()
+	time.Sleep(100 * time.Millisecond) // Allow server to start
+
+	measure := func(tagBefore string, tagAfter string, memory []uint64) {
+		httpServer.setTag(tagBefore)
+		for _, value := range memory {
+			time.Sleep(2 * time.Millisecond) // To make time differ
+			pMock.Processes[10].MemoryUsage = value
+			m.MeasureAndLog(false)
+		}
+		time.Sleep(2 * time.Millisecond)
+		httpServer.setTag(tagAfter)
+	}
+	measure("A", "B", []uint64{10 * 1024, 20 * 1024, 30 * 1024})
+	measure("C", "D", []uint64{10 * 1024, 20 * 1024, 33 * 1024})
+
+	// Save
+	var snapshot Snapshot
+	assertEqualsInt(t, "Status", http.StatusOK,
+		apiRequest(t, "GET", baseURL+"/snapshot?match=command_line_10&fromTag=A&toTag=B", "", &snapshot))
+	assertEqualsInt(t, "Format version", SnapshotFormatVersion, snapshot.FormatVersion)
+	assertEqualsInt(t, "Matches", 1, len(snapshot.Match))
+	assertEqualsStr(t, "Match", "command_line_10", snapshot.Match[0])
+	assertEqualsInt(t, "Measurements", 3, len(snapshot.Series.Memory))
+	assertEqualsInt(t, "Offsets", 3, len(snapshot.Series.Offsets))
+	assertEqualsInt(t, "Peak", 30, int(snapshot.Series.Peak))
+	assertEqualsInt(t, "Growth", 20, int(snapshot.Series.Growth))
+	assertEqualsInt(t, "Processes", 1, len(snapshot.Processes))
+	assertEqualsStr(t, "Path", "path_10", snapshot.Processes[0].Path)
+	assertEqualsInt(t, "Max memory", 30, int(snapshot.Processes[0].MaxMemory))
+	assertTrue(t, "Host", snapshot.Host != "")
+	js, _ := json.Marshal(snapshot)
+
+	// Diff with live data (processes given by the snapshot)
+	var c Comparison
+	assertEqualsInt(t, "Status", http.StatusOK,
+		apiRequest(t, "POST", baseURL+"/snapshot/diff?fromTag=C&toTag=D&peakTolerance=5", string(js), &c))
+	assertEqualsInt(t, "Base peak", 30, int(c.Peak.Base))
+	assertEqualsInt(t, "Head peak", 33, int(c.Peak.Head))
+	assertEqualsInt(t, "Peak percent", 10, int(c.Peak.Percent))
+	assertTrue(t, "Peak exceeded", c.Peak.Exceeded)
+	assertTrue(t, "Avg not checked", !c.Avg.Exceeded)
+	assertTrue(t, "Regression", c.Regression)
+
+	c = Comparison{}
+	assertEqualsInt(t, "Status", http.StatusOK,
+		apiRequest(t, "POST", baseURL+"/snapshot/diff?fromTag=C&toTag=D&threshold=20", string(js), &c))
+	assertTrue(t, "No regression", !c.Regression)
+
+	// Diff with other processes
+	c = Comparison{}
+	assertEqualsInt(t, "Status", http.StatusOK,
+		apiRequest(t, "POST", baseURL+"/snapshot/diff?fromTag=C&toTag=D&match=command_line_1", string(js), &c))
+	assertTrue(t, "More processes", c.Peak.Head > 33)
+
+	// Errors
+	var apiError APIError
+	assertEqualsInt(t, "Status", http.StatusBadRequest,
+		apiRequest(t, "POST", baseURL+"/snapshot/diff?fromTag=C&toTag=D", `{"FormatVersion": 99}`, &apiError))
+	assertEqualsStr(t, "Error code", ErrorCodeInvalidBody, apiError.Error.Code)
+	assertEqualsInt(t, "Status", http.StatusBadRequest,
+		apiRequest(t, "POST", baseURL+"/snapshot/diff?fromTag=C&toTag=D", `{}`, nil))
+	apiError = APIError{}
+	assertEqualsInt(t, "Status", http.StatusBadRequest,
+		apiRequest(t, "POST", baseURL+"/snapshot/diff?uids=10", string(js), &apiError))
+	assertEqualsStr(t, "Error code", ErrorCodeInvalidParameter, apiError.Error.Code)
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "GET", baseURL+"/snapshot?fromTag=X", "", nil))
+	assertEqualsInt(t, "Status", http.StatusMethodNotAllowed, apiRequest(t, "GET", baseURL+"/snapshot/diff", "", nil))
+	assertEqualsInt(t, "Status", http.StatusNotFound, apiRequest(t, "GET", baseURL+"/snapshot/x", "", nil))
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// resolveTime resolves a time expression of the from, to, fromTag and toTag
+// query parameters. The expression is a base time, optionally followed by an
+// offset, which is a duration such as +30s or -15m:
+//   - 2024-05-01T12:00:00Z (RFC3339)
+//   - now
+//   - START_TEST (a tag)
+//   - START_TEST+30s (a tag plus an offset)
+//   - -15m (an offset from now)
+//
+// A tag whose name looks like an expression is used as is.
+func (s *HTTPServer) resolveTime(expr string) (time.Time, error) {
+	if t, isBase := s.resolveBaseTime(expr); isBase {
+		return t, nil
+	}
+	if index := strings.LastIndexAny(expr, "+-"); index >= 0 {
+		offset, err := time.ParseDuration(expr[index:])
+		if err == nil {
+			if index == 0 {
+				return time.Now().Add(offset), nil
+			}
+			if t, isBase := s.resolveBaseTime(expr[:index]); isBase {
+				return t.Add(offset), nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid time %s. Shall be a tag, an RFC3339 time or now, optionally "+
+		"followed by an offset such as +30s, or an offset from now such as -15m", expr)
+}
+
+// resolveBaseTime resolves a tag, an RFC3339 time or now. Returns false
+// if expr is neither.
+func (s *HTTPServer) resolveBaseTime(expr string) (time.Time, bool) {
+	s.tagsMutex.Lock()
+	t, hasTag := s.tags[expr]
+	s.tagsMutex.Unlock()
+	if hasTag {
+		return t, true
+	}
+	if expr == "now" {
+		return time.Now(), true
+	}
+	if t, err := time.Parse(time.RFC3339, expr); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/midstar/plm/monitor"
+	"github.com/midstar/proci"
+)
+
+func TestResolveTime(t *testing.T) {
+	s := CreateHTTPServer("", DefaultConfiguration(), monitor.CreateMeasurement(3, 3, 1000, 1, proci.GenerateMock(1)))
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.tags["START_TEST"] = start
+	s.tags["EXEC_20240501-1"] = start.Add(time.Hour)
+
+	for _, test := range []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"START_TEST", start},
+		{"START_TEST+30s", start.Add(30 * time.Second)},
+		{"START_TEST-1h30m", start.Add(-90 * time.Minute)},
+		{"EXEC_20240501-1", start.Add(time.Hour)},
+		{"2024-05-01T12:00:00Z", start},
+		{"2024-05-01T14:00:00+02:00+1m", start.Add(time.Minute)},
+	} {
+		resolved, err := s.resolveTime(test.expr)
+		assertTrue(t, "No error for "+test.expr, err == nil)
+		assertTrue(t, "Time of "+test.expr, resolved.Equal(test.expected))
+	}
+
+	now, err := s.resolveTime("now")
+	assertTrue(t, "Now", err == nil && time.Since(now) < time.Minute)
+	ago, err := s.resolveTime("-15m")
+	assertTrue(t, "Relative", err == nil && time.Since(ago) > 14*time.Minute && time.Since(ago) < 16*time.Minute)
+	later, err := s.resolveTime("now+1h")
+	assertTrue(t, "Now plus offset", err == nil && time.Until(later) > 59*time.Minute)
+
+	for _, expr := range []string{"MISSING", "MISSING+30s", "START_TEST+30x", "", "+"} {
+		_, err = s.resolveTime(expr)
+		assertTrue(t, "Error for "+expr, err != nil)
+	}
+
+	from, to, err := s.getFromTo(url.Values{"fromTag": {"START_TEST+1m"}, "to": {"START_TEST+2m"}})
+	assertTrue(t, "No error", err == nil)
+	assertTrue(t, "From", from.Equal(start.Add(time.Minute)))
+	assertTrue(t, "To", to.Equal(start.Add(2*time.Minute)))
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/midstar/plm/monitor"
+)
+
+// Default interval and duration of watches
+const (
+	DefaultWatchInterval = 100 * time.Millisecond
+	DefaultWatchDuration = 10 * time.Minute
+)
+
+// addWatch starts a watch of the processes given by the query parameters:
+//   - match (processes matching, including processes started later)
+//   - uids or pid (see getUIDs)
+//   - interval (time between samples, for example 100ms)
+//   - duration (time until the watch expires, for example 10m)
+func (s *HTTPServer) addWatch(values url.Values) (monitor.Watch, error) {
+	interval, duration := DefaultWatchInterval, DefaultWatchDuration
+	for _, param := range []struct {
+		name  string
+		value *time.Duration
+	}{{"interval", &interval}, {"duration", &duration}} {
+		str := values.Get(param.name)
+		if str == "" {
+			continue
+		}
+		d, err := time.ParseDuration(str)
+		if err != nil {
+			return monitor.Watch{}, fmt.Errorf("Invalid parameter %s %s. Shall be a duration, for example 100ms", param.name, str)
+		}
+		*param.value = d
+	}
+	match := values["match"]
+	var uids []int
+	if len(match) == 0 {
+		if values.Get("uids") == "" && values.Get("pid") == "" {
+			return monitor.Watch{}, fmt.Errorf("Parameter match, uids or pid is required")
+		}
+		var err error
+		if uids, err = s.getUIDs(values); err != nil {
+			return monitor.Watch{}, err
+		}
+		if len(uids) == 0 {
+			return monitor.Watch{}, fmt.Errorf("No processes found")
+		}
+	}
+	return s.measurement.AddWatch(uids, match, interval, duration)
+}
+
+// serveAPIWatch handles:
+//   - GET watch
+//   - POST watch (see addWatch)
+//   - GET watch/<id>
+//   - DELETE watch/<id> (stops the watch, the samples are kept)
+func (s *HTTPServer) serveAPIWatch(w http.ResponseWriter, r *http.Request, id string, values url.Values) {
+	watchID := 0
+	if id != "" {
+		var err error
+		if watchID, err = strconv.Atoi(id); err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, fmt.Sprintf("Watch ID %s is not a valid integer", id))
+			return
+		}
+	}
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		offset, limit, err := parsePage(values)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+			return
+		}
+		watches := s.measurement.GetWatches()
+		writeJSON(w, r, http.StatusOK, newPage(len(watches), offset, limit,
+			func(start, end int) interface{} { return watches[start:end] }))
+	case r.Method == http.MethodPost && id == "":
+		watch, err := s.addWatch(values)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error())
+			return
+		}
+		writeJSON(w, r, http.StatusOK, watch)
+	case (r.Method == http.MethodGet || r.Method == http.MethodDelete) && id != "":
+		if r.Method == http.MethodDelete {
+			s.measurement.StopWatch(watchID)
+		}
+		watch, hasWatch := s.measurement.GetWatch(watchID)
+		if !hasWatch {
+			writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, fmt.Sprintf("Watch %d not found", watchID))
+			return
+		}
+		writeJSON(w, r, http.StatusOK, watch)
+	default:
+		allowed := "GET, POST"
+		if id != "" {
+			allowed = "GET, DELETE"
+		}
+		w.Header().Set("Allow", allowed)
+		writeError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed,
+			fmt.Sprintf("Method %s not allowed on %s", r.Method, r.URL.Path))
+	}
+}
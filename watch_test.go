@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/midstar/plm/monitor"
+	"github.com/midstar/proci"
+)
+
+func TestWatch(t *testing.T) {
+	port := 9102
+	baseURL := fmt.Sprintf("http://localhost:%d/api/v1", port)
+	config := DefaultConfiguration()
+	config.Port = port
+	pMock := proci.GenerateMock(10)
+	m := monitor.CreateMeasurement(10, 20, 3, 6, pMock)
+	m.MeasureAndLog(false)
+	httpServer := CreateHTTPServer("", config, m)
+	httpServer.Start()
+	defer httpServer.Stop()
+	time.Sleep(100 * time.Millisecond) // Allow server to start
+
+	var watch monitor.Watch
+	assertEqualsInt(t, "Status", http.StatusOK,
+		apiRequest(t, "POST", baseURL+"/watch?match=command_line_10&interval=10ms&duration=1m", "", &watch))
+	assertEqualsInt(t, "Interval", 10, watch.IntervalMs)
+	assertTrue(t, "Active", watch.Active)
+	assertEqualsStr(t, "Match", "command_line_10", watch.Match[0])
+
+	// The watch samples between the measurements
+	time.Sleep(100 * time.Millisecond)
+	m.MeasureAndLog(false)
+	var measurements Measurements
+	assertEqualsInt(t, "Status", http.StatusOK,
+		apiRequest(t, "GET", baseURL+"/measurements?match=command_line_10", "", &measurements))
+	assertTrue(t, "Watch samples included", len(measurements.Times) > 5)
+
+	var page struct {
+		Items []monitor.Watch
+		Total int
+	}
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "GET", baseURL+"/watch", "", &page))
+	assertEqualsInt(t, "Watches", 1, page.Total)
+	assertEqualsInt(t, "Status", http.StatusOK,
+		apiRequest(t, "POST", baseURL+"/watch?pid=3&interval=1s", "", &watch))
+	assertEqualsInt(t, "UIDs", 1, len(watch.UIDs))
+	assertTrue(t, "Default duration", watch.Expires.Sub(watch.Created) == DefaultWatchDuration)
+
+	// Stop
+	watch = monitor.Watch{}
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "DELETE", baseURL+"/watch/1", "", &watch))
+	assertTrue(t, "Stopped", !watch.Active && watch.NbrSamples > 0)
+	assertEqualsInt(t, "Status", http.StatusOK, apiRequest(t, "DELETE", baseURL+"/watch/2", "", nil))
+
+	// Errors
+	var apiError APIError
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "POST", baseURL+"/watch", "", &apiError))
+	assertEqualsStr(t, "Error code", ErrorCodeInvalidParameter, apiError.Error.Code)
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "POST", baseURL+"/watch?match=x&interval=1ms", "", nil))
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "POST", baseURL+"/watch?match=x&duration=x", "", nil))
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "POST", baseURL+"/watch?pid=99", "", nil))
+	assertEqualsInt(t, "Status", http.StatusNotFound, apiRequest(t, "GET", baseURL+"/watch/99", "", nil))
+	assertEqualsInt(t, "Status", http.StatusBadRequest, apiRequest(t, "GET", baseURL+"/watch/x", "", nil))
+	assertEqualsInt(t, "Status", http.StatusMethodNotAllowed, apiRequest(t, "PUT", baseURL+"/watch", "", nil))
+}